@@ -0,0 +1,286 @@
+// Package activity groups captured context into contiguous work sessions.
+package activity
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Span is a stretch of time spent in one app window, from a focus event or
+// estimated from screenshots.
+type Span struct {
+	Start time.Time
+	End   time.Time
+	App   string
+	Title string
+}
+
+// Item is something that happened at a point in time inside an activity: a
+// screenshot or a typing session, with its text.
+type Item struct {
+	Time time.Time
+	Text string
+	Keys int
+}
+
+type Input struct {
+	Spans       []Span
+	Screenshots []Item
+	Typing      []Item
+}
+
+type Config struct {
+	// IdleGap splits activities when nothing was recorded for this long.
+	IdleGap time.Duration
+	// MinSwitch is how long another app must hold focus to start a new
+	// activity; shorter switches stay in the current one.
+	MinSwitch time.Duration
+	// Keywords is the number of keywords to summarize each activity with.
+	Keywords int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		IdleGap:   5 * time.Minute,
+		MinSwitch: 2 * time.Minute,
+		Keywords:  8,
+	}
+}
+
+type Activity struct {
+	Start time.Time
+	End   time.Time
+	// App is the app that had focus for most of the activity.
+	App            string
+	Apps           []string
+	Titles         []string
+	Keywords       []string
+	Seconds        float64
+	Spans          int
+	Screenshots    int
+	TypingSessions int
+	Keystrokes     int
+
+	appSeconds   map[string]float64
+	titleSeconds map[string]float64
+	text         []string
+}
+
+// Segment clusters the input into activities, in chronological order.
+func Segment(in Input, config Config) []Activity {
+	spans := make([]Span, 0, len(in.Spans))
+	for _, s := range in.Spans {
+		if s.End.After(s.Start) {
+			spans = append(spans, s)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+
+	var activities []*Activity
+	var cur *Activity
+	for _, run := range appRuns(spans, config.IdleGap) {
+		newActivity := cur == nil || run.start.Sub(cur.End) > config.IdleGap
+		if !newActivity && run.app != cur.dominantApp() {
+			// A context switch needs both sides to last; a short start is
+			// absorbed into whatever follows
+			newActivity = run.end.Sub(run.start) >= config.MinSwitch && cur.Seconds >= config.MinSwitch.Seconds()
+		}
+		if newActivity {
+			cur = &Activity{
+				Start:        run.start,
+				appSeconds:   make(map[string]float64),
+				titleSeconds: make(map[string]float64),
+			}
+			activities = append(activities, cur)
+		}
+		for _, s := range run.spans {
+			seconds := s.End.Sub(s.Start).Seconds()
+			cur.Seconds += seconds
+			cur.Spans++
+			cur.appSeconds[s.App] += seconds
+			if s.Title != "" {
+				cur.titleSeconds[s.Title] += seconds
+			}
+			if s.End.After(cur.End) {
+				cur.End = s.End
+			}
+		}
+	}
+
+	for _, item := range in.Screenshots {
+		if a := containing(activities, item.Time, config.IdleGap); a != nil {
+			a.Screenshots++
+			a.text = append(a.text, item.Text)
+		}
+	}
+	for _, item := range in.Typing {
+		if a := containing(activities, item.Time, config.IdleGap); a != nil {
+			a.TypingSessions++
+			a.Keystrokes += item.Keys
+			a.text = append(a.text, item.Text)
+		}
+	}
+
+	docs := make([][]string, len(activities))
+	for i, a := range activities {
+		docs[i] = a.text
+	}
+	keywords := Keywords(docs, config.Keywords)
+
+	result := make([]Activity, 0, len(activities))
+	for i, a := range activities {
+		a.App = a.dominantApp()
+		a.Apps = topKeys(a.appSeconds, 5)
+		a.Titles = topKeys(a.titleSeconds, 5)
+		a.Keywords = keywords[i]
+		a.text = nil
+		result = append(result, *a)
+	}
+	return result
+}
+
+type appRun struct {
+	app        string
+	start, end time.Time
+	spans      []Span
+}
+
+// appRuns merges consecutive spans of the same app, unless an idle gap
+// separates them.
+func appRuns(spans []Span, idleGap time.Duration) []appRun {
+	var runs []appRun
+	for _, s := range spans {
+		if n := len(runs); n > 0 && runs[n-1].app == s.App && s.Start.Sub(runs[n-1].end) <= idleGap {
+			r := &runs[n-1]
+			r.spans = append(r.spans, s)
+			if s.End.After(r.end) {
+				r.end = s.End
+			}
+			continue
+		}
+		runs = append(runs, appRun{app: s.App, start: s.Start, end: s.End, spans: []Span{s}})
+	}
+	return runs
+}
+
+func (a *Activity) dominantApp() string {
+	best := ""
+	for app, seconds := range a.appSeconds {
+		if best == "" || seconds > a.appSeconds[best] || (seconds == a.appSeconds[best] && app < best) {
+			best = app
+		}
+	}
+	return best
+}
+
+// containing finds the activity covering t, allowing slack on either side for
+// items recorded just before or after a span.
+func containing(activities []*Activity, t time.Time, slack time.Duration) *Activity {
+	var best *Activity
+	var bestDist time.Duration
+	for _, a := range activities {
+		var dist time.Duration
+		switch {
+		case t.Before(a.Start):
+			dist = a.Start.Sub(t)
+		case t.After(a.End):
+			dist = t.Sub(a.End)
+		}
+		if dist <= slack && (best == nil || dist < bestDist) {
+			best = a
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+func topKeys(m map[string]float64, n int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Keywords picks the n most characteristic words of each document by
+// TF-IDF, so words that appear everywhere (menu bars, window chrome) rank
+// below words specific to one document. A document is a list of texts.
+func Keywords(docs [][]string, n int) [][]string {
+	counts := make([]map[string]int, len(docs))
+	docFreq := make(map[string]int)
+	for i, texts := range docs {
+		counts[i] = make(map[string]int)
+		for _, text := range texts {
+			for _, word := range words(text) {
+				counts[i][word]++
+			}
+		}
+		for word := range counts[i] {
+			docFreq[word]++
+		}
+	}
+
+	result := make([][]string, len(docs))
+	for i, c := range counts {
+		scores := make(map[string]float64, len(c))
+		for word, count := range c {
+			if count < 2 && len(c) > n {
+				// Single mentions are mostly OCR noise
+				continue
+			}
+			idf := math.Log(float64(1+len(docs)) / float64(docFreq[word]))
+			scores[word] = (1 + math.Log(float64(count))) * (idf + 0.1)
+		}
+		result[i] = topKeys(scores, n)
+	}
+	return result
+}
+
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var out []string
+	for _, f := range fields {
+		if len([]rune(f)) < 4 || len(f) > 30 || !unicode.IsLetter([]rune(f)[0]) || stopwords[f] {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`
+		about above after again against also because been before being below between both
+		cannot could does doing down during each from further have having here hers herself
+		himself into itself just more most must myself once only other ours ourselves over
+		same should some such than that their theirs them themselves then there these they
+		this those through under until very were what when where which while whom will with
+		would your yours yourself yourselves shall might like make made many much even
+		every need want well back still
+		aber alle auch dass diese dieser durch eine einem einen einer eines haben nach nicht
+		noch oder sein sind über unter viel werden wird wurde
+		için daha gibi olan olarak sonra
+		file edit view window help tools format insert history bookmarks profiles
+		http https www com html
+	`) {
+		stopwords[w] = true
+	}
+}
@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Encrypted objects are a header followed by the plaintext stream in
+// AES-256-GCM chunks:
+//
+//	"MEMENTO\x01" | key ID (8 bytes) | salt (16 bytes) | chunk...
+//
+// The content key is derived from the data key and the per-object salt.
+// Chunk nonces are a counter plus a final-chunk flag, so chunks can't be
+// reordered, dropped or truncated unnoticed. The plaintext stream starts
+// with the length-prefixed JSON FileMeta, which carries the file's real
+// name.
+
+const (
+	cryptMagic = "MEMENTO\x01"
+	chunkSize  = 64 << 10
+	headerSize = len(cryptMagic) + 8 + 16
+	tagSize    = 16
+)
+
+// ErrCorrupt is returned for objects that fail authentication.
+var ErrCorrupt = errors.New("object is corrupt or was tampered with")
+
+// FileMeta is stored encrypted inside every object.
+type FileMeta struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// KeyID is the key the object was encrypted with; set by Decrypt
+	KeyID string `json:"-"`
+}
+
+// Encrypt writes the encrypted object for meta and the content read from r.
+func Encrypt(w io.Writer, r io.Reader, key Key, meta FileMeta) error {
+	id, err := hex.DecodeString(key.ID)
+	if err != nil || len(id) != 8 {
+		return fmt.Errorf("invalid key ID %q", key.ID)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := newGCM(key.derive(salt, "memento backup content"))
+	if err != nil {
+		return err
+	}
+
+	header := append(append([]byte(cryptMagic), id...), salt...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	prefix := binary.BigEndian.AppendUint32(nil, uint32(len(metaJSON)))
+	src := io.MultiReader(bytes.NewReader(prefix), bytes.NewReader(metaJSON), r)
+
+	// Read one chunk ahead to know which chunk is the last
+	cur := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+	n, err := io.ReadFull(src, cur)
+	out := make([]byte, 0, chunkSize+tagSize)
+	for counter := uint64(0); ; counter++ {
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		last := err != nil
+		var m int
+		var nextErr error
+		if !last {
+			m, nextErr = io.ReadFull(src, next)
+			last = m == 0 && nextErr == io.EOF
+		}
+		out = aead.Seal(out[:0], chunkNonce(counter, last), cur[:n], nil)
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		cur, next = next, cur
+		n, err = m, nextErr
+	}
+}
+
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// Decrypt reads an encrypted object, writes its content to w and returns
+// its metadata. Content is only written after it has been authenticated,
+// but a failure part way leaves w with a prefix of the file.
+func Decrypt(w io.Writer, r io.Reader, keys *Keyring) (*FileMeta, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrCorrupt
+	}
+	if string(header[:len(cryptMagic)]) != cryptMagic {
+		return nil, fmt.Errorf("not an encrypted memento object")
+	}
+	id := hex.EncodeToString(header[len(cryptMagic) : len(cryptMagic)+8])
+	key, ok := keys.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("object is encrypted with unknown key %s", id)
+	}
+	aead, err := newGCM(key.derive(header[len(cryptMagic)+8:], "memento backup content"))
+	if err != nil {
+		return nil, err
+	}
+
+	dr := &decryptReader{src: bufio.NewReaderSize(r, chunkSize+tagSize+1), aead: aead}
+	var length [4]byte
+	if _, err := io.ReadFull(dr, length[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	metaJSON := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if len(metaJSON) > chunkSize {
+		return nil, ErrCorrupt
+	}
+	if _, err := io.ReadFull(dr, metaJSON); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var meta FileMeta
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return nil, ErrCorrupt
+	}
+	meta.KeyID = id
+
+	if _, err := io.Copy(w, dr); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return &meta, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+// decryptReader yields the authenticated plaintext of a chunk stream.
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	counter uint64
+	buf     []byte
+	chunk   []byte
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	if d.chunk == nil {
+		d.chunk = make([]byte, chunkSize+tagSize)
+	}
+	n, err := io.ReadFull(d.src, d.chunk)
+	if err == io.EOF || (err == nil && n < tagSize) {
+		return ErrCorrupt
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := d.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plaintext, err := d.aead.Open(d.chunk[:0], chunkNonce(d.counter, last), d.chunk[:n], nil)
+	if err != nil {
+		return ErrCorrupt
+	}
+	d.counter++
+	d.buf = plaintext
+	d.done = last
+	return nil
+}
@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyLimit is how many runs History keeps.
+const historyLimit = 50
+
+// retryDelay is how long after a failed run the next attempt waits.
+const retryDelay = time.Hour
+
+// Run records one backup attempt.
+type Run struct {
+	Started       time.Time     `json:"started"`
+	Duration      time.Duration `json:"duration"`
+	Trigger       string        `json:"trigger"`
+	Snapshot      string        `json:"snapshot,omitempty"`
+	Files         int           `json:"files"`
+	Uploaded      int           `json:"uploaded"`
+	BytesUploaded int64         `json:"bytes_uploaded"`
+	Expired       int           `json:"expired,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// OK reports whether the run succeeded.
+func (r Run) OK() bool {
+	return r.Error == ""
+}
+
+// NewRun summarizes a Sync result and error as a Run.
+func NewRun(trigger string, started time.Time, result *SyncResult, err error) Run {
+	run := Run{Started: started, Duration: time.Since(started), Trigger: trigger}
+	if result != nil {
+		run.Snapshot = result.Snapshot
+		run.Files = result.Files
+		run.Uploaded = result.Uploaded
+		run.BytesUploaded = result.BytesUploaded
+		run.Expired = result.SnapshotsRemoved
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// History is the backup runs recorded on this machine, oldest first. It
+// survives daemon restarts so a finished backup isn't repeated and a missed
+// one is caught up.
+type History struct {
+	Runs []Run `json:"runs"`
+}
+
+// LoadHistory reads the history at path; a missing file is an empty
+// history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// RecordRun appends run to the history at path.
+func RecordRun(path string, run Run) error {
+	h, err := LoadHistory(path)
+	if err != nil {
+		// A damaged history only costs the record of old runs
+		h = &History{}
+	}
+	h.Runs = append(h.Runs, run)
+	if len(h.Runs) > historyLimit {
+		h.Runs = h.Runs[len(h.Runs)-historyLimit:]
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LastSuccess returns the most recent successful run, or nil.
+func (h *History) LastSuccess() *Run {
+	for i := len(h.Runs) - 1; i >= 0; i-- {
+		if h.Runs[i].OK() {
+			return &h.Runs[i]
+		}
+	}
+	return nil
+}
+
+// NextRun returns when the next backup is due: the schedule's first slot
+// after the last success, right away if there never was one, and no sooner
+// than retryDelay after a failed attempt. A time in the past means a run
+// was missed, e.g. while the Mac was asleep, and is due now.
+func (h *History) NextRun(s Schedule, now time.Time) time.Time {
+	next := now
+	if last := h.LastSuccess(); last != nil {
+		next = s.Next(last.Started)
+	}
+	if n := len(h.Runs); n > 0 && !h.Runs[n-1].OK() {
+		if retry := h.Runs[n-1].Started.Add(retryDelay); retry.After(next) {
+			next = retry
+		}
+	}
+	return next
+}
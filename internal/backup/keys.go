@@ -0,0 +1,414 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeyringObject is where the sealed keyring is stored, relative to the
+// backup prefix.
+const KeyringObject = "keyring.json"
+
+// pbkdf2Iterations is the PBKDF2-HMAC-SHA256 work factor for passphrases.
+const pbkdf2Iterations = 600000
+
+// ErrWrongKey is returned when a sealed keyring can't be opened with the
+// given passphrase or identity.
+var ErrWrongKey = errors.New("wrong passphrase or identity")
+
+// Key is one data key. Object contents and names are encrypted with keys
+// derived from Secret.
+type Key struct {
+	ID      string    `json:"id"`
+	Secret  []byte    `json:"secret"`
+	Created time.Time `json:"created"`
+}
+
+func newKey() (Key, error) {
+	secret := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: hex.EncodeToString(id), Secret: secret, Created: time.Now().UTC()}, nil
+}
+
+func (k Key) derive(salt []byte, info string) []byte {
+	key, err := hkdf.Key(sha256.New, k.Secret, salt, info, 32)
+	if err != nil {
+		panic(err) // only fails for lengths out of range
+	}
+	return key
+}
+
+// ObjectName is the remote name for content with the given SHA-256: an HMAC
+// of it, so objects are content-addressed and identical files share one,
+// while listings reveal neither file names nor hashes of the contents.
+func (k Key) ObjectName(sha string) string {
+	mac := hmac.New(sha256.New, k.derive(nil, "memento backup names"))
+	mac.Write([]byte(sha))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Keyring holds every key objects may be encrypted with. The newest key is
+// the primary key new uploads use; older keys are kept to read objects that
+// haven't been re-encrypted.
+type Keyring struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKeyring returns a keyring with one fresh key.
+func NewKeyring() (*Keyring, error) {
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{Keys: []Key{key}}, nil
+}
+
+// Primary returns the key new objects are encrypted with.
+func (k *Keyring) Primary() Key {
+	return k.Keys[len(k.Keys)-1]
+}
+
+// Get returns the key with the given ID.
+func (k *Keyring) Get(id string) (Key, bool) {
+	for _, key := range k.Keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Rotate adds a new primary key.
+func (k *Keyring) Rotate() (Key, error) {
+	key, err := newKey()
+	if err != nil {
+		return Key{}, err
+	}
+	k.Keys = append(k.Keys, key)
+	return key, nil
+}
+
+// LoadKeyring reads a plaintext keyring written by Save. It returns nil if
+// the file doesn't exist.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var k Keyring
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(k.Keys) == 0 {
+		return nil, fmt.Errorf("%s holds no keys", path)
+	}
+	return &k, nil
+}
+
+// Save writes the keyring readable only by the owner.
+func (k *Keyring) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SealedKeyring is the keyring as stored in the bucket, encrypted to a
+// passphrase, to X25519 recipients, or both.
+type SealedKeyring struct {
+	Version    int             `json:"version"`
+	Passphrase *PassphraseWrap `json:"passphrase,omitempty"`
+	Recipients []RecipientWrap `json:"recipients,omitempty"`
+}
+
+// PassphraseWrap is the keyring encrypted with a PBKDF2-derived key.
+type PassphraseWrap struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Sealed     []byte `json:"sealed"`
+}
+
+// RecipientWrap is the keyring encrypted to one recipient with an ephemeral
+// X25519 key agreement.
+type RecipientWrap struct {
+	Recipient string `json:"recipient"`
+	Ephemeral []byte `json:"ephemeral"`
+	Sealed    []byte `json:"sealed"`
+}
+
+// Seal encrypts the keyring. At least one of passphrase and recipients must
+// be given.
+func (k *Keyring) Seal(passphrase string, recipients []string) (*SealedKeyring, error) {
+	if passphrase == "" && len(recipients) == 0 {
+		return nil, fmt.Errorf("a passphrase or recipient is required")
+	}
+	plaintext, err := json.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	sealed := &SealedKeyring{Version: 1}
+
+	if passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := sealBox(key, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		sealed.Passphrase = &PassphraseWrap{Salt: salt, Iterations: pbkdf2Iterations, Sealed: ciphertext}
+	}
+
+	for _, recipient := range recipients {
+		public, err := ParseRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(public)
+		if err != nil {
+			return nil, err
+		}
+		key, err := recipientKey(shared, ephemeral.PublicKey(), public)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := sealBox(key, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		sealed.Recipients = append(sealed.Recipients, RecipientWrap{
+			Recipient: recipient,
+			Ephemeral: ephemeral.PublicKey().Bytes(),
+			Sealed:    ciphertext,
+		})
+	}
+	return sealed, nil
+}
+
+// RecipientList returns the recipients the keyring is sealed to.
+func (s *SealedKeyring) RecipientList() []string {
+	var list []string
+	for _, r := range s.Recipients {
+		list = append(list, r.Recipient)
+	}
+	return list
+}
+
+// OpenPassphrase decrypts the keyring with a passphrase.
+func (s *SealedKeyring) OpenPassphrase(passphrase string) (*Keyring, error) {
+	if s.Passphrase == nil {
+		return nil, fmt.Errorf("the keyring is not protected by a passphrase")
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, s.Passphrase.Salt, s.Passphrase.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	return openKeyring(key, s.Passphrase.Sealed)
+}
+
+// OpenIdentity decrypts the keyring with an X25519 identity
+// ("AGE-SECRET-KEY-1...").
+func (s *SealedKeyring) OpenIdentity(identity string) (*Keyring, error) {
+	private, err := ParseIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range s.Recipients {
+		ephemeral, err := ecdh.X25519().NewPublicKey(r.Ephemeral)
+		if err != nil {
+			continue
+		}
+		shared, err := private.ECDH(ephemeral)
+		if err != nil {
+			continue
+		}
+		key, err := recipientKey(shared, ephemeral, private.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+		if k, err := openKeyring(key, r.Sealed); err == nil {
+			return k, nil
+		}
+	}
+	return nil, ErrWrongKey
+}
+
+func recipientKey(shared []byte, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, shared, salt, "memento backup keyring", 32)
+}
+
+func openKeyring(key, ciphertext []byte) (*Keyring, error) {
+	plaintext, err := openBox(key, ciphertext)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	var k Keyring
+	if err := json.Unmarshal(plaintext, &k); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	if len(k.Keys) == 0 {
+		return nil, fmt.Errorf("keyring holds no keys")
+	}
+	return &k, nil
+}
+
+// sealBox encrypts with AES-256-GCM under a random nonce, which is prepended.
+func sealBox(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openBox(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateIdentity returns a new X25519 identity and its recipient, in
+// age's format.
+func GenerateIdentity() (identity, recipient string, err error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	identity, err = bech32Encode("age-secret-key-", private.Bytes())
+	if err != nil {
+		return "", "", err
+	}
+	recipient, err = bech32Encode("age", private.PublicKey().Bytes())
+	if err != nil {
+		return "", "", err
+	}
+	return strings.ToUpper(identity), recipient, nil
+}
+
+// ParseRecipient parses an "age1..." public key.
+func ParseRecipient(s string) (*ecdh.PublicKey, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil || hrp != "age" {
+		return nil, fmt.Errorf("invalid recipient %q", s)
+	}
+	return ecdh.X25519().NewPublicKey(data)
+}
+
+// ParseIdentity parses an "AGE-SECRET-KEY-1..." private key.
+func ParseIdentity(s string) (*ecdh.PrivateKey, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil || hrp != "age-secret-key-" {
+		return nil, fmt.Errorf("invalid identity")
+	}
+	return ecdh.X25519().NewPrivateKey(data)
+}
+
+// ReadIdentityFile returns the first identity in an age-keygen style file,
+// skipping comments.
+func ReadIdentityFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "AGE-SECRET-KEY-1") {
+			return line, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no identity found in %s", path)
+}
+
+// FetchKeyring downloads the sealed keyring, or returns nil if the bucket
+// has none.
+func FetchKeyring(ctx context.Context, c *S3Client, prefix string) (*SealedKeyring, error) {
+	body, _, err := c.GetObject(ctx, prefix+KeyringObject)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var sealed SealedKeyring
+	if err := json.NewDecoder(body).Decode(&sealed); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	return &sealed, nil
+}
+
+// StoreKeyring uploads the sealed keyring, replacing any previous one.
+func StoreKeyring(ctx context.Context, c *S3Client, prefix string, sealed *SealedKeyring) error {
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = c.PutObject(ctx, prefix+KeyringObject, data, nil)
+	return err
+}
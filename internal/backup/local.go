@@ -0,0 +1,375 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LocalTarget keeps plain-file snapshots in a directory, e.g. on an
+// external drive. Each snapshot is a complete copy of the storage directory
+// in Root/<id>/, described by Root/<id>.json. Files unchanged since the
+// previous snapshot are hard links to it, so a snapshot only takes the space
+// of what changed. Drives without hard links (such as exFAT) get full
+// copies.
+//
+// After each backup, snapshots are rotated: the newest snapshot of each of
+// the last KeepDaily days and of each of the last KeepWeekly weeks is kept.
+type LocalTarget struct {
+	Root       string
+	KeepDaily  int
+	KeepWeekly int
+}
+
+func (t *LocalTarget) String() string {
+	return t.Root
+}
+
+func (t *LocalTarget) snapshotDir(id string) string {
+	return filepath.Join(t.Root, id)
+}
+
+func (t *LocalTarget) manifestPath(id string) string {
+	return filepath.Join(t.Root, id+".json")
+}
+
+// Backup copies dir into a new snapshot, hard-linking unchanged files to the
+// previous one.
+func (t *LocalTarget) Backup(ctx context.Context, dir string, opts SyncOptions) (*SyncResult, error) {
+	result := &SyncResult{Started: time.Now()}
+	defer func() { result.Duration = time.Since(result.Started) }()
+
+	if err := t.Available(); err != nil {
+		return result, err
+	}
+	if rel, err := filepath.Rel(dir, t.Root); err == nil && !strings.HasPrefix(rel, "..") {
+		return result, fmt.Errorf("backup path %s is inside the storage directory", t.Root)
+	}
+	if err := os.MkdirAll(t.Root, 0700); err != nil {
+		return result, err
+	}
+	ids, err := t.cleanup()
+	if err != nil {
+		return result, err
+	}
+
+	previous := make(map[string]ManifestEntry)
+	var previousDir string
+	if len(ids) > 0 {
+		last := ids[len(ids)-1]
+		m, err := t.Manifest(ctx, last)
+		if err != nil {
+			return result, err
+		}
+		for _, f := range m.Files {
+			previous[f.Path] = f
+		}
+		previousDir = t.snapshotDir(last)
+	}
+
+	local, err := scanFiles(dir, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Files = len(local)
+
+	manifest := &Manifest{ID: result.Started.UTC().Format(snapshotIDFormat), Created: result.Started}
+	if _, err := os.Stat(t.manifestPath(manifest.ID)); err == nil {
+		return result, fmt.Errorf("snapshot %s already exists", manifest.ID)
+	}
+	partial := t.snapshotDir(manifest.ID) + ".partial"
+	defer os.RemoveAll(partial)
+
+	for _, f := range local {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		dst := filepath.Join(partial, filepath.FromSlash(f.rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return result, err
+		}
+
+		prev, ok := previous[f.rel]
+		linkTo := filepath.Join(previousDir, filepath.FromSlash(f.rel))
+		if ok && prev.Size == f.info.Size() && prev.ModTime.Equal(f.info.ModTime()) && os.Link(linkTo, dst) == nil {
+			manifest.Files = append(manifest.Files, prev)
+			result.Skipped++
+			continue
+		}
+
+		entry, err := copyFile(f, dst)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.rel, err))
+			continue
+		}
+		// Same content under a new modification time, e.g. the database
+		// snapshot: link anyway
+		if ok && prev.SHA256 == entry.SHA256 {
+			os.Remove(dst)
+			if os.Link(linkTo, dst) == nil {
+				entry = prev
+				manifest.Files = append(manifest.Files, entry)
+				result.Skipped++
+				continue
+			}
+			if entry, err = copyFile(f, dst); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.rel, err))
+				continue
+			}
+		}
+		manifest.Files = append(manifest.Files, entry)
+		result.Uploaded++
+		result.BytesUploaded += entry.Size
+		if opts.Progress != nil {
+			opts.Progress(f.rel, entry.Size)
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d of %d files failed to copy", len(result.Errors), len(local))
+	}
+
+	// The manifest is written last: a snapshot without one is incomplete
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return result, err
+	}
+	if err := os.Rename(partial, t.snapshotDir(manifest.ID)); err != nil {
+		return result, err
+	}
+	tmp := t.manifestPath(manifest.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return result, err
+	}
+	if err := os.Rename(tmp, t.manifestPath(manifest.ID)); err != nil {
+		return result, err
+	}
+	result.Snapshot = manifest.ID
+
+	result.SnapshotsRemoved, err = t.rotate(append(ids, manifest.ID))
+	if err != nil {
+		return result, fmt.Errorf("failed to remove old snapshots: %w", err)
+	}
+	return result, nil
+}
+
+// volumesDir is where macOS mounts external drives.
+const volumesDir = "/Volumes"
+
+// Available reports an error unless Root's drive is mounted. Root's parent
+// must exist, so the mount point of an unplugged drive is never created, and
+// a Root directly under /Volumes must be a drive itself: /Volumes is always
+// there, and a directory made in it lives on the boot disk.
+func (t *LocalTarget) Available() error {
+	root := filepath.Clean(t.Root)
+	if _, err := os.Stat(filepath.Dir(root)); err != nil {
+		return fmt.Errorf("backup destination is unavailable: %w", err)
+	}
+	if filepath.Dir(root) == volumesDir && !mountPoint(root) {
+		return fmt.Errorf("backup destination %s is not a mounted drive", root)
+	}
+	return nil
+}
+
+// mountPoint reports whether path is a directory on another device than its
+// parent.
+func mountPoint(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	parent, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	parentSt, parentOK := parent.Sys().(*syscall.Stat_t)
+	return ok && parentOK && st.Dev != parentSt.Dev
+}
+
+// copyFile copies f to dst, hashing it on the way, and keeps its
+// modification time.
+func copyFile(f localFile, dst string) (ManifestEntry, error) {
+	entry := ManifestEntry{Path: f.rel, Size: f.info.Size(), ModTime: f.info.ModTime()}
+	src, err := os.Open(f.path)
+	if err != nil {
+		return entry, err
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return entry, err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(src, entry.Size))
+	if err != nil {
+		return entry, err
+	}
+	if n != entry.Size {
+		return entry, fmt.Errorf("file shrank while it was read")
+	}
+	if err := out.Close(); err != nil {
+		return entry, err
+	}
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return entry, os.Chtimes(dst, entry.ModTime, entry.ModTime)
+}
+
+// cleanup removes interrupted snapshots and returns the complete ones,
+// oldest first.
+func (t *LocalTarget) cleanup() ([]string, error) {
+	entries, err := os.ReadDir(t.Root)
+	if err != nil {
+		return nil, err
+	}
+	complete := make(map[string]bool)
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			complete[id] = true
+		}
+	}
+
+	var ids []string
+	for _, e := range entries {
+		name := e.Name()
+		id := strings.TrimSuffix(name, ".partial")
+		if _, err := time.Parse(snapshotIDFormat, id); err != nil || !e.IsDir() {
+			continue
+		}
+		if id != name || !complete[id] {
+			if err := os.RemoveAll(filepath.Join(t.Root, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// rotate removes the snapshots the retention doesn't keep and returns how
+// many it removed.
+func (t *LocalTarget) rotate(ids []string) (int, error) {
+	keep := retainedSnapshots(ids, t.KeepDaily, t.KeepWeekly)
+	removed := 0
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		// Unmark it complete first, so a failed removal is cleaned up later
+		if err := os.Remove(t.manifestPath(id)); err != nil {
+			return removed, err
+		}
+		if err := os.RemoveAll(t.snapshotDir(id)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (t *LocalTarget) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	ids, err := t.ids()
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []SnapshotInfo
+	for _, id := range ids {
+		m, err := t.Manifest(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, SnapshotInfo{ID: id, Created: m.Created, Files: len(m.Files), Size: m.Size()})
+	}
+	return snapshots, nil
+}
+
+// ids returns the complete snapshots, oldest first, without changing
+// anything.
+func (t *LocalTarget) ids() ([]string, error) {
+	entries, err := os.ReadDir(t.Root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(snapshotIDFormat, id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (t *LocalTarget) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	if id == "" || id == "latest" {
+		ids, err := t.ids()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("%s holds no snapshots", t.Root)
+		}
+		id = ids[len(ids)-1]
+	}
+	data, err := os.ReadFile(t.manifestPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no snapshot %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", id, err)
+	}
+	// The files are found by the name, not what the manifest says
+	m.ID = id
+	return &m, nil
+}
+
+func (t *LocalTarget) Restore(ctx context.Context, m *Manifest, dir string, opts RestoreOptions) (*RestoreResult, error) {
+	return restoreFiles(ctx, m, dir, opts, t.fetch(m.ID))
+}
+
+func (t *LocalTarget) Verify(ctx context.Context, sample int) (*VerifyResult, error) {
+	m, err := t.Manifest(ctx, "latest")
+	if err != nil {
+		return nil, err
+	}
+	exists := func(f ManifestEntry) bool {
+		_, err := os.Stat(filepath.Join(t.snapshotDir(m.ID), filepath.FromSlash(f.Path)))
+		return err == nil
+	}
+	return verifyFiles(ctx, m, sample, exists, t.fetch(m.ID)), ctx.Err()
+}
+
+func (t *LocalTarget) fetch(id string) fetchFunc {
+	return func(ctx context.Context, f ManifestEntry, w io.Writer) error {
+		src, err := os.Open(filepath.Join(t.snapshotDir(id), filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	}
+}
@@ -0,0 +1,234 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLocalTarget(t *testing.T) *LocalTarget {
+	t.Helper()
+	return &LocalTarget{Root: filepath.Join(t.TempDir(), "memento"), KeepDaily: 7, KeepWeekly: 4}
+}
+
+// backdate moves the target's newest snapshot back by d, so the next backup
+// doesn't collide with it and the retention sees another day.
+func backdate(t *testing.T, target *LocalTarget, d time.Duration) string {
+	t.Helper()
+	ids, err := target.ids()
+	if err != nil || len(ids) == 0 {
+		t.Fatalf("ids = %v, %v", ids, err)
+	}
+	newest := ids[len(ids)-1]
+	created, _ := time.Parse(snapshotIDFormat, newest)
+	id := created.Add(-d).Format(snapshotIDFormat)
+	if err := os.Rename(target.snapshotDir(newest), target.snapshotDir(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(target.manifestPath(newest), target.manifestPath(id)); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// touch gives a file a new modification time without changing it.
+func touch(t *testing.T, path string) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	ai, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(ai, bi)
+}
+
+func TestLocalBackupLinksUnchangedFiles(t *testing.T) {
+	target := newLocalTarget(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memento.db":                           "database",
+		"screenshots/2026/01/15/10-00-00.webp": "image",
+		"memento.log":                          "excluded",
+	})
+	opts := SyncOptions{Exclude: DefaultExclude}
+
+	result, err := target.Backup(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 2 || result.Skipped != 0 {
+		t.Errorf("first run: %d copied, %d linked; want 2, 0", result.Uploaded, result.Skipped)
+	}
+	first := backdate(t, target, 48*time.Hour)
+
+	writeFiles(t, dir, map[string]string{"memento.db": "database, changed"})
+	touch(t, filepath.Join(dir, "memento.db"))
+	result, err = target.Backup(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || result.Skipped != 1 {
+		t.Errorf("second run: %d copied, %d linked; want 1, 1", result.Uploaded, result.Skipped)
+	}
+
+	image := filepath.FromSlash("screenshots/2026/01/15/10-00-00.webp")
+	if !sameFile(t, filepath.Join(target.snapshotDir(first), image), filepath.Join(target.snapshotDir(result.Snapshot), image)) {
+		t.Error("the unchanged file isn't a hard link to the previous snapshot")
+	}
+	if sameFile(t, filepath.Join(target.snapshotDir(first), "memento.db"), filepath.Join(target.snapshotDir(result.Snapshot), "memento.db")) {
+		t.Error("the changed file is a hard link to the previous snapshot")
+	}
+	if _, err := os.Stat(filepath.Join(target.snapshotDir(result.Snapshot), "memento.log")); !os.IsNotExist(err) {
+		t.Errorf("excluded file copied: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target.snapshotDir(first), "memento.db")); string(data) != "database" {
+		t.Errorf("previous snapshot's database = %q", data)
+	}
+}
+
+func TestLocalBackupRelinksSameContent(t *testing.T) {
+	target := newLocalTarget(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"memento.db": "database"})
+	opts := SyncOptions{Exclude: DefaultExclude}
+
+	if _, err := target.Backup(ctx, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	first := backdate(t, target, 48*time.Hour)
+
+	// Rewritten with the same content, as the database snapshot is each run
+	touch(t, filepath.Join(dir, "memento.db"))
+	result, err := target.Backup(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 0 || result.Skipped != 1 || result.BytesUploaded != 0 {
+		t.Errorf("%d copied (%d bytes), %d linked; want 0, 1", result.Uploaded, result.BytesUploaded, result.Skipped)
+	}
+	if !sameFile(t, filepath.Join(target.snapshotDir(first), "memento.db"), filepath.Join(target.snapshotDir(result.Snapshot), "memento.db")) {
+		t.Error("the file with unchanged content isn't a hard link to the previous snapshot")
+	}
+}
+
+func TestLocalBackupRemovesInterruptedSnapshots(t *testing.T) {
+	target := newLocalTarget(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"memento.db": "database"})
+	opts := SyncOptions{Exclude: DefaultExclude}
+
+	if _, err := target.Backup(ctx, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	complete := backdate(t, target, 48*time.Hour)
+
+	// A copy that was interrupted, and one whose manifest wasn't written
+	created, _ := time.Parse(snapshotIDFormat, complete)
+	partial := target.snapshotDir(created.Add(time.Hour).Format(snapshotIDFormat)) + ".partial"
+	unfinished := target.snapshotDir(created.Add(2 * time.Hour).Format(snapshotIDFormat))
+	writeFiles(t, partial, map[string]string{"memento.db": "partial"})
+	writeFiles(t, unfinished, map[string]string{"memento.db": "unfinished"})
+
+	result, err := target.Backup(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{partial, unfinished} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed: %v", filepath.Base(path), err)
+		}
+	}
+	entries, err := os.ReadDir(target.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{complete, complete + ".json", result.Snapshot, result.Snapshot + ".json"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("backup directory holds %v, want %v", names, want)
+	}
+
+	// The new snapshot links to the complete one, not to the interrupted copies
+	if !sameFile(t, filepath.Join(target.snapshotDir(complete), "memento.db"), filepath.Join(target.snapshotDir(result.Snapshot), "memento.db")) {
+		t.Error("the new snapshot doesn't link to the last complete one")
+	}
+}
+
+func TestLocalRotate(t *testing.T) {
+	id := func(s string) string {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.UTC().Format(snapshotIDFormat)
+	}
+	// 2026-03-02 is a Monday
+	ids := []string{
+		id("2026-02-13 09:00"),
+		id("2026-02-20 09:00"),
+		id("2026-02-27 09:00"),
+		id("2026-03-02 09:00"),
+		id("2026-03-03 09:00"),
+		id("2026-03-03 18:00"),
+		id("2026-03-04 09:00"),
+	}
+	tests := []struct {
+		daily, weekly int
+		want          []string
+	}{
+		{0, 0, []string{id("2026-03-04 09:00")}},
+		{2, 0, []string{id("2026-03-03 18:00"), id("2026-03-04 09:00")}},
+		{1, 3, []string{id("2026-02-20 09:00"), id("2026-02-27 09:00"), id("2026-03-04 09:00")}},
+		{7, 4, []string{
+			id("2026-02-13 09:00"), id("2026-02-20 09:00"), id("2026-02-27 09:00"),
+			id("2026-03-02 09:00"), id("2026-03-03 18:00"), id("2026-03-04 09:00"),
+		}},
+	}
+	for _, tt := range tests {
+		target := &LocalTarget{Root: t.TempDir(), KeepDaily: tt.daily, KeepWeekly: tt.weekly}
+		for _, id := range ids {
+			writeFiles(t, target.snapshotDir(id), map[string]string{"memento.db": id})
+			if err := os.WriteFile(target.manifestPath(id), []byte("{}"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		removed, err := target.rotate(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := target.ids()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") || removed != len(ids)-len(tt.want) {
+			t.Errorf("daily %d, weekly %d: removed %d, kept %v; want %v", tt.daily, tt.weekly, removed, got, tt.want)
+		}
+		for _, id := range ids {
+			_, err := os.Stat(target.snapshotDir(id))
+			if kept := err == nil; kept != strings.Contains(strings.Join(tt.want, ","), id) {
+				t.Errorf("daily %d, weekly %d: directory of %s kept = %v", tt.daily, tt.weekly, id, kept)
+			}
+		}
+	}
+}
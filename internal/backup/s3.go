@@ -0,0 +1,536 @@
+// Package backup encrypts the archive and uploads it to S3-compatible object
+// storage such as Cloudflare R2, AWS S3 or MinIO.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPartSize is the multipart chunk size. Files up to this size are
+	// uploaded in a single request.
+	DefaultPartSize = 16 << 20
+	// DefaultMaxRetries is how often a failed request is retried
+	DefaultMaxRetries = 5
+)
+
+// S3Config is where and how to connect. Region may be "auto" for R2.
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Client is a minimal S3 API client: enough to upload, list, download and
+// delete objects. Requests use path-style URLs and Signature Version 4.
+type S3Client struct {
+	config     S3Config
+	endpoint   *url.URL
+	http       *http.Client
+	PartSize   int64
+	MaxRetries int
+	// backoff is the delay before the first retry; it doubles after each
+	backoff time.Duration
+}
+
+// ObjectInfo describes a remote object. ETag is unquoted.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// S3Error is an error response from the server.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+func NewS3Client(config S3Config) (*S3Client, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("no bucket configured")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no credentials configured")
+	}
+	if config.Region == "" {
+		config.Region = "auto"
+	}
+	if config.Endpoint == "" {
+		if config.Region == "auto" {
+			return nil, fmt.Errorf("no endpoint configured")
+		}
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	if !strings.Contains(config.Endpoint, "://") {
+		config.Endpoint = "https://" + config.Endpoint
+	}
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", config.Endpoint, err)
+	}
+
+	return &S3Client{
+		config:     config,
+		endpoint:   endpoint,
+		http:       &http.Client{Timeout: 10 * time.Minute},
+		PartSize:   DefaultPartSize,
+		MaxRetries: DefaultMaxRetries,
+		backoff:    500 * time.Millisecond,
+	}, nil
+}
+
+// Bucket returns the bucket objects are stored in.
+func (c *S3Client) Bucket() string {
+	return c.config.Bucket
+}
+
+// request is one API call. The body is kept in memory so the request can be
+// signed and retried.
+type request struct {
+	method  string
+	key     string
+	query   url.Values
+	header  http.Header
+	body    []byte
+	okCodes []int
+}
+
+// do sends r, retrying network errors, throttling and server errors with
+// exponential backoff. The caller closes the response body.
+func (c *S3Client) do(ctx context.Context, r request) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			// 0.5s, 1s, 2s, ... by default, with jitter, capped at 30s
+			delay := min(c.backoff<<(attempt-1), 30*time.Second)
+			delay += time.Duration(rand.Int64N(int64(delay / 2)))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := c.newRequest(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		for _, code := range r.okCodes {
+			if resp.StatusCode == code {
+				return resp, nil
+			}
+		}
+		lastErr = readError(resp)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, lastErr
+		}
+	}
+	return nil, fmt.Errorf("giving up after %d attempts: %w", c.MaxRetries+1, lastErr)
+}
+
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	s3err := &S3Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	xml.Unmarshal(body, s3err)
+	return s3err
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var s3err *S3Error
+	return errors.As(err, &s3err) && s3err.StatusCode == http.StatusNotFound
+}
+
+func (c *S3Client) newRequest(ctx context.Context, r request) (*http.Request, error) {
+	u := *c.endpoint
+	u.Path = c.endpoint.Path + "/" + c.config.Bucket
+	if r.key != "" {
+		u.Path += "/" + r.key
+	}
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = canonicalQuery(r.query)
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), bytes.NewReader(r.body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(r.body))
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	c.sign(req, r.body, time.Now())
+	return req, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (c *S3Client) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Sign the host and all x-amz-* headers
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), date)
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes everything but unreserved characters, as
+// SigV4 requires; with keepSlash, '/' is left alone.
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (keepSlash && ch == '/') {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func encodePath(path string) string {
+	return uriEncode(path, true)
+}
+
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, false)+"="+uriEncode(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func metadataHeaders(meta map[string]string) http.Header {
+	header := http.Header{}
+	for k, v := range meta {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	return header
+}
+
+// PutObject uploads body as key in a single request and returns its ETag.
+func (c *S3Client) PutObject(ctx context.Context, key string, body []byte, meta map[string]string) (string, error) {
+	header := metadataHeaders(meta)
+	sum := md5.Sum(body)
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := c.do(ctx, request{method: http.MethodPut, key: key, header: header, body: body, okCodes: []int{http.StatusOK}})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+// UploadFile uploads the file at path as key, in parts if it is larger than
+// PartSize, and returns the object's ETag.
+func (c *S3Client) UploadFile(ctx context.Context, key, path string, meta map[string]string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if info.Size() <= c.PartSize {
+		body, err := io.ReadAll(f)
+		if err != nil {
+			return "", err
+		}
+		return c.PutObject(ctx, key, body, meta)
+	}
+	return c.multipartUpload(ctx, key, f, meta)
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *S3Client) multipartUpload(ctx context.Context, key string, r io.Reader, meta map[string]string) (string, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost, key: key, query: url.Values{"uploads": {""}},
+		header: metadataHeaders(meta), okCodes: []int{http.StatusOK},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %s: %w", key, err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return "", fmt.Errorf("failed to start upload of %s: bad response", key)
+	}
+	uploadID := initiated.UploadID
+
+	abort := func() {
+		// Best effort; the server eventually cleans up abandoned uploads
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if resp, err := c.do(ctx, request{
+			method: http.MethodDelete, key: key, query: url.Values{"uploadId": {uploadID}},
+			okCodes: []int{http.StatusNoContent, http.StatusOK},
+		}); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	var parts []completedPart
+	buf := make([]byte, c.PartSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			abort()
+			return "", err
+		}
+		part := buf[:n]
+		sum := md5.Sum(part)
+		header := http.Header{}
+		header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		resp, uerr := c.do(ctx, request{
+			method: http.MethodPut, key: key,
+			query:  url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}},
+			header: header, body: part, okCodes: []int{http.StatusOK},
+		})
+		if uerr != nil {
+			abort()
+			return "", fmt.Errorf("failed to upload part %d of %s: %w", number, key, uerr)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	body, _ := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	resp, err = c.do(ctx, request{
+		method: http.MethodPost, key: key, query: url.Values{"uploadId": {uploadID}},
+		body: body, okCodes: []int{http.StatusOK},
+	})
+	if err != nil {
+		abort()
+		return "", fmt.Errorf("failed to complete upload of %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	// Completion can fail with a 200 whose body is an error
+	data, _ := io.ReadAll(resp.Body)
+	var completed struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(data, &completed); err != nil || completed.XMLName.Local == "Error" {
+		abort()
+		return "", fmt.Errorf("failed to complete upload of %s: %w", key, &S3Error{StatusCode: resp.StatusCode, Code: completed.Code, Message: completed.Message})
+	}
+	return strings.Trim(completed.ETag, `"`), nil
+}
+
+// HeadObject returns an object's size, ETag and metadata, or nil if it
+// doesn't exist.
+func (c *S3Client) HeadObject(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := c.do(ctx, request{method: http.MethodHead, key: key, okCodes: []int{http.StatusOK}})
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return objectInfo(key, resp), nil
+}
+
+// GetObject downloads an object. The caller closes the body.
+func (c *S3Client) GetObject(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, key: key, okCodes: []int{http.StatusOK}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return resp.Body, objectInfo(key, resp), nil
+}
+
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:      key,
+		Size:     resp.ContentLength,
+		ETag:     strings.Trim(resp.Header.Get("ETag"), `"`),
+		Metadata: make(map[string]string),
+	}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	for name, values := range resp.Header {
+		if meta, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok && len(values) > 0 {
+			info.Metadata[meta] = values[0]
+		}
+	}
+	return info
+}
+
+// ListObjects calls fn for every object whose key starts with prefix.
+func (c *S3Client) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, request{method: http.MethodGet, query: query, okCodes: []int{http.StatusOK}})
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		var page struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				ETag         string    `xml:"ETag"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse listing of %s: %w", prefix, err)
+		}
+
+		for _, obj := range page.Contents {
+			info := ObjectInfo{Key: obj.Key, Size: obj.Size, ETag: strings.Trim(obj.ETag, `"`), LastModified: obj.LastModified}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// DeleteObject removes an object; deleting a missing object succeeds.
+func (c *S3Client) DeleteObject(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, request{method: http.MethodDelete, key: key, okCodes: []int{http.StatusNoContent, http.StatusOK}})
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
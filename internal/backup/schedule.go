@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when backups run.
+type Schedule interface {
+	// Next returns the first run time after t
+	Next(t time.Time) time.Time
+}
+
+// MinInterval is the shortest interval schedule accepted.
+const MinInterval = 5 * time.Minute
+
+var scheduleAliases = map[string]string{
+	"hourly": "0 * * * *",
+	"daily":  "0 2 * * *",
+	"weekly": "0 2 * * 0",
+}
+
+// ParseSchedule accepts "hourly", "daily" (2 AM), "weekly" (Sunday 2 AM),
+// an interval such as "6h" or "every 30m", or a five-field cron expression
+// such as "30 1 * * 1-5".
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimPrefix(s, "@")
+	if alias, ok := scheduleAliases[s]; ok {
+		s = alias
+	}
+	if rest, ok := strings.CutPrefix(s, "every "); ok {
+		s = strings.TrimSpace(rest)
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < MinInterval {
+			return nil, fmt.Errorf("interval %s is shorter than %s", d, MinInterval)
+		}
+		return intervalSchedule(d), nil
+	}
+	return parseCron(s)
+}
+
+type intervalSchedule time.Duration
+
+func (d intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+// cronSchedule holds one bit per allowed value of each field.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// With both day fields restricted, either may match, as in cron
+	domAny, dowAny bool
+}
+
+func parseCron(s string) (Schedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: use daily, hourly, weekly, an interval like 6h, or a cron expression like \"0 2 * * *\"", s)
+	}
+	c := &cronSchedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	ranges := []struct {
+		bits     *uint64
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}}
+	for i, r := range ranges {
+		if *r.bits, err = parseCronField(fields[i], r.min, r.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", s, err)
+		}
+	}
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", s)
+	}
+	return c, nil
+}
+
+// parseCronField parses comma-separated values, ranges and steps: "5",
+// "1-5", "*/15", "0-30/10".
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		if expr != "*" {
+			loStr, hiStr, isRange := strings.Cut(expr, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every valid expression matches within a few years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
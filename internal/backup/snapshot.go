@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotPrefix is where manifests are stored, relative to the backup
+// prefix. Each backup run writes one manifest listing every file and the
+// object holding its content; objects are shared between snapshots.
+const SnapshotPrefix = "snapshots/"
+
+// snapshotIDFormat names snapshots by their UTC creation time, so they
+// sort chronologically.
+const snapshotIDFormat = "20060102T150405Z"
+
+// gcGrace is how old a data object no snapshot references must be before it
+// is deleted: a backup running elsewhere uploads its objects before the
+// manifest that references them.
+const gcGrace = 24 * time.Hour
+
+// Manifest is the file list of one snapshot.
+type Manifest struct {
+	ID      string          `json:"id"`
+	Created time.Time       `json:"created"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is one file in a snapshot. Object is the name of the
+// encrypted object under DataPrefix holding its content.
+type ManifestEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+	Object  string    `json:"object"`
+}
+
+// Size is the total size of the snapshot's files.
+func (m *Manifest) Size() int64 {
+	var n int64
+	for _, f := range m.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// SnapshotInfo describes a snapshot without downloading its manifest.
+type SnapshotInfo struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Files   int       `json:"files"`
+	Size    int64     `json:"size"`
+}
+
+// putManifest encrypts the gzipped manifest and uploads it. The file count
+// and size go in plaintext metadata so snapshots can be listed cheaply.
+func putManifest(ctx context.Context, c *S3Client, prefix string, m *Manifest, key Key) error {
+	var raw bytes.Buffer
+	zw := gzip.NewWriter(&raw)
+	if err := json.NewEncoder(zw).Encode(m); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var sealed bytes.Buffer
+	meta := FileMeta{Path: SnapshotPrefix + m.ID, Size: int64(raw.Len()), ModTime: m.Created}
+	if err := Encrypt(&sealed, &raw, key, meta); err != nil {
+		return err
+	}
+	_, err := c.PutObject(ctx, prefix+SnapshotPrefix+m.ID, sealed.Bytes(), map[string]string{
+		"files": strconv.Itoa(len(m.Files)),
+		"size":  strconv.FormatInt(m.Size(), 10),
+	})
+	return err
+}
+
+// ListSnapshots returns the bucket's snapshots, oldest first.
+func ListSnapshots(ctx context.Context, c *S3Client, prefix string) ([]SnapshotInfo, error) {
+	ids, err := snapshotIDs(ctx, c, prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]SnapshotInfo, len(ids))
+	for i, id := range ids {
+		created, _ := time.Parse(snapshotIDFormat, id)
+		snapshots[i] = SnapshotInfo{ID: id, Created: created}
+	}
+
+	for i := range snapshots {
+		info, err := c.HeadObject(ctx, prefix+SnapshotPrefix+snapshots[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			snapshots[i].Files, _ = strconv.Atoi(info.Metadata["files"])
+			snapshots[i].Size, _ = strconv.ParseInt(info.Metadata["size"], 10, 64)
+		}
+	}
+	return snapshots, nil
+}
+
+// snapshotIDs lists the IDs of the bucket's snapshots, oldest first.
+func snapshotIDs(ctx context.Context, c *S3Client, prefix string) ([]string, error) {
+	var ids []string
+	err := c.ListObjects(ctx, prefix+SnapshotPrefix, func(obj ObjectInfo) error {
+		id := strings.TrimPrefix(obj.Key, prefix+SnapshotPrefix)
+		if _, err := time.Parse(snapshotIDFormat, id); err == nil {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// retainedSnapshots returns which of ids, oldest first, to keep: the newest
+// snapshot of each of the last keepDaily days and of each of the last
+// keepWeekly weeks. The newest snapshot is always kept.
+func retainedSnapshots(ids []string, keepDaily, keepWeekly int) map[string]bool {
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for i := len(ids) - 1; i >= 0; i-- {
+		created, _ := time.Parse(snapshotIDFormat, ids[i])
+		created = created.Local()
+		day := created.Format("2006-01-02")
+		year, week := created.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+
+		if i == len(ids)-1 {
+			keep[ids[i]] = true
+		}
+		if !days[day] && len(days) < keepDaily {
+			keep[ids[i]] = true
+		}
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			keep[ids[i]] = true
+		}
+		days[day] = true
+		weeks[weekKey] = true
+	}
+	return keep
+}
+
+// expireSnapshots deletes the manifests the retention doesn't keep, then the
+// data objects no remaining manifest references. Nothing is deleted if a
+// kept manifest can't be read, since the objects it needs would be unknown.
+func expireSnapshots(ctx context.Context, c *S3Client, prefix string, keys *Keyring, keepDaily, keepWeekly int, result *SyncResult) error {
+	ids, err := snapshotIDs(ctx, c, prefix)
+	if err != nil {
+		return err
+	}
+	keep := retainedSnapshots(ids, keepDaily, keepWeekly)
+	referenced := make(map[string]bool)
+	for _, id := range ids {
+		if !keep[id] {
+			continue
+		}
+		m, err := FetchManifest(ctx, c, prefix, id, keys)
+		if err != nil {
+			return err
+		}
+		for _, f := range m.Files {
+			referenced[f.Object] = true
+		}
+	}
+
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		if err := c.DeleteObject(ctx, prefix+SnapshotPrefix+id); err != nil {
+			return err
+		}
+		result.SnapshotsRemoved++
+	}
+
+	cutoff := time.Now().Add(-gcGrace)
+	var garbage []ObjectInfo
+	err = c.ListObjects(ctx, prefix+DataPrefix, func(obj ObjectInfo) error {
+		if !referenced[strings.TrimPrefix(obj.Key, prefix+DataPrefix)] && obj.LastModified.Before(cutoff) {
+			garbage = append(garbage, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, obj := range garbage {
+		if err := c.DeleteObject(ctx, obj.Key); err != nil {
+			return err
+		}
+		result.ObjectsRemoved++
+		result.BytesRemoved += obj.Size
+	}
+	return nil
+}
+
+// FetchManifest downloads and decrypts a snapshot's manifest. An id of
+// "latest" or "" picks the newest snapshot.
+func FetchManifest(ctx context.Context, c *S3Client, prefix, id string, keys *Keyring) (*Manifest, error) {
+	if id == "" || id == "latest" {
+		ids, err := snapshotIDs(ctx, c, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("the bucket holds no snapshots")
+		}
+		id = ids[len(ids)-1]
+	}
+
+	body, _, err := c.GetObject(ctx, prefix+SnapshotPrefix+id)
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("no snapshot %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var raw bytes.Buffer
+	if _, err := Decrypt(&raw, body, keys); err != nil {
+		return nil, fmt.Errorf("failed to decrypt manifest %s: %w", id, err)
+	}
+	zr, err := gzip.NewReader(&raw)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.NewDecoder(zr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", id, err)
+	}
+	return &m, nil
+}
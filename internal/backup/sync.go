@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExclude lists files that are never backed up: logs, derived data
+// that is regenerated on demand, the backup keys and state themselves, and
+// SQLite's -wal and -shm files, which are only consistent with the live
+// database.
+var DefaultExclude = []string{"*.log", "logs/**", ".venv/**", "thumbnails/**", "backup/**", "*.pid", "*.tmp", "*.db-wal", "*.db-shm", "compact.lock"}
+
+// DataPrefix is where encrypted objects are stored, relative to the backup
+// prefix.
+const DataPrefix = "data/"
+
+// SyncOptions controls Sync and Target.Backup. S3Target sets Prefix and
+// Keys itself; LocalTarget only uses Exclude, Replace and Progress.
+type SyncOptions struct {
+	// Prefix is prepended to every remote key, e.g. "memento/"
+	Prefix string
+	// Exclude holds patterns matched against slash-separated relative paths:
+	// "dir/**" excludes a directory, other patterns match the base name or
+	// the whole path.
+	Exclude []string
+	// Keys encrypts uploads with its primary key
+	Keys *Keyring
+	// StatePath records what has been uploaded, so unchanged files are
+	// skipped without reading them
+	StatePath string
+	// Replace maps relative paths to files uploaded in their place, such as
+	// a consistent snapshot of a database that is open for writing
+	Replace     map[string]string
+	Concurrency int
+	// Progress, if set, is called after each uploaded file
+	Progress func(rel string, size int64)
+}
+
+// SyncResult summarizes a Sync run.
+type SyncResult struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Snapshot is the ID of the snapshot written, if the run succeeded
+	Snapshot      string `json:"snapshot,omitempty"`
+	Files         int    `json:"files"`
+	Uploaded      int    `json:"uploaded"`
+	Skipped       int    `json:"skipped"`
+	BytesUploaded int64  `json:"bytes_uploaded"`
+	// PlaintextRemoved counts unencrypted objects from older backups that
+	// were replaced by encrypted ones
+	PlaintextRemoved int `json:"plaintext_removed,omitempty"`
+	// SnapshotsRemoved counts snapshots the retention no longer keeps;
+	// ObjectsRemoved and BytesRemoved the stored files only they referenced
+	SnapshotsRemoved int      `json:"snapshots_removed,omitempty"`
+	ObjectsRemoved   int      `json:"objects_removed,omitempty"`
+	BytesRemoved     int64    `json:"bytes_removed,omitempty"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// syncState maps relative paths to what was last uploaded for them.
+type syncState map[string]uploadRecord
+
+type uploadRecord struct {
+	SHA256  string    `json:"sha256"`
+	Object  string    `json:"object"`
+	KeyID   string    `json:"key_id"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+func loadState(path string) syncState {
+	state := make(syncState)
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func (s syncState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type localFile struct {
+	rel  string
+	path string
+	info fs.FileInfo
+}
+
+// Sync writes a snapshot of dir: files whose content isn't in the bucket yet
+// are encrypted and uploaded, then a manifest listing every file is stored.
+// Unchanged files are recognized by size and modification time without
+// reading them. Nothing remote is overwritten, so earlier snapshots stay
+// restorable whatever happens to the local files. Sync keeps every snapshot;
+// S3Target.Backup applies the retention.
+func Sync(ctx context.Context, c *S3Client, dir string, opts SyncOptions) (*SyncResult, error) {
+	result := &SyncResult{Started: time.Now()}
+	defer func() { result.Duration = time.Since(result.Started) }()
+	if opts.Keys == nil {
+		return result, fmt.Errorf("no encryption keys")
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	remote := make(map[string]bool)
+	var plaintext []string
+	hasKeyring := false
+	err := c.ListObjects(ctx, opts.Prefix, func(obj ObjectInfo) error {
+		switch name := strings.TrimPrefix(obj.Key, opts.Prefix); {
+		case name == KeyringObject:
+			hasKeyring = true
+		case strings.HasPrefix(name, DataPrefix):
+			remote[strings.TrimPrefix(name, DataPrefix)] = true
+		case strings.HasPrefix(name, SnapshotPrefix):
+		default:
+			plaintext = append(plaintext, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	// Without the sealed keyring nothing uploaded could be restored elsewhere
+	if !hasKeyring {
+		return result, fmt.Errorf("%s%s is missing from the bucket", opts.Prefix, KeyringObject)
+	}
+
+	local, err := scanFiles(dir, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Files = len(local)
+
+	state := loadState(opts.StatePath)
+	primary := opts.Keys.Primary()
+	manifest := &Manifest{ID: result.Started.UTC().Format(snapshotIDFormat), Created: result.Started}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	files := make(chan localFile)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				mu.Lock()
+				record, ok := state[f.rel]
+				unchanged := ok && record.SHA256 != "" && record.KeyID == primary.ID && record.Size == f.info.Size() &&
+					record.ModTime.Equal(f.info.ModTime()) && remote[record.Object]
+				if unchanged {
+					result.Skipped++
+					manifest.Files = append(manifest.Files, record.entry(f.rel))
+				}
+				mu.Unlock()
+				if unchanged {
+					continue
+				}
+
+				record, uploaded, err := storeFile(ctx, c, opts.Prefix, f, primary, remote, &mu)
+				mu.Lock()
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.rel, err))
+				} else {
+					state[f.rel] = record
+					manifest.Files = append(manifest.Files, record.entry(f.rel))
+					if uploaded {
+						result.Uploaded++
+						result.BytesUploaded += record.Size
+						if opts.Progress != nil {
+							opts.Progress(f.rel, record.Size)
+						}
+					} else {
+						result.Skipped++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range local {
+		if ctx.Err() != nil {
+			break
+		}
+		files <- f
+	}
+	close(files)
+	wg.Wait()
+
+	if err := state.save(opts.StatePath); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to save backup state: %v", err))
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d of %d files failed to upload", len(result.Errors), len(local))
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	if err := putManifest(ctx, c, opts.Prefix, manifest, primary); err != nil {
+		return result, fmt.Errorf("failed to store manifest: %w", err)
+	}
+	result.Snapshot = manifest.ID
+
+	// Plaintext objects from before encryption are removed once the file
+	// they hold is safely stored encrypted
+	for _, rel := range plaintext {
+		if _, ok := state[rel]; !ok {
+			continue
+		}
+		if err := c.DeleteObject(ctx, opts.Prefix+rel); err != nil {
+			return result, err
+		}
+		result.PlaintextRemoved++
+	}
+	return result, nil
+}
+
+// scanFiles lists the files under dir to back up, applying opts.Exclude
+// and opts.Replace.
+func scanFiles(dir string, opts SyncOptions) ([]localFile, error) {
+	var local []localFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if Excluded(rel, d.IsDir(), opts.Exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if replacement, ok := opts.Replace[rel]; ok {
+			p = replacement
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		local = append(local, localFile{rel: rel, path: p, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	return local, nil
+}
+
+func (r uploadRecord) entry(rel string) ManifestEntry {
+	return ManifestEntry{Path: rel, Size: r.Size, ModTime: r.ModTime, SHA256: r.SHA256, Object: r.Object}
+}
+
+// storeFile encrypts f to a temporary file, hashing it on the way, and
+// uploads it unless an object with the same content exists. Objects are
+// named by the keyed hash of their content.
+func storeFile(ctx context.Context, c *S3Client, prefix string, f localFile, k Key, remote map[string]bool, mu *sync.Mutex) (uploadRecord, bool, error) {
+	record := uploadRecord{KeyID: k.ID, Size: f.info.Size(), ModTime: f.info.ModTime()}
+	src, err := os.Open(f.path)
+	if err != nil {
+		return record, false, err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "memento-backup-*")
+	if err != nil {
+		return record, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Only the size seen when scanning is read, so a file that is appended
+	// to meanwhile is stored as it was
+	h := sha256.New()
+	counter := &countingWriter{}
+	content := io.TeeReader(io.LimitReader(src, record.Size), io.MultiWriter(h, counter))
+	meta := FileMeta{Path: f.rel, Size: record.Size, ModTime: record.ModTime}
+	w := bufio.NewWriter(tmp)
+	if err := Encrypt(w, content, k, meta); err != nil {
+		return record, false, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return record, false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return record, false, err
+	}
+	if counter.n != record.Size {
+		return record, false, fmt.Errorf("file shrank while it was read")
+	}
+	record.SHA256 = hex.EncodeToString(h.Sum(nil))
+	record.Object = k.ObjectName(record.SHA256)
+
+	// Claimed before uploading so identical files uploaded concurrently are
+	// stored once. If the upload fails the run writes no manifest.
+	mu.Lock()
+	exists := remote[record.Object]
+	remote[record.Object] = true
+	mu.Unlock()
+	if exists {
+		return record, false, nil
+	}
+	if _, err := c.UploadFile(ctx, prefix+DataPrefix+record.Object, tmp.Name(), nil); err != nil {
+		return record, false, err
+	}
+	return record, true, nil
+}
+
+// Excluded reports whether rel (slash-separated, relative to the storage
+// directory) matches one of patterns.
+func Excluded(rel string, isDir bool, patterns []string) bool {
+	for _, pattern := range patterns {
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if rel == dir || strings.HasPrefix(rel, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if isDir {
+			continue
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
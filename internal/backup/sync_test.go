@@ -0,0 +1,347 @@
+package backup
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPrefix = "memento/"
+
+// newSyncTarget returns a bucket set up for Sync, with a keyring object, and
+// the options to sync into it.
+func newSyncTarget(t *testing.T) (*fakeS3, *S3Target, SyncOptions) {
+	t.Helper()
+	f, c := newFakeS3(t)
+	keys, err := NewKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.objects[testPrefix+KeyringObject] = fakeObject{data: []byte("{}")}
+	target := &S3Target{Client: c, Prefix: testPrefix, Keys: keys}
+	opts := SyncOptions{
+		Prefix:    testPrefix,
+		Keys:      keys,
+		Exclude:   DefaultExclude,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+	}
+	return f, target, opts
+}
+
+// writeFiles creates files under dir, with their parent directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncSkipsUnchangedFiles(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"memento.db":                           "database",
+		"screenshots/2026/01/15/10-00-00.webp": "image one",
+		"screenshots/2026/01/15/10-01-00.webp": "image two",
+		"thumbnails/2026/01/15/10-00-00.webp":  "excluded",
+		"memento.log":                          "excluded",
+	})
+
+	result, err := Sync(ctx, target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 3 || result.Uploaded != 3 || result.Skipped != 0 {
+		t.Errorf("first run: %d files, %d uploaded, %d skipped; want 3, 3, 0", result.Files, result.Uploaded, result.Skipped)
+	}
+	if n := len(f.keys(testPrefix + DataPrefix)); n != 3 {
+		t.Errorf("%d data objects, want 3", n)
+	}
+
+	puts := f.count("PUT " + testPrefix + DataPrefix)
+	result, err = Sync(ctx, target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 0 || result.Skipped != 3 {
+		t.Errorf("second run: %d uploaded, %d skipped; want 0, 3", result.Uploaded, result.Skipped)
+	}
+	if n := f.count("PUT " + testPrefix + DataPrefix); n != puts {
+		t.Errorf("second run uploaded %d objects", n-puts)
+	}
+
+	// A changed file is uploaded again; the others are still skipped
+	writeFiles(t, dir, map[string]string{"memento.db": "database, changed"})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "memento.db"), later, later)
+	result, err = Sync(ctx, target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || result.Skipped != 2 {
+		t.Errorf("after a change: %d uploaded, %d skipped; want 1, 2", result.Uploaded, result.Skipped)
+	}
+
+	m, err := target.Manifest(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 3 {
+		t.Fatalf("manifest lists %d files, want 3", len(m.Files))
+	}
+	restored := t.TempDir()
+	if _, err := target.Restore(ctx, m, restored, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range m.Files {
+		want, _ := os.ReadFile(filepath.Join(dir, entry.Path))
+		got, err := os.ReadFile(filepath.Join(restored, entry.Path))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("restored %s = %q, %v; want %q", entry.Path, got, err, want)
+		}
+	}
+}
+
+func TestSyncDeduplicatesContent(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.webp":     "same content",
+		"b.webp":     "same content",
+		"sub/c.webp": "same content",
+		"d.webp":     "other content",
+	})
+
+	result, err := Sync(ctx, target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 2 || result.Skipped != 2 {
+		t.Errorf("%d uploaded, %d skipped; want 2, 2", result.Uploaded, result.Skipped)
+	}
+	if n := len(f.keys(testPrefix + DataPrefix)); n != 2 {
+		t.Errorf("%d data objects, want 2", n)
+	}
+
+	// A new file whose content is already stored isn't uploaded either
+	writeFiles(t, dir, map[string]string{"e.webp": "other content"})
+	result, err = Sync(ctx, target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 0 || result.Skipped != 5 {
+		t.Errorf("%d uploaded, %d skipped; want 0, 5", result.Uploaded, result.Skipped)
+	}
+
+	m, err := target.Manifest(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make(map[string]bool)
+	for _, entry := range m.Files {
+		objects[entry.Object] = true
+	}
+	if len(m.Files) != 5 || len(objects) != 2 {
+		t.Errorf("manifest lists %d files in %d objects, want 5 in 2", len(m.Files), len(objects))
+	}
+}
+
+func TestSyncRemovesPlaintextObjects(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"memento.db": "database"})
+	// Left by a backup from before encryption
+	f.objects[testPrefix+"memento.db"] = fakeObject{data: []byte("database")}
+
+	result, err := Sync(context.Background(), target.Client, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PlaintextRemoved != 1 {
+		t.Errorf("removed %d plaintext objects, want 1", result.PlaintextRemoved)
+	}
+	if _, ok := f.objects[testPrefix+"memento.db"]; ok {
+		t.Error("plaintext object is still there")
+	}
+}
+
+func TestSyncFailureWritesNoManifest(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "one", "b": "two"})
+	f.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/"+DataPrefix) {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+
+	if _, err := Sync(context.Background(), target.Client, dir, opts); err == nil {
+		t.Fatal("Sync succeeded")
+	}
+	if keys := f.keys(testPrefix + SnapshotPrefix); len(keys) != 0 {
+		t.Errorf("snapshots written: %v", keys)
+	}
+}
+
+func TestSyncRequiresKeyring(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	delete(f.objects, testPrefix+KeyringObject)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "one"})
+
+	if _, err := Sync(context.Background(), target.Client, dir, opts); err == nil || !strings.Contains(err.Error(), KeyringObject) {
+		t.Fatalf("Sync = %v, want an error about the missing keyring", err)
+	}
+	if n := f.count("PUT "); n != 0 {
+		t.Errorf("%d objects uploaded without a keyring", n)
+	}
+}
+
+// age moves the bucket's only snapshot back by d and makes every object
+// look uploaded that long ago.
+func age(t *testing.T, f *fakeS3, d time.Duration) {
+	t.Helper()
+	snapshots := f.keys(testPrefix + SnapshotPrefix)
+	if len(snapshots) != 1 {
+		t.Fatalf("%d snapshots, want 1", len(snapshots))
+	}
+	created, err := time.Parse(snapshotIDFormat, strings.TrimPrefix(snapshots[0], testPrefix+SnapshotPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.objects[testPrefix+SnapshotPrefix+created.Add(-d).Format(snapshotIDFormat)] = f.objects[snapshots[0]]
+	delete(f.objects, snapshots[0])
+	for key, obj := range f.objects {
+		obj.modified = obj.modified.Add(-d)
+		f.objects[key] = obj
+	}
+}
+
+func TestBackupExpiresSnapshots(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	target.KeepDaily = 1
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "kept", "b": "replaced"})
+	if _, err := target.Backup(ctx, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	age(t, f, 72*time.Hour)
+
+	// Left by a backup still uploading elsewhere
+	f.objects[testPrefix+DataPrefix+"in-progress"] = fakeObject{data: []byte("new"), modified: time.Now()}
+
+	writeFiles(t, dir, map[string]string{"b": "replacement"})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "b"), later, later)
+	result, err := target.Backup(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SnapshotsRemoved != 1 || result.ObjectsRemoved != 1 {
+		t.Errorf("removed %d snapshots and %d objects, want 1 and 1", result.SnapshotsRemoved, result.ObjectsRemoved)
+	}
+	if snapshots := f.keys(testPrefix + SnapshotPrefix); len(snapshots) != 1 || snapshots[0] != testPrefix+SnapshotPrefix+result.Snapshot {
+		t.Errorf("snapshots = %v, want only %s", snapshots, result.Snapshot)
+	}
+	if _, ok := f.objects[testPrefix+DataPrefix+"in-progress"]; !ok {
+		t.Error("a recent unreferenced object was deleted")
+	}
+
+	m, err := target.Manifest(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := t.TempDir()
+	if _, err := target.Restore(ctx, m, restored, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a": "kept", "b": "replacement"} {
+		if got, err := os.ReadFile(filepath.Join(restored, name)); err != nil || string(got) != want {
+			t.Errorf("restored %s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestBackupKeepsObjectsWhenManifestUnreadable(t *testing.T) {
+	f, target, opts := newSyncTarget(t)
+	target.KeepDaily = 2
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "one"})
+	if _, err := target.Backup(ctx, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	age(t, f, 24*time.Hour)
+	old := f.keys(testPrefix + SnapshotPrefix)[0]
+	f.objects[old] = fakeObject{data: []byte("corrupt")}
+
+	writeFiles(t, dir, map[string]string{"a": "two"})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "a"), later, later)
+	if _, err := target.Backup(ctx, dir, opts); err == nil {
+		t.Fatal("Backup succeeded with an unreadable manifest")
+	}
+	if n := len(f.keys(testPrefix + DataPrefix)); n != 2 {
+		t.Errorf("%d data objects left, want 2", n)
+	}
+}
+
+func TestRetainedSnapshots(t *testing.T) {
+	id := func(s string) string {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.UTC().Format(snapshotIDFormat)
+	}
+	// 2026-03-02 is a Monday
+	ids := []string{
+		id("2026-02-20 09:00"),
+		id("2026-02-23 09:00"),
+		id("2026-02-27 09:00"),
+		id("2026-03-02 09:00"),
+		id("2026-03-03 09:00"),
+		id("2026-03-03 18:00"),
+		id("2026-03-04 09:00"),
+		id("2026-03-04 18:00"),
+	}
+	tests := []struct {
+		daily, weekly int
+		want          []string
+	}{
+		{0, 0, []string{id("2026-03-04 18:00")}},
+		{2, 0, []string{id("2026-03-03 18:00"), id("2026-03-04 18:00")}},
+		{0, 2, []string{id("2026-02-27 09:00"), id("2026-03-04 18:00")}},
+		{1, 3, []string{id("2026-02-20 09:00"), id("2026-02-27 09:00"), id("2026-03-04 18:00")}},
+		{10, 10, []string{
+			id("2026-02-20 09:00"), id("2026-02-23 09:00"), id("2026-02-27 09:00"),
+			id("2026-03-02 09:00"), id("2026-03-03 18:00"), id("2026-03-04 18:00"),
+		}},
+	}
+	for _, tt := range tests {
+		keep := retainedSnapshots(ids, tt.daily, tt.weekly)
+		var got []string
+		for _, id := range ids {
+			if keep[id] {
+				got = append(got, id)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("daily %d, weekly %d: kept %v, want %v", tt.daily, tt.weekly, got, tt.want)
+		}
+	}
+}
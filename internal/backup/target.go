@@ -0,0 +1,289 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Target is where snapshots are stored: an S3-compatible bucket or a
+// directory on a local or external drive.
+type Target interface {
+	// String describes the destination, e.g. "s3://bucket/memento/"
+	String() string
+	// Backup writes a snapshot of dir
+	Backup(ctx context.Context, dir string, opts SyncOptions) (*SyncResult, error)
+	// Snapshots lists the snapshots, oldest first
+	Snapshots(ctx context.Context) ([]SnapshotInfo, error)
+	// Manifest returns a snapshot's file list; "latest" picks the newest
+	Manifest(ctx context.Context, id string) (*Manifest, error)
+	// Restore copies a snapshot's files into dir
+	Restore(ctx context.Context, m *Manifest, dir string, opts RestoreOptions) (*RestoreResult, error)
+	// Verify checks that the latest snapshot is complete and reads back a
+	// sample of its files (all of them if sample is 0)
+	Verify(ctx context.Context, sample int) (*VerifyResult, error)
+}
+
+// S3Target stores encrypted, content-addressed snapshots in a bucket.
+// Keys is needed for everything but listing snapshots.
+//
+// After each backup, snapshots are rotated as for LocalTarget, and the data
+// objects only removed snapshots referenced are deleted.
+type S3Target struct {
+	Client     *S3Client
+	Prefix     string
+	Keys       *Keyring
+	KeepDaily  int
+	KeepWeekly int
+}
+
+func (t *S3Target) String() string {
+	return fmt.Sprintf("s3://%s/%s", t.Client.Bucket(), t.Prefix)
+}
+
+// Backup encrypts and uploads dir, then expires old snapshots; see Sync.
+func (t *S3Target) Backup(ctx context.Context, dir string, opts SyncOptions) (*SyncResult, error) {
+	opts.Prefix = t.Prefix
+	opts.Keys = t.Keys
+	result, err := Sync(ctx, t.Client, dir, opts)
+	if err != nil {
+		return result, err
+	}
+	if err := expireSnapshots(ctx, t.Client, t.Prefix, t.Keys, t.KeepDaily, t.KeepWeekly, result); err != nil {
+		return result, fmt.Errorf("failed to remove old snapshots: %w", err)
+	}
+	return result, nil
+}
+
+func (t *S3Target) Snapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	return ListSnapshots(ctx, t.Client, t.Prefix)
+}
+
+func (t *S3Target) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	return FetchManifest(ctx, t.Client, t.Prefix, id, t.Keys)
+}
+
+func (t *S3Target) Restore(ctx context.Context, m *Manifest, dir string, opts RestoreOptions) (*RestoreResult, error) {
+	return restoreFiles(ctx, m, dir, opts, t.fetch)
+}
+
+// Verify also checks that every object the latest snapshot references
+// exists, and that each sampled object is stored under the keyed hash of
+// its content, so swapped objects are caught.
+func (t *S3Target) Verify(ctx context.Context, sample int) (*VerifyResult, error) {
+	m, err := t.Manifest(ctx, "latest")
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool)
+	err = t.Client.ListObjects(ctx, t.Prefix+DataPrefix, func(obj ObjectInfo) error {
+		stored[strings.TrimPrefix(obj.Key, t.Prefix+DataPrefix)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists := func(f ManifestEntry) bool { return stored[f.Object] }
+	return verifyFiles(ctx, m, sample, exists, t.fetch), ctx.Err()
+}
+
+// fetch writes the decrypted content of f's object to w.
+func (t *S3Target) fetch(ctx context.Context, f ManifestEntry, w io.Writer) error {
+	body, _, err := t.Client.GetObject(ctx, t.Prefix+DataPrefix+f.Object)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	meta, err := Decrypt(w, body, t.Keys)
+	if err != nil {
+		return err
+	}
+	key, _ := t.Keys.Get(meta.KeyID)
+	if key.ObjectName(f.SHA256) != f.Object {
+		return fmt.Errorf("object %s holds content that belongs under another name", f.Object)
+	}
+	return nil
+}
+
+// fetchFunc writes the content of a snapshot file to w.
+type fetchFunc func(ctx context.Context, f ManifestEntry, w io.Writer) error
+
+// RestoreOptions controls Restore.
+type RestoreOptions struct {
+	// Filter, if set, selects the files to restore
+	Filter      func(ManifestEntry) bool
+	Concurrency int
+	// Progress, if set, is called after each restored file
+	Progress func(path string, size int64)
+}
+
+// RestoreResult summarizes a Restore run.
+type RestoreResult struct {
+	Snapshot string   `json:"snapshot"`
+	Files    int      `json:"files"`
+	Bytes    int64    `json:"bytes"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// restoreFiles fetches the snapshot's files into dir, checking each file's
+// hash, and restores their modification times.
+func restoreFiles(ctx context.Context, m *Manifest, dir string, opts RestoreOptions, fetch fetchFunc) (*RestoreResult, error) {
+	result := &RestoreResult{Snapshot: m.ID}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	files := make(chan ManifestEntry)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				err := restoreFile(ctx, f, dir, fetch)
+				mu.Lock()
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.Path, err))
+				} else {
+					result.Files++
+					result.Bytes += f.Size
+					if opts.Progress != nil {
+						opts.Progress(f.Path, f.Size)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range m.Files {
+		if ctx.Err() != nil {
+			break
+		}
+		if opts.Filter != nil && !opts.Filter(f) {
+			continue
+		}
+		files <- f
+	}
+	close(files)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d files failed to restore", len(result.Errors))
+	}
+	return result, nil
+}
+
+func restoreFile(ctx context.Context, f ManifestEntry, dir string, fetch fetchFunc) error {
+	dst := filepath.Join(dir, filepath.FromSlash(f.Path))
+	if !strings.HasPrefix(dst, filepath.Clean(dir)+string(filepath.Separator)) {
+		return fmt.Errorf("path escapes the restore directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if err := fetch(ctx, f, io.MultiWriter(tmp, h)); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("content doesn't match the manifest")
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, f.ModTime, f.ModTime)
+}
+
+// VerifyResult summarizes a Verify run.
+type VerifyResult struct {
+	Snapshot string `json:"snapshot"`
+	// Objects counts the distinct stored files the snapshot references
+	Objects  int      `json:"objects"`
+	Checked  int      `json:"checked"`
+	Bytes    int64    `json:"bytes"`
+	Files    []string `json:"files"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// verifyFiles checks that every file of m is stored and that a random
+// sample of them reads back with the size and hash the manifest records.
+func verifyFiles(ctx context.Context, m *Manifest, sample int, exists func(ManifestEntry) bool, fetch fetchFunc) *VerifyResult {
+	result := &VerifyResult{Snapshot: m.ID}
+	var entries []ManifestEntry
+	seen := make(map[string]bool)
+	for _, f := range m.Files {
+		if !exists(f) {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: missing", f.Path))
+			continue
+		}
+		// Content-addressed objects shared by several files are read once
+		id := f.Object
+		if id == "" {
+			id = f.Path
+		}
+		if !seen[id] {
+			seen[id] = true
+			entries = append(entries, f)
+		}
+	}
+	result.Objects = len(seen)
+
+	rand.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	if sample > 0 && sample < len(entries) {
+		entries = entries[:sample]
+	}
+
+	for _, f := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		result.Checked++
+		h := sha256.New()
+		counter := &countingWriter{}
+		if err := fetch(ctx, f, io.MultiWriter(h, counter)); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", f.Path, err))
+			continue
+		}
+		if hex.EncodeToString(h.Sum(nil)) != f.SHA256 || counter.n != f.Size {
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: content doesn't match the manifest", f.Path))
+			continue
+		}
+		result.Bytes += f.Size
+		result.Files = append(result.Files, f.Path)
+	}
+	return result
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,46 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IdleTime reports how long it has been since the last keyboard or mouse
+// input, as tracked by the HID system.
+func IdleTime() (time.Duration, error) {
+	cmd := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4")
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, `"HIDIdleTime"`) {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ns, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse HIDIdleTime: %w", err)
+		}
+		return time.Duration(ns), nil
+	}
+	return 0, fmt.Errorf("HIDIdleTime not found")
+}
+
+// IsScreenLocked reports whether the login session's screen is locked.
+func IsScreenLocked() (bool, error) {
+	cmd := exec.Command("ioreg", "-n", "Root", "-d", "1")
+	output, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(output, []byte(`"CGSSessionScreenIsLocked"=Yes`)), nil
+}
@@ -0,0 +1,127 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Display describes a connected monitor. Geometry is in points in the global
+// screen space used by window positions: origin at the top-left corner of the
+// main display, y growing downwards.
+type Display struct {
+	ID     uint32 `json:"id"`
+	Index  int    `json:"index"` // 1-based, as used by screencapture -D
+	Name   string `json:"name"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Main   bool   `json:"main"`
+}
+
+// Rect is a rectangle in global screen coordinates (points).
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (d Display) Contains(x, y int) bool {
+	return x >= d.X && x < d.X+d.Width && y >= d.Y && y < d.Y+d.Height
+}
+
+// GetDisplays lists connected displays, main display first.
+func GetDisplays() ([]Display, error) {
+	// NSScreen reports frames with a bottom-left origin; flip them using the
+	// main screen's height so they line up with System Events coordinates.
+	script := `
+		ObjC.import('AppKit');
+		var screens = $.NSScreen.screens;
+		var mainHeight = screens.objectAtIndex(0).frame.size.height;
+		var out = [];
+		for (var i = 0; i < screens.count; i++) {
+			var s = screens.objectAtIndex(i);
+			var f = s.frame;
+			var name = s.respondsToSelector('localizedName') ? ObjC.unwrap(s.localizedName) : '';
+			out.push({
+				id: ObjC.unwrap(s.deviceDescription.objectForKey('NSScreenNumber')),
+				index: i + 1,
+				name: name,
+				x: Math.round(f.origin.x),
+				y: Math.round(mainHeight - f.origin.y - f.size.height),
+				width: Math.round(f.size.width),
+				height: Math.round(f.size.height),
+				main: i === 0
+			});
+		}
+		JSON.stringify(out);
+	`
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", script)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list displays: %w", err)
+	}
+
+	var displays []Display
+	if err := json.Unmarshal(output, &displays); err != nil {
+		return nil, fmt.Errorf("failed to parse display list: %w", err)
+	}
+	return displays, nil
+}
+
+// GetActiveWindowBounds returns the frontmost window's position and size.
+func GetActiveWindowBounds() (*Rect, error) {
+	script := `
+		tell application "System Events"
+			set frontApp to first application process whose frontmost is true
+			tell first window of frontApp
+				set {x, y} to position
+				set {w, h} to size
+			end tell
+			return (x as text) & "," & (y as text) & "," & (w as text) & "," & (h as text)
+		end tell
+	`
+	cmd := exec.Command("osascript", "-e", script)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(output)), ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("unexpected window bounds %q", strings.TrimSpace(string(output)))
+	}
+	var values [4]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected window bounds %q", strings.TrimSpace(string(output)))
+		}
+		values[i] = v
+	}
+	return &Rect{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
+
+// displayFor picks the display that holds the centre of bounds, falling back
+// to the main display.
+func displayFor(displays []Display, bounds *Rect) int {
+	if bounds != nil {
+		cx := bounds.X + bounds.Width/2
+		cy := bounds.Y + bounds.Height/2
+		for i, d := range displays {
+			if d.Contains(cx, cy) {
+				return i
+			}
+		}
+	}
+	for i, d := range displays {
+		if d.Main {
+			return i
+		}
+	}
+	return 0
+}
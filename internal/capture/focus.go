@@ -0,0 +1,188 @@
+package capture
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WindowProvider reports changes of the frontmost app and window.
+type WindowProvider interface {
+	// Watch calls onChange with the initial active window and then whenever it
+	// changes, until ctx is done.
+	Watch(ctx context.Context, onChange func(cur *WindowInfo))
+}
+
+// PollingWindowProvider asks System Events for the frontmost window every
+// Interval.
+type PollingWindowProvider struct {
+	Interval time.Duration
+}
+
+func (p *PollingWindowProvider) Watch(ctx context.Context, onChange func(cur *WindowInfo)) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *WindowInfo
+	poll := func() {
+		cur, err := GetActiveWindow()
+		if err != nil {
+			return
+		}
+		if prev == nil || cur.App != prev.App || cur.Title != prev.Title {
+			prev = cur
+			onChange(cur)
+		}
+	}
+
+	poll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
+
+// FocusEvent is a span of time during which one window had focus.
+type FocusEvent struct {
+	App   string
+	Title string
+	Start time.Time
+	End   time.Time
+}
+
+func (e FocusEvent) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// FocusTracker turns window changes into focus events. While the user is idle
+// or the screen is locked no window counts as focused, so those stretches are
+// left out of the log.
+type FocusTracker struct {
+	provider    WindowProvider
+	idleTimeout time.Duration
+	onEvent     func(FocusEvent)
+
+	// OnSwitch, if set, is called when focus moves from one window to another.
+	OnSwitch func(prev, cur *WindowInfo)
+
+	mu      sync.Mutex
+	current *FocusEvent
+	window  *WindowInfo
+	paused  bool
+}
+
+// NewFocusTracker creates a tracker that calls onEvent with each finished
+// focus event. An idleTimeout of zero disables idle detection.
+func NewFocusTracker(provider WindowProvider, idleTimeout time.Duration, onEvent func(FocusEvent)) *FocusTracker {
+	return &FocusTracker{
+		provider:    provider,
+		idleTimeout: idleTimeout,
+		onEvent:     onEvent,
+	}
+}
+
+// Run tracks focus until ctx is done, then ends the current event.
+func (t *FocusTracker) Run(ctx context.Context) {
+	go t.provider.Watch(ctx, t.switchTo)
+
+	activity := time.NewTicker(activityCheckInterval)
+	defer activity.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.end(time.Now())
+			return
+		case <-activity.C:
+			t.checkActivity()
+		}
+	}
+}
+
+// Current returns the event in progress, if any.
+func (t *FocusTracker) Current() *FocusEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return nil
+	}
+	e := *t.current
+	e.End = time.Now()
+	return &e
+}
+
+func (t *FocusTracker) switchTo(cur *WindowInfo) {
+	t.mu.Lock()
+	prev := t.window
+	t.window = cur
+	paused := t.paused
+	t.mu.Unlock()
+
+	now := time.Now()
+	t.end(now)
+	if !paused {
+		t.begin(cur, now)
+	}
+	if prev != nil && t.OnSwitch != nil {
+		t.OnSwitch(prev, cur)
+	}
+}
+
+func (t *FocusTracker) checkActivity() {
+	inactive := false
+	var idle time.Duration
+	if locked, err := IsScreenLocked(); err == nil && locked {
+		inactive = true
+	} else if t.idleTimeout > 0 {
+		if d, err := IdleTime(); err == nil && d >= t.idleTimeout {
+			inactive = true
+			idle = d
+		}
+	}
+
+	t.mu.Lock()
+	wasPaused := t.paused
+	t.paused = inactive
+	window := t.window
+	t.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case inactive && !wasPaused:
+		// The user left when input stopped, not when we noticed
+		t.end(now.Add(-idle))
+	case !inactive && wasPaused && window != nil:
+		t.begin(window, now)
+	}
+}
+
+func (t *FocusTracker) begin(w *WindowInfo, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = &FocusEvent{App: w.App, Title: w.Title, Start: at}
+}
+
+func (t *FocusTracker) end(at time.Time) {
+	t.mu.Lock()
+	e := t.current
+	t.current = nil
+	t.mu.Unlock()
+
+	if e == nil {
+		return
+	}
+	if at.Before(e.Start) {
+		at = e.Start
+	}
+	e.End = at
+	if e.Duration() > 0 && t.onEvent != nil {
+		t.onEvent(*e)
+	}
+}
@@ -0,0 +1,208 @@
+package capture
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reasons recorded with each screenshot.
+const (
+	ReasonInitial      = "initial"
+	ReasonInterval     = "interval"
+	ReasonAppSwitch    = "app_switch"
+	ReasonWindowSwitch = "window_switch"
+	ReasonTyping       = "typing"
+	ReasonResume       = "resume"
+	ReasonManual       = "manual"
+)
+
+const (
+	// Captures whose hashes differ by at most this many bits show the same screen
+	unchangedHashDistance = 4
+	activityCheckInterval = 15 * time.Second
+)
+
+type ScheduleConfig struct {
+	// Interval is the regular capture interval while the screen is changing.
+	Interval time.Duration
+	// MinInterval is the shortest gap between any two captures, including
+	// triggered ones.
+	MinInterval time.Duration
+	// MaxInterval caps how far the interval backs off on an unchanged screen.
+	MaxInterval time.Duration
+	// IdleTimeout pauses capturing after this long without input. Zero
+	// disables idle detection; a locked screen always pauses.
+	IdleTimeout time.Duration
+}
+
+// Scheduler decides when to take screenshots: on a regular interval that
+// backs off while the screen stays the same, on triggers such as window
+// switches, and never while the user is idle or the screen is locked.
+type Scheduler struct {
+	config   ScheduleConfig
+	triggers chan string
+
+	// OnPauseChange, if set, is called when capturing pauses or resumes.
+	OnPauseChange func(paused bool, why string)
+
+	mu       sync.Mutex
+	interval time.Duration
+	lastHash uint64
+	hasHash  bool
+}
+
+func NewScheduler(config ScheduleConfig) *Scheduler {
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Minute
+	}
+	if config.MinInterval <= 0 || config.MinInterval > config.Interval {
+		config.MinInterval = config.Interval
+	}
+	if config.MaxInterval < config.Interval {
+		config.MaxInterval = config.Interval
+	}
+	return &Scheduler{
+		config:   config,
+		triggers: make(chan string, 1),
+		interval: config.Interval,
+	}
+}
+
+// Trigger requests an extra capture. Triggers arriving before MinInterval has
+// passed since the last capture are coalesced into one capture at that point.
+func (s *Scheduler) Trigger(reason string) {
+	select {
+	case s.triggers <- reason:
+	default:
+	}
+}
+
+// Observe feeds the hash of a finished capture back into the scheduler. An
+// unchanged screen doubles the interval up to MaxInterval; any change resets
+// it to Interval.
+func (s *Scheduler) Observe(hash uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hash != 0 && s.hasHash && HashDistance(hash, s.lastHash) <= unchangedHashDistance {
+		s.interval *= 2
+		if s.interval > s.config.MaxInterval {
+			s.interval = s.config.MaxInterval
+		}
+	} else {
+		s.interval = s.config.Interval
+	}
+	s.lastHash = hash
+	s.hasHash = hash != 0
+}
+
+// Interval returns the current, possibly backed-off, capture interval.
+func (s *Scheduler) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+// Run calls capture with the reason for each capture until ctx is done. The
+// first capture happens immediately.
+func (s *Scheduler) Run(ctx context.Context, capture func(reason string)) {
+	var lastCapture time.Time
+	paused := false
+	pending := ""
+
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	schedule := func(at time.Time) {
+		next = at
+		timer.Reset(time.Until(at))
+	}
+
+	activity := time.NewTicker(activityCheckInterval)
+	defer activity.Stop()
+
+	setPaused := func(p bool, why string) {
+		if p == paused {
+			return
+		}
+		paused = p
+		if s.OnPauseChange != nil {
+			s.OnPauseChange(p, why)
+		}
+	}
+
+	take := func(reason string) {
+		if inactive, why := s.inactive(); inactive {
+			setPaused(true, why)
+			schedule(time.Now().Add(s.Interval()))
+			return
+		}
+		capture(reason)
+		lastCapture = time.Now()
+		pending = ""
+		schedule(lastCapture.Add(s.Interval()))
+	}
+
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-timer.C:
+			if paused {
+				schedule(time.Now().Add(s.Interval()))
+				continue
+			}
+			reason := ReasonInterval
+			if first {
+				reason = ReasonInitial
+				first = false
+			}
+			if pending != "" {
+				reason = pending
+			}
+			take(reason)
+
+		case reason := <-s.triggers:
+			if paused {
+				continue
+			}
+			earliest := lastCapture.Add(s.config.MinInterval)
+			if time.Now().Before(earliest) {
+				// Too soon after the last capture; fold into a capture at
+				// the earliest allowed moment
+				pending = reason
+				if earliest.Before(next) {
+					schedule(earliest)
+				}
+				continue
+			}
+			take(reason)
+
+		case <-activity.C:
+			inactive, why := s.inactive()
+			if inactive {
+				setPaused(true, why)
+			} else if paused {
+				setPaused(false, "")
+				take(ReasonResume)
+			}
+		}
+	}
+}
+
+// inactive reports whether captures should pause, and why. Errors from the
+// platform checks count as active so a missing tool never stops capturing.
+func (s *Scheduler) inactive() (bool, string) {
+	if locked, err := IsScreenLocked(); err == nil && locked {
+		return true, "screen locked"
+	}
+	if s.config.IdleTimeout > 0 {
+		if idle, err := IdleTime(); err == nil && idle >= s.config.IdleTimeout {
+			return true, "idle for " + idle.Round(time.Second).String()
+		}
+	}
+	return false, ""
+}
@@ -2,7 +2,12 @@ package capture
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
 	"os"
 	"os/exec"
 	"strconv"
@@ -10,41 +15,176 @@ import (
 	"time"
 )
 
+// Capture modes
+const (
+	ModeAllDisplays   = "all_displays"
+	ModeActiveDisplay = "active_display"
+	ModeActiveWindow  = "active_window"
+)
+
+var CaptureModes = []string{ModeAllDisplays, ModeActiveDisplay, ModeActiveWindow}
+
+func IsCaptureMode(mode string) bool {
+	for _, m := range CaptureModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
 type ScreenshotCapture struct {
-	quality    int
-	fullScreen bool
-	tempDir    string
+	quality   int
+	mode      string
+	tempDir   string
+	writeFile func(path string, data []byte) error
 }
 
-func NewScreenshotCapture(quality int, fullScreen bool) *ScreenshotCapture {
+func NewScreenshotCapture(quality int, mode string) *ScreenshotCapture {
 	if quality <= 0 || quality > 100 {
 		quality = 80
 	}
+	if !IsCaptureMode(mode) {
+		mode = ModeAllDisplays
+	}
 	return &ScreenshotCapture{
-		quality:    quality,
-		fullScreen: fullScreen,
-		tempDir:    os.TempDir(),
+		quality: quality,
+		mode:    mode,
+		tempDir: os.TempDir(),
+		writeFile: func(path string, data []byte) error {
+			return os.WriteFile(path, data, 0644)
+		},
 	}
 }
 
+// SetFileWriter replaces how CaptureToFile writes images, e.g. to encrypt
+// them.
+func (sc *ScreenshotCapture) SetFileWriter(write func(path string, data []byte) error) {
+	sc.writeFile = write
+}
+
+// DisplayImage is the part of a capture taken from one display.
+type DisplayImage struct {
+	Display Display
+	// Active is set on the display holding the active window.
+	Active bool
+	Data   []byte
+	Width  int
+	Height int
+	Hash   uint64
+	// Filepath is set by CaptureToFile.
+	Filepath string
+}
+
 type CaptureResult struct {
 	Timestamp time.Time
-	Data      []byte
-	Width     int
-	Height    int
+	// Data, Width and Height describe the primary image: the active window
+	// or the display holding it.
+	Data   []byte
+	Width  int
+	Height int
+	// Hash is a perceptual hash of the primary image; see HashDistance.
+	Hash uint64
+	// Displays has one entry per captured display, including the primary.
+	Displays []DisplayImage
+	// Window holds the active window's bounds, when known.
+	Window *Rect
+	// WindowID is the active window's CGWindowID, when known.
+	WindowID uint32
 }
 
 func (sc *ScreenshotCapture) Capture() (*CaptureResult, error) {
 	timestamp := time.Now()
 
-	tempPNG := fmt.Sprintf("%s/memento_temp_%d.png", sc.tempDir, timestamp.UnixNano())
-	tempWebP := fmt.Sprintf("%s/memento_temp_%d.webp", sc.tempDir, timestamp.UnixNano())
+	displays, err := GetDisplays()
+	if err != nil || len(displays) == 0 {
+		// Without display info, capture the main display only
+		displays = []Display{{Index: 1, Main: true}}
+	}
+	windowID, bounds, err := GetActiveWindowID()
+	if err != nil {
+		windowID = 0
+		bounds, _ = GetActiveWindowBounds()
+	}
+	active := displayFor(displays, bounds)
+
+	result := &CaptureResult{Timestamp: timestamp, Window: bounds, WindowID: windowID}
+
+	var targets []int
+	switch sc.mode {
+	case ModeActiveWindow:
+		if img, err := sc.captureWindow(timestamp, windowID, bounds); err == nil {
+			img.Display = displays[active]
+			img.Active = true
+			result.Displays = []DisplayImage{*img}
+			break
+		}
+		// No window to crop to; capture the display instead
+		targets = []int{active}
+	case ModeActiveDisplay:
+		targets = []int{active}
+	default:
+		for i := range displays {
+			targets = append(targets, i)
+		}
+	}
+
+	for _, i := range targets {
+		d := displays[i]
+		img, err := sc.captureImage(timestamp, fmt.Sprintf("d%d", d.Index), "-D", strconv.Itoa(d.Index))
+		if err != nil {
+			if i != active {
+				// A secondary display failing should not lose the capture
+				continue
+			}
+			return nil, err
+		}
+		img.Display = d
+		img.Active = i == active
+		result.Displays = append(result.Displays, *img)
+	}
+
+	for _, img := range result.Displays {
+		if img.Active {
+			result.Data = img.Data
+			result.Width = img.Width
+			result.Height = img.Height
+			result.Hash = img.Hash
+		}
+	}
+	return result, nil
+}
+
+// captureWindow captures just the given window. By ID, screencapture grabs
+// the window's own contents even when other windows overlap it; without one,
+// it falls back to cropping the screen to the window's bounds.
+func (sc *ScreenshotCapture) captureWindow(timestamp time.Time, windowID uint32, bounds *Rect) (*DisplayImage, error) {
+	if windowID != 0 {
+		// -o: leave out the window shadow
+		img, err := sc.captureImage(timestamp, "window", "-o", "-l", strconv.FormatUint(uint64(windowID), 10))
+		if err == nil {
+			return img, nil
+		}
+	}
+	if bounds == nil || bounds.Width <= 0 || bounds.Height <= 0 {
+		return nil, fmt.Errorf("no active window to capture")
+	}
+	rect := fmt.Sprintf("%d,%d,%d,%d", bounds.X, bounds.Y, bounds.Width, bounds.Height)
+	return sc.captureImage(timestamp, "window", "-R", rect)
+}
+
+// captureImage runs screencapture with extra args and turns the result into a
+// half-resolution WebP.
+func (sc *ScreenshotCapture) captureImage(timestamp time.Time, tag string, args ...string) (*DisplayImage, error) {
+	prefix := fmt.Sprintf("%s/memento_temp_%d_%s", sc.tempDir, timestamp.UnixNano(), tag)
+	tempPNG := prefix + ".png"
+	tempWebP := prefix + ".webp"
 	defer os.Remove(tempPNG)
 	defer os.Remove(tempWebP)
 
 	// Capture screenshot using macOS screencapture CLI
 	// -x: no sound, -C: include cursor
-	cmd := exec.Command("screencapture", "-x", "-C", tempPNG)
+	cmd := exec.Command("screencapture", append(append([]string{"-x", "-C"}, args...), tempPNG)...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		errMsg := string(output)
@@ -68,6 +208,9 @@ func (sc *ScreenshotCapture) Capture() (*CaptureResult, error) {
 		return nil, fmt.Errorf("failed to resize image: %w", err)
 	}
 
+	// A failed hash only disables change detection for this capture
+	hash, _ := screenHash(tempPNG, prefix+"_hash.png")
+
 	// Convert to WebP using cwebp CLI (much more memory efficient than Go library)
 	cmd = exec.Command("cwebp", "-q", fmt.Sprintf("%d", sc.quality), "-quiet", tempPNG, "-o", tempWebP)
 	if err := cmd.Run(); err != nil {
@@ -80,27 +223,87 @@ func (sc *ScreenshotCapture) Capture() (*CaptureResult, error) {
 		return nil, fmt.Errorf("failed to read WebP file: %w", err)
 	}
 
-	return &CaptureResult{
-		Timestamp: timestamp,
-		Data:      webpData,
-		Width:     width,
-		Height:    height,
+	return &DisplayImage{
+		Data:   webpData,
+		Width:  width,
+		Height: height,
+		Hash:   hash,
 	}, nil
 }
 
+// CaptureToFile writes the primary image to filepath and any other displays
+// next to it (see DisplayFilepath).
 func (sc *ScreenshotCapture) CaptureToFile(filepath string) (*CaptureResult, error) {
 	result, err := sc.Capture()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := os.WriteFile(filepath, result.Data, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write screenshot: %w", err)
+	for i := range result.Displays {
+		img := &result.Displays[i]
+		img.Filepath = filepath
+		if !img.Active {
+			img.Filepath = DisplayFilepath(filepath, img.Display)
+		}
+		if err := sc.writeFile(img.Filepath, img.Data); err != nil {
+			return nil, fmt.Errorf("failed to write screenshot: %w", err)
+		}
 	}
 
 	return result, nil
 }
 
+// DisplayFilepath is where CaptureToFile stores a secondary display's image
+// for a capture whose primary image is at primary.
+func DisplayFilepath(primary string, d Display) string {
+	return fmt.Sprintf("%s_display%d%s", strings.TrimSuffix(primary, ".webp"), d.Index, ".webp")
+}
+
+// screenHash computes a 64-bit difference hash of an image. sips shrinks the
+// image to 9x8 first so only a tiny PNG is decoded in Go.
+func screenHash(pngPath, tempPath string) (uint64, error) {
+	defer os.Remove(tempPath)
+	cmd := exec.Command("sips", "-z", "8", "9", pngPath, "--out", tempPath)
+	if err := cmd.Run(); err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(tempPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return differenceHash(img), nil
+}
+
+func differenceHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var hash uint64
+	bit := 0
+	for y := 0; y < 8 && y < b.Dy(); y++ {
+		for x := 0; x < 8 && x+1 < b.Dx(); x++ {
+			left := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			right := color.GrayModel.Convert(img.At(b.Min.X+x+1, b.Min.Y+y)).(color.Gray).Y
+			if left > right {
+				hash |= 1 << bit
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// HashDistance is the number of differing bits between two screen hashes;
+// 0-4 means the screen is visually unchanged.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
 func getImageDimensions(filepath string) (int, int, error) {
 	// Use sips (built-in macOS) to get dimensions without loading image into memory
 	cmd := exec.Command("sips", "-g", "pixelWidth", "-g", "pixelHeight", filepath)
@@ -128,18 +331,43 @@ func getImageDimensions(filepath string) (int, int, error) {
 	return width, height, nil
 }
 
-func GetActiveWindowID() (string, error) {
+// GetActiveWindowID returns the CGWindowID and bounds of the frontmost
+// window. System Events has no notion of window IDs, so this asks the window
+// server for the topmost normal window owned by the frontmost app.
+func GetActiveWindowID() (uint32, *Rect, error) {
 	script := `
-		tell application "System Events"
-			set frontApp to first application process whose frontmost is true
-			set frontWindow to first window of frontApp
-			return id of frontWindow
-		end tell
+		ObjC.import('AppKit');
+		ObjC.import('CoreGraphics');
+		var pid = $.NSWorkspace.sharedWorkspace.frontmostApplication.processIdentifier;
+		var list = ObjC.deepUnwrap(ObjC.castRefToObject(
+			$.CGWindowListCopyWindowInfo($.kCGWindowListOptionOnScreenOnly | $.kCGWindowListExcludeDesktopElements, $.kCGNullWindowID)));
+		var out = null;
+		for (var i = 0; i < list.length; i++) {
+			var w = list[i];
+			if (w.kCGWindowOwnerPID === pid && w.kCGWindowLayer === 0) {
+				var b = w.kCGWindowBounds;
+				out = {id: w.kCGWindowNumber, x: Math.round(b.X), y: Math.round(b.Y), width: Math.round(b.Width), height: Math.round(b.Height)};
+				break;
+			}
+		}
+		JSON.stringify(out);
 	`
-	cmd := exec.Command("osascript", "-e", script)
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", script)
 	output, err := cmd.Output()
 	if err != nil {
-		return "", err
+		return 0, nil, err
+	}
+
+	var window *struct {
+		ID uint32 `json:"id"`
+		Rect
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(output), &window); err != nil {
+		return 0, nil, fmt.Errorf("failed to parse window info: %w", err)
+	}
+	if window == nil || window.ID == 0 {
+		return 0, nil, fmt.Errorf("frontmost app has no on-screen window")
 	}
-	return string(bytes.TrimSpace(output)), nil
+	bounds := window.Rect
+	return window.ID, &bounds, nil
 }
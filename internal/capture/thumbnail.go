@@ -0,0 +1,60 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// ThumbnailSize is the longest side of a thumbnail in pixels
+	ThumbnailSize    = 320
+	thumbnailQuality = 70
+)
+
+// MakeThumbnail writes a small WebP version of the image at src to dst,
+// scaled so its longest side is ThumbnailSize.
+func MakeThumbnail(src, dst string) error {
+	tempPNG := filepath.Join(os.TempDir(), fmt.Sprintf("memento_thumb_%d.png", time.Now().UnixNano()))
+	defer os.Remove(tempPNG)
+
+	if err := ConvertToPNG(src, tempPNG, ThumbnailSize); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	cmd := exec.Command("cwebp", "-q", strconv.Itoa(thumbnailQuality), "-quiet", tempPNG, "-o", dst)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cwebp failed (install with: brew install webp): %w", err)
+	}
+	return nil
+}
+
+// ConvertToPNG decodes the image at src (usually a WebP screenshot) into a
+// PNG at dst, scaled so its longest side is at most maxSize. A maxSize of 0
+// keeps the original size.
+func ConvertToPNG(src, dst string, maxSize int) error {
+	args := []string{"-s", "format", "png"}
+	if maxSize > 0 {
+		args = append(args, "-Z", strconv.Itoa(maxSize))
+	}
+	if err := exec.Command("sips", append(args, src, "--out", dst)...).Run(); err == nil {
+		return nil
+	}
+
+	// Older sips can't read WebP; decode it with dwebp and scale that
+	if err := exec.Command("dwebp", "-quiet", src, "-o", dst).Run(); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", src, err)
+	}
+	if maxSize > 0 {
+		if err := exec.Command("sips", "-Z", strconv.Itoa(maxSize), dst).Run(); err != nil {
+			return fmt.Errorf("failed to resize %s: %w", src, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/activity"
+	"github.com/mahirisikli/memento/internal/extract"
+	"github.com/mahirisikli/memento/internal/storage"
+)
+
+// loadActivities returns the activities of [from, to] as the daemon last
+// stored them. A range it has stored nothing for, such as one recorded before
+// activities existed, is segmented on the fly without storing the result, so
+// commands reading activities never write to the database.
+func loadActivities(db *storage.DB, config *Config, from, to time.Time) ([]storage.Activity, error) {
+	activities, err := db.GetActivities(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activities: %w", err)
+	}
+	if len(activities) > 0 {
+		return activities, nil
+	}
+	return computeActivities(db, config, from, to)
+}
+
+// updateActivities segments [from, to] again and stores the result, replacing
+// the stored activities overlapping the range. The range is first widened to
+// cover those activities whole, so one crossing midnight isn't cut short.
+// Only the daemon calls it.
+func updateActivities(db *storage.DB, config *Config, from, to time.Time) error {
+	stored, err := db.GetActivities(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get activities: %w", err)
+	}
+	for _, a := range stored {
+		if a.StartTime.Before(from) {
+			from = a.StartTime
+		}
+		if a.EndTime.After(to) {
+			to = a.EndTime
+		}
+	}
+
+	activities, err := computeActivities(db, config, from, to)
+	if err != nil {
+		return err
+	}
+	if err := db.ReplaceActivities(from, to, activities); err != nil {
+		return fmt.Errorf("failed to store activities: %w", err)
+	}
+	return nil
+}
+
+// computeActivities segments everything recorded in [from, to] into
+// activities.
+func computeActivities(db *storage.DB, config *Config, from, to time.Time) ([]storage.Activity, error) {
+	spans, err := reportSpans(db, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+	screenshots, err := db.GetScreenshotsByDateRange(from, to, 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get screenshots: %w", err)
+	}
+	sessions, err := db.GetTypingSessionsByDateRange(from, to, "", 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get typing sessions: %w", err)
+	}
+
+	var in activity.Input
+	for _, s := range spans {
+		in.Spans = append(in.Spans, activity.Span{Start: s.Start, End: s.End, App: s.App, Title: s.Title})
+	}
+	for _, s := range screenshots {
+		// Newly appeared text describes what happened better than the
+		// whole screen, which repeats from capture to capture
+		text := s.OCRNewText
+		if text == "" && s.PreviousScreenshotID == 0 {
+			text = s.OCRText
+		}
+		in.Screenshots = append(in.Screenshots, activity.Item{Time: s.Timestamp, Text: text})
+	}
+	for _, s := range sessions {
+		// Keywords must never surface a typed password
+		text := strings.ReplaceAll(extract.Redact(s.Text), extract.Redacted, " ")
+		in.Typing = append(in.Typing, activity.Item{Time: s.StartTime, Text: text, Keys: s.KeyCount})
+	}
+
+	var activities []storage.Activity
+	for _, a := range activity.Segment(in, activity.DefaultConfig()) {
+		stored := storage.Activity{
+			StartTime:          a.Start,
+			EndTime:            a.End,
+			DurationSeconds:    a.Seconds,
+			DominantApp:        a.App,
+			Apps:               a.Apps,
+			Titles:             a.Titles,
+			Keywords:           a.Keywords,
+			ScreenshotCount:    a.Screenshots,
+			TypingSessionCount: a.TypingSessions,
+			Keystrokes:         a.Keystrokes,
+		}
+		// Spans estimated from screenshots aren't focus events
+		for _, s := range spans {
+			if !s.estimated && !s.Start.Before(a.Start) && s.Start.Before(a.End) {
+				stored.FocusEventCount++
+			}
+		}
+		activities = append(activities, stored)
+	}
+	return activities, nil
+}
@@ -1,16 +1,29 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/mahirisikli/memento/internal/backup"
+	"github.com/mahirisikli/memento/internal/storage"
 	"github.com/spf13/cobra"
 )
 
+// Remote objects live under this prefix in the bucket
+const backupPrefix = "memento/"
+
 var backupCmd = &cobra.Command{
 	Use:   "backup",
-	Short: "Manage backups to R2",
+	Short: "Manage backups to S3-compatible storage (R2, S3, MinIO) or a local drive",
 }
 
 var backupNowCmd = &cobra.Command{
@@ -26,33 +39,188 @@ var backupNowCmd = &cobra.Command{
 			return fmt.Errorf("backup is not enabled. Run: memento config set backup_enabled true")
 		}
 
-		if config.Backup.R2Bucket == "" {
-			return fmt.Errorf("R2 bucket not configured. Run: memento config set r2_bucket <bucket-name>")
+		target, err := backupTarget(config)
+		if err != nil {
+			return err
 		}
 
-		storagePath := getStoragePath()
-		remotePath := fmt.Sprintf("r2:%s/memento", config.Backup.R2Bucket)
-
-		fmt.Printf("Backing up %s to %s...\n", storagePath, remotePath)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-		rcloneCmd := exec.Command("rclone", "sync", storagePath, remotePath, 
-			"--progress",
-			"--exclude", "*.log",
-			"--exclude", ".venv/**",
-			"--exclude", "logs/**",
-		)
-		rcloneCmd.Stdout = cmd.OutOrStdout()
-		rcloneCmd.Stderr = cmd.ErrOrStderr()
+		storagePath := getStoragePath()
+		jsonOutput := getOutputFormat() == "json"
+		verb := "uploaded"
+		if _, ok := target.(*backup.LocalTarget); ok {
+			verb = "copied"
+		}
+		var progress func(string, int64)
+		if !jsonOutput {
+			fmt.Printf("Backing up %s to %s...\n", storagePath, target)
+			var files int
+			var bytes int64
+			progress = func(rel string, size int64) {
+				files++
+				bytes += size
+				fmt.Printf("\r%d files %s (%s)", files, verb, formatBytes(bytes))
+			}
+		}
 
-		if err := rcloneCmd.Run(); err != nil {
+		result, err := performBackup(ctx, config, storagePath, "manual", progress)
+		if progress != nil && result != nil && result.Uploaded > 0 {
+			fmt.Println()
+		}
+		if jsonOutput && result != nil {
+			outputJSON(result)
+		}
+		if err != nil {
+			if result != nil {
+				for _, e := range result.Errors {
+					fmt.Fprintln(os.Stderr, e)
+				}
+			}
 			return fmt.Errorf("backup failed: %w", err)
 		}
 
-		fmt.Println("Backup completed successfully!")
+		if !jsonOutput {
+			fmt.Printf("Backup completed: snapshot %s, %d %s (%s), %d unchanged, in %s\n",
+				result.Snapshot, result.Uploaded, verb, formatBytes(result.BytesUploaded), result.Skipped, result.Duration.Round(time.Second))
+			if result.PlaintextRemoved > 0 {
+				fmt.Printf("Removed %d unencrypted objects left by earlier backups\n", result.PlaintextRemoved)
+			}
+			if result.SnapshotsRemoved > 0 {
+				fmt.Printf("Removed %d old snapshots\n", result.SnapshotsRemoved)
+			}
+			if result.ObjectsRemoved > 0 {
+				fmt.Printf("Deleted %d objects no snapshot uses (%s)\n", result.ObjectsRemoved, formatBytes(result.BytesRemoved))
+			}
+		}
 		return nil
 	},
 }
 
+// performBackup writes a snapshot of the storage directory to the configured
+// target, copying only files that aren't there yet, and records the run in
+// the backup history. Interrupted runs aren't recorded, and neither are
+// runs refused because another one is in progress.
+func performBackup(ctx context.Context, config *Config, storagePath, trigger string, progress func(rel string, size int64)) (*backup.SyncResult, error) {
+	unlock, err := lockBackup(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	started := time.Now()
+	result, err := backupToTarget(ctx, config, storagePath, progress)
+	if !errors.Is(err, context.Canceled) {
+		run := backup.NewRun(trigger, started, result, err)
+		if err := backup.RecordRun(backupHistoryPath(storagePath), run); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record backup history: %v\n", err)
+		}
+	}
+	return result, err
+}
+
+// lockBackup keeps two processes, such as the daemon and memento backup
+// now, from backing up at the same time: they share the database snapshot,
+// the sync state and the history under backup/.
+func lockBackup(storagePath string) (func(), error) {
+	dir := filepath.Join(storagePath, "backup")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "backup.lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("another backup is running")
+	}
+	return func() { f.Close() }, nil
+}
+
+func backupToTarget(ctx context.Context, config *Config, storagePath string, progress func(rel string, size int64)) (*backup.SyncResult, error) {
+	target, err := backupTarget(config)
+	if err != nil {
+		return nil, err
+	}
+	if s3, ok := target.(*backup.S3Target); ok {
+		keys, err := backup.LoadKeyring(backupKeysPath(storagePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load backup keys: %w", err)
+		}
+		if keys == nil {
+			return nil, fmt.Errorf("backups are encrypted and no key is set up. Run: memento backup init")
+		}
+		s3.Keys = keys
+	}
+
+	// Compaction and pruning move and remove images; keep them from changing
+	// the files the database snapshot refers to until every one is copied
+	unlock, err := storage.NewFileManager(storagePath).LockFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// The live database may be mid-write; upload a checked snapshot instead
+	dbSnapshot := filepath.Join(storagePath, "backup", "memento.db")
+	if err := snapshotDatabase(storagePath, dbSnapshot); err != nil {
+		return nil, err
+	}
+	defer os.Remove(dbSnapshot)
+
+	return target.Backup(ctx, storagePath, backup.SyncOptions{
+		Exclude:   backup.DefaultExclude,
+		StatePath: filepath.Join(storagePath, "backup", "state.json"),
+		Replace:   map[string]string{"memento.db": dbSnapshot},
+		Progress:  progress,
+	})
+}
+
+// backupTarget returns the configured destination. The S3 target's Keys are
+// left for the caller to set, since each command gets them differently.
+func backupTarget(config *Config) (backup.Target, error) {
+	b := config.Backup
+	switch b.Target {
+	case "", "s3":
+		client, err := backup.NewS3Client(b.S3Config())
+		if err != nil {
+			return nil, fmt.Errorf("backup is not configured: %w", err)
+		}
+		return &backup.S3Target{Client: client, Prefix: backupPrefix, KeepDaily: b.KeepDaily, KeepWeekly: b.KeepWeekly}, nil
+	case "local":
+		if b.Path == "" {
+			return nil, fmt.Errorf("backup path not configured. Run: memento config set backup_path /Volumes/<drive>/memento")
+		}
+		return &backup.LocalTarget{Root: b.LocalPath(), KeepDaily: b.KeepDaily, KeepWeekly: b.KeepWeekly}, nil
+	default:
+		return nil, fmt.Errorf("unknown backup target %q. Run: memento config set backup_target s3 (or local)", b.Target)
+	}
+}
+
+func snapshotDatabase(storagePath, path string) error {
+	db, err := storage.NewDB(storagePath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return db.Snapshot(path)
+}
+
+func backupHistoryPath(storagePath string) string {
+	return filepath.Join(storagePath, "backup", "history.json")
+}
+
+// backupKeysPath is the local plaintext copy of the keyring. It never leaves
+// the machine; the bucket only holds the sealed copy.
+func backupKeysPath(storagePath string) string {
+	return filepath.Join(storagePath, "backup", "keys.json")
+}
+
 var backupStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show backup status",
@@ -62,20 +230,56 @@ var backupStatusCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		local := config.Backup.Target == "local"
+		s3 := config.Backup.S3Config()
+		credentials := s3.AccessKeyID != "" && s3.SecretAccessKey != ""
+		storagePath := getStoragePath()
+		keys, err := backup.LoadKeyring(backupKeysPath(storagePath))
+		if err != nil {
+			return fmt.Errorf("failed to load backup keys: %w", err)
+		}
+		history, err := backup.LoadHistory(backupHistoryPath(storagePath))
+		if err != nil {
+			return fmt.Errorf("failed to load backup history: %w", err)
+		}
+		now := time.Now()
+		var nextRun time.Time
+		schedule, scheduleErr := backup.ParseSchedule(config.Backup.Schedule)
+		if scheduleErr == nil && config.Backup.Enabled {
+			nextRun = history.NextRun(schedule, now)
+		}
+
 		format := getOutputFormat()
 		status := map[string]interface{}{
 			"enabled":     config.Backup.Enabled,
 			"schedule":    config.Backup.Schedule,
-			"r2_bucket":   config.Backup.R2Bucket,
-			"r2_endpoint": config.Backup.R2Endpoint,
-			"checked_at":  time.Now(),
+			"target":      "s3",
+			"keep_daily":  config.Backup.KeepDaily,
+			"keep_weekly": config.Backup.KeepWeekly,
+			"encrypted":   keys != nil,
+			"history":     history.Runs,
+			"checked_at":  now,
 		}
-
-		// Check if rclone is available
-		if _, err := exec.LookPath("rclone"); err != nil {
-			status["rclone_installed"] = false
+		if local {
+			status["target"] = "local"
+			status["path"] = config.Backup.LocalPath()
+			status["encrypted"] = false
 		} else {
-			status["rclone_installed"] = true
+			status["bucket"] = s3.Bucket
+			status["endpoint"] = s3.Endpoint
+			status["region"] = s3.Region
+			status["credentials"] = credentials
+		}
+		if !nextRun.IsZero() {
+			status["next_run"] = nextRun
+		}
+		if last := history.LastSuccess(); last != nil {
+			status["last_success"] = last.Started
+		}
+		if keys != nil && !local {
+			status["key_id"] = keys.Primary().ID
+			status["key_created"] = keys.Primary().Created
+			status["keys"] = len(keys.Keys)
 		}
 
 		switch format {
@@ -85,19 +289,671 @@ var backupStatusCmd = &cobra.Command{
 			fmt.Println("Backup Status")
 			fmt.Println("=============")
 			fmt.Printf("Enabled:     %v\n", config.Backup.Enabled)
-			fmt.Printf("Schedule:    %s\n", config.Backup.Schedule)
-			fmt.Printf("R2 Bucket:   %s\n", config.Backup.R2Bucket)
-			if status["rclone_installed"].(bool) {
-				fmt.Println("rclone:      installed")
+			if scheduleErr != nil {
+				fmt.Printf("Schedule:    %s (INVALID: %v)\n", config.Backup.Schedule, scheduleErr)
 			} else {
-				fmt.Println("rclone:      NOT INSTALLED (brew install rclone)")
+				fmt.Printf("Schedule:    %s\n", config.Backup.Schedule)
+			}
+			if local {
+				fmt.Println("Target:      local")
+				path := config.Backup.LocalPath()
+				if err := (&backup.LocalTarget{Root: path}).Available(); err != nil {
+					fmt.Printf("Path:        %s (NOT MOUNTED)\n", path)
+				} else {
+					fmt.Printf("Path:        %s\n", path)
+				}
+				fmt.Println("Encryption:  none (snapshots are plain files; use an encrypted drive)")
+			} else {
+				fmt.Println("Target:      s3")
+				fmt.Printf("Bucket:      %s\n", s3.Bucket)
+				fmt.Printf("Endpoint:    %s\n", s3.Endpoint)
+				if s3.Region != "" {
+					fmt.Printf("Region:      %s\n", s3.Region)
+				}
+				if credentials {
+					fmt.Println("Credentials: set")
+				} else {
+					fmt.Println("Credentials: MISSING (memento config set s3_access_key_id / s3_secret_access_key, or AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY)")
+				}
+				if keys != nil {
+					primary := keys.Primary()
+					fmt.Printf("Encryption:  key %s, created %s", primary.ID, primary.Created.Local().Format("2006-01-02"))
+					if len(keys.Keys) > 1 {
+						fmt.Printf(" (%d older keys kept)", len(keys.Keys)-1)
+					}
+					fmt.Println()
+				} else {
+					fmt.Println("Encryption:  NOT SET UP (memento backup init)")
+				}
+			}
+			fmt.Printf("Keep:        %d daily, %d weekly\n", config.Backup.KeepDaily, config.Backup.KeepWeekly)
+			if last := history.LastSuccess(); last != nil {
+				fmt.Printf("Last backup: %s (%s ago)\n", last.Started.Format("2006-01-02 15:04"), formatDuration(now.Sub(last.Started)))
+			} else {
+				fmt.Println("Last backup: never")
+			}
+			if !nextRun.IsZero() {
+				if nextRun.After(now) {
+					fmt.Printf("Next backup: %s\n", nextRun.Format("2006-01-02 15:04"))
+				} else {
+					fmt.Println("Next backup: due now (runs when the daemon next checks)")
+				}
+			}
+
+			if len(history.Runs) > 0 {
+				verb := "uploaded"
+				if local {
+					verb = "copied"
+				}
+				fmt.Println()
+				fmt.Println("Recent runs:")
+				runs := history.Runs
+				if len(runs) > 10 {
+					runs = runs[len(runs)-10:]
+				}
+				for i := len(runs) - 1; i >= 0; i-- {
+					r := runs[i]
+					line := fmt.Sprintf("  %s  %-8s  %6s  ", r.Started.Format("2006-01-02 15:04"), r.Trigger, formatDuration(r.Duration))
+					if r.OK() {
+						line += fmt.Sprintf("%d %s (%s)", r.Uploaded, verb, formatBytes(r.BytesUploaded))
+						if r.Expired > 0 {
+							line += fmt.Sprintf(", %d old snapshots removed", r.Expired)
+						}
+					} else {
+						line += "FAILED: " + r.Error
+					}
+					fmt.Println(line)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "12.3 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List backup snapshots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		target, err := backupTarget(config)
+		if err != nil {
+			return err
+		}
+		snapshots, err := target.Snapshots(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %w", err)
+		}
+
+		switch getOutputFormat() {
+		case "json":
+			outputJSON(snapshots)
+		default:
+			if len(snapshots) == 0 {
+				fmt.Println("No snapshots yet. Run: memento backup now")
+				return nil
+			}
+			for _, s := range snapshots {
+				fmt.Printf("%s  %s  %6d files  %s\n", s.ID, s.Created.Local().Format("2006-01-02 15:04"), s.Files, formatBytes(s.Size))
+			}
+			fmt.Printf("\nEach backup keeps the newest snapshot of each of the last %d days and %d weeks.\n",
+				config.Backup.KeepDaily, config.Backup.KeepWeekly)
+		}
+		return nil
+	},
+}
+
+var (
+	restoreSnapshot string
+	restoreDir      string
+	restoreOnly     string
+	restoreFrom     string
+	restoreUntil    string
+)
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a snapshot into a storage directory",
+	Long: `Copy a snapshot from the backup target, decrypting it if it comes from S3,
+into a new directory, which can be used with --storage or moved to ~/.memento
+once the daemon is stopped:
+
+  memento backup restore --to ~/memento-restored
+  memento backup restore --snapshot 20260115T030012Z --to /tmp/db --only db
+  memento backup restore --to /tmp/jan --only screenshots --from 2026-01-01 --until 2026-01-31
+
+--from and --until select screenshots by day, inclusive. Thumbnails aren't
+backed up; regenerate them with: memento screenshots thumbnails`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if restoreDir == "" {
+			return fmt.Errorf("--to is required")
+		}
+		if entries, err := os.ReadDir(restoreDir); err == nil && len(entries) > 0 {
+			return fmt.Errorf("%s is not empty", restoreDir)
+		}
+		filter, err := restoreFilter()
+		if err != nil {
+			return err
+		}
+
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		target, err := backupTarget(config)
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if s3, ok := target.(*backup.S3Target); ok {
+			if s3.Keys, err = restoreKeys(ctx, s3.Client); err != nil {
+				return err
+			}
+		}
+		manifest, err := target.Manifest(ctx, restoreSnapshot)
+		if err != nil {
+			return err
+		}
+
+		jsonOutput := getOutputFormat() == "json"
+		opts := backup.RestoreOptions{Filter: filter}
+		if !jsonOutput {
+			fmt.Printf("Restoring snapshot %s to %s...\n", manifest.ID, restoreDir)
+			var files int
+			var bytes int64
+			opts.Progress = func(path string, size int64) {
+				files++
+				bytes += size
+				fmt.Printf("\rRestored %d files (%s)", files, formatBytes(bytes))
+			}
+		}
+		result, err := target.Restore(ctx, manifest, restoreDir, opts)
+		if !jsonOutput && result.Files > 0 {
+			fmt.Println()
+		}
+		if jsonOutput {
+			outputJSON(result)
+		}
+		if err != nil {
+			for _, e := range result.Errors {
+				fmt.Fprintln(os.Stderr, e)
+			}
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		if !jsonOutput {
+			if result.Files == 0 {
+				fmt.Println("No files matched.")
+				return nil
+			}
+			fmt.Printf("Restored %d files (%s) from snapshot %s\n", result.Files, formatBytes(result.Bytes), manifest.ID)
+		}
+		return nil
+	},
+}
+
+// restoreFilter selects files by --only and, for screenshots, by the
+// --from/--until day range.
+func restoreFilter() (func(backup.ManifestEntry) bool, error) {
+	switch restoreOnly {
+	case "", "db", "screenshots":
+	default:
+		return nil, fmt.Errorf("invalid --only %q: use db or screenshots", restoreOnly)
+	}
+	now := time.Now()
+	var from, until string
+	if restoreFrom != "" {
+		t := parseRelativeTime(restoreFrom, now)
+		if t.IsZero() {
+			return nil, fmt.Errorf("invalid date %q", restoreFrom)
+		}
+		from = t.Format("2006-01-02")
+	}
+	if restoreUntil != "" {
+		t := parseRelativeTime(restoreUntil, now)
+		if t.IsZero() {
+			return nil, fmt.Errorf("invalid date %q", restoreUntil)
+		}
+		until = t.Format("2006-01-02")
+	}
+
+	return func(f backup.ManifestEntry) bool {
+		first, last, isScreenshot := screenshotDays(f.Path)
+		switch restoreOnly {
+		case "db":
+			return f.Path == "memento.db" || strings.HasPrefix(f.Path, "memento.db-")
+		case "screenshots":
+			if !isScreenshot {
+				return false
+			}
+		}
+		if !isScreenshot {
+			return true
+		}
+		return (from == "" || last >= from) && (until == "" || first <= until)
+	}, nil
+}
+
+// screenshotDays returns the days a screenshot file covers: the day of its
+// screenshots/YYYY/MM/DD/ directory or, for a segment in
+// screenshots/YYYY/MM/, the whole month.
+func screenshotDays(rel string) (first, last string, ok bool) {
+	parts := strings.Split(rel, "/")
+	if len(parts) < 4 || parts[0] != "screenshots" {
+		return "", "", false
+	}
+	if len(parts) == 4 && strings.HasSuffix(rel, ".seg") {
+		month := strings.Join(parts[1:3], "-")
+		if _, err := time.Parse("2006-01", month); err != nil {
+			return "", "", false
+		}
+		return month + "-01", month + "-31", true
+	}
+	if len(parts) < 5 {
+		return "", "", false
+	}
+	day := strings.Join(parts[1:4], "-")
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return "", "", false
+	}
+	return day, day, true
+}
+
+// restoreKeys returns this machine's keyring or, on a new machine, opens the
+// bucket's keyring with the passphrase or --identity.
+func restoreKeys(ctx context.Context, client *backup.S3Client) (*backup.Keyring, error) {
+	keys, err := backup.LoadKeyring(backupKeysPath(getStoragePath()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backup keys: %w", err)
+	}
+	if keys != nil && backupIdentityFile == "" {
+		return keys, nil
+	}
+	sealed, err := backup.FetchKeyring(ctx, client, backupPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keyring: %w", err)
+	}
+	if sealed == nil {
+		return nil, fmt.Errorf("no keyring in s3://%s/%s", client.Bucket(), backupPrefix)
+	}
+	return openSealedKeyring(sealed)
+}
+
+var (
+	backupRecipients       []string
+	backupUsePassphrase    bool
+	backupIdentityFile     string
+	backupChangePassphrase bool
+	backupVerifySample     int
+)
+
+var backupInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up backup encryption, or recover the keys from the bucket",
+	Long: `Set up client-side encryption. Every object is encrypted with AES-256-GCM
+before upload and named by an HMAC of its content's SHA-256, so identical
+files share one object and the bucket reveals neither contents nor file
+names.
+
+The data keys are kept in ~/.memento/backup/keys.json and stored in the bucket
+sealed with a passphrase (the default) or to age X25519 recipients:
+
+  memento backup init                          # prompts for a passphrase
+  memento backup init --recipient age1...      # e.g. from: memento backup keygen
+
+If the bucket already holds a keyring, init recovers it instead, using the
+passphrase or --identity. MEMENTO_BACKUP_PASSPHRASE skips the prompt.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keysPath := backupKeysPath(getStoragePath())
+		if keys, err := backup.LoadKeyring(keysPath); err != nil {
+			return fmt.Errorf("failed to load backup keys: %w", err)
+		} else if keys != nil {
+			return fmt.Errorf("backup encryption is already set up (key %s). Use: memento backup rotate-key", keys.Primary().ID)
+		}
+
+		client, err := backupClient()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		sealed, err := backup.FetchKeyring(ctx, client, backupPrefix)
+		if err != nil {
+			return fmt.Errorf("failed to fetch keyring: %w", err)
+		}
+
+		if sealed != nil {
+			keys, err := openSealedKeyring(sealed)
+			if err != nil {
+				return err
+			}
+			if err := keys.Save(keysPath); err != nil {
+				return fmt.Errorf("failed to save backup keys: %w", err)
+			}
+			fmt.Printf("Recovered %d keys from s3://%s/%s%s\n", len(keys.Keys), client.Bucket(), backupPrefix, backup.KeyringObject)
+			return nil
+		}
+
+		passphrase := ""
+		if len(backupRecipients) == 0 || backupUsePassphrase {
+			passphrase, err = readPassphrase(backupPassphraseEnv, "New backup passphrase: ", true)
+			if err != nil {
+				return err
+			}
+		}
+		keys, err := backup.NewKeyring()
+		if err != nil {
+			return err
+		}
+		sealed, err = keys.Seal(passphrase, backupRecipients)
+		if err != nil {
+			return fmt.Errorf("failed to seal keyring: %w", err)
+		}
+		if err := backup.StoreKeyring(ctx, client, backupPrefix, sealed); err != nil {
+			return fmt.Errorf("failed to upload keyring: %w", err)
+		}
+		if err := keys.Save(keysPath); err != nil {
+			return fmt.Errorf("failed to save backup keys: %w", err)
+		}
+
+		fmt.Printf("Backup encryption set up with key %s\n", keys.Primary().ID)
+		fmt.Println("Keep the passphrase or identity safe: without it, backups can't be restored on another machine.")
+		return nil
+	},
+}
+
+var backupRotateCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Add a new encryption key for future backups",
+	Long: `Add a new data key. The next backup re-encrypts every file with it and
+uploads the result as new objects, so the bucket holds two copies until the
+earlier snapshots are gone.
+
+Rotation only adds a key. The older keys stay in the keyring, because earlier
+snapshots and the objects they reference remain encrypted with them and are
+not rewritten: anyone holding an older key can still read those snapshots.
+
+The keyring is resealed to the same passphrase and recipients unless
+--change-passphrase or --recipient is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keysPath := backupKeysPath(getStoragePath())
+		keys, err := backup.LoadKeyring(keysPath)
+		if err != nil {
+			return fmt.Errorf("failed to load backup keys: %w", err)
+		}
+		if keys == nil {
+			return fmt.Errorf("backup encryption is not set up. Run: memento backup init")
+		}
+
+		client, err := backupClient()
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		sealed, err := backup.FetchKeyring(ctx, client, backupPrefix)
+		if err != nil {
+			return fmt.Errorf("failed to fetch keyring: %w", err)
+		}
+
+		recipients := backupRecipients
+		if len(recipients) == 0 && sealed != nil {
+			recipients = sealed.RecipientList()
+		}
+		passphrase := ""
+		if sealed != nil && sealed.Passphrase != nil {
+			passphrase, err = readPassphrase(backupPassphraseEnv, "Current backup passphrase: ", false)
+			if err != nil {
+				return err
+			}
+			if _, err := sealed.OpenPassphrase(passphrase); err != nil {
+				return err
 			}
 		}
+		if backupChangePassphrase || (passphrase == "" && len(recipients) == 0) {
+			passphrase, err = readPassphrase(backupPassphraseEnv, "New backup passphrase: ", true)
+			if err != nil {
+				return err
+			}
+		}
+
+		key, err := keys.Rotate()
+		if err != nil {
+			return err
+		}
+		sealed, err = keys.Seal(passphrase, recipients)
+		if err != nil {
+			return fmt.Errorf("failed to seal keyring: %w", err)
+		}
+		if err := backup.StoreKeyring(ctx, client, backupPrefix, sealed); err != nil {
+			return fmt.Errorf("failed to upload keyring: %w", err)
+		}
+		if err := keys.Save(keysPath); err != nil {
+			return fmt.Errorf("failed to save backup keys: %w", err)
+		}
+
+		fmt.Printf("New key %s. The next backup re-encrypts all files with it; earlier snapshots keep their keys.\n", key.ID)
 		return nil
 	},
 }
 
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Read back a sample of the backup to prove it can be restored",
+	Long: `Check the latest snapshot: every file it references must exist, and a
+random sample is read back and compared with the hashes the manifest records.
+
+For S3, the keyring stored in the bucket is first opened with the passphrase
+or --identity, the way a restore on a new machine would, and the sample is
+downloaded and decrypted. Verify also fails if the keyring lacks a key this
+machine encrypts with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		target, err := backupTarget(config)
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		s3, encrypted := target.(*backup.S3Target)
+		if encrypted {
+			sealed, err := backup.FetchKeyring(ctx, s3.Client, backupPrefix)
+			if err != nil {
+				return fmt.Errorf("failed to fetch keyring: %w", err)
+			}
+			if sealed == nil {
+				return fmt.Errorf("no keyring in %s. Run: memento backup init", s3)
+			}
+			if s3.Keys, err = openSealedKeyring(sealed); err != nil {
+				return err
+			}
+		}
+
+		result, err := target.Verify(ctx, backupVerifySample)
+		if err != nil {
+			return fmt.Errorf("verify failed: %w", err)
+		}
+		if encrypted {
+			local, err := backup.LoadKeyring(backupKeysPath(getStoragePath()))
+			if err != nil {
+				return fmt.Errorf("failed to load backup keys: %w", err)
+			}
+			if local != nil {
+				for _, key := range local.Keys {
+					if _, ok := s3.Keys.Get(key.ID); !ok {
+						result.Failures = append(result.Failures, fmt.Sprintf("key %s is missing from the bucket's keyring", key.ID))
+					}
+				}
+			}
+		}
+
+		if getOutputFormat() == "json" {
+			outputJSON(result)
+		} else {
+			verb := "read back"
+			if encrypted {
+				verb = "decrypted"
+			}
+			fmt.Printf("Snapshot %s: %s %d of %d objects (%s)\n", result.Snapshot, verb, len(result.Files), result.Objects, formatBytes(result.Bytes))
+			for _, f := range result.Failures {
+				fmt.Printf("  FAILED %s\n", f)
+			}
+		}
+		if len(result.Failures) > 0 {
+			return fmt.Errorf("%d problems found", len(result.Failures))
+		}
+		if getOutputFormat() != "json" {
+			fmt.Println("Backup is restorable.")
+		}
+		return nil
+	},
+}
+
+var backupKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an X25519 identity for backup init --recipient",
+	Long: `Print a new identity in age-keygen's format. Store it somewhere other than
+this Mac (a password manager, a printout) and pass the public key to
+memento backup init --recipient. age-keygen identities work too.
+
+  memento backup keygen > memento-backup.key`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identity, recipient, err := backup.GenerateIdentity()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# created: %s\n", time.Now().Format(time.RFC3339))
+		fmt.Printf("# public key: %s\n", recipient)
+		fmt.Println(identity)
+		fmt.Fprintf(os.Stderr, "Public key: %s\n", recipient)
+		return nil
+	},
+}
+
+// backupClient connects to the configured bucket. Keys only exist for the
+// S3 target; local snapshots are plain files.
+func backupClient() (*backup.S3Client, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if config.Backup.Target == "local" {
+		return nil, fmt.Errorf("local backups aren't encrypted, so there are no keys to manage; encrypt the drive instead")
+	}
+	client, err := backup.NewS3Client(config.Backup.S3Config())
+	if err != nil {
+		return nil, fmt.Errorf("backup is not configured: %w", err)
+	}
+	return client, nil
+}
+
+// openSealedKeyring opens the bucket's keyring with --identity or, failing
+// that, the passphrase.
+func openSealedKeyring(sealed *backup.SealedKeyring) (*backup.Keyring, error) {
+	if backupIdentityFile != "" {
+		identity, err := backup.ReadIdentityFile(backupIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity: %w", err)
+		}
+		return sealed.OpenIdentity(identity)
+	}
+	if sealed.Passphrase == nil {
+		return nil, fmt.Errorf("the keyring is sealed to %s; pass --identity", strings.Join(sealed.RecipientList(), ", "))
+	}
+	passphrase, err := readPassphrase(backupPassphraseEnv, "Backup passphrase: ", false)
+	if err != nil {
+		return nil, err
+	}
+	return sealed.OpenPassphrase(passphrase)
+}
+
+// backupPassphraseEnv holds the backup passphrase for unattended use.
+const backupPassphraseEnv = "MEMENTO_BACKUP_PASSPHRASE"
+
+// readPassphrase returns the environment variable env or prompts on the
+// terminal with echo off. With confirm set, new passphrases are asked twice.
+func readPassphrase(env, prompt string, confirm bool) (string, error) {
+	if p := os.Getenv(env); p != "" {
+		return p, nil
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask for the passphrase; set %s", env)
+	}
+	defer tty.Close()
+
+	stty := func(arg string) {
+		c := exec.Command("stty", arg)
+		c.Stdin = tty
+		c.Run()
+	}
+	reader := bufio.NewReader(tty)
+	ask := func(prompt string) (string, error) {
+		fmt.Fprint(tty, prompt)
+		stty("-echo")
+		line, err := reader.ReadString('\n')
+		stty("echo")
+		fmt.Fprintln(tty)
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	passphrase, err := ask(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+	if len(passphrase) < 10 {
+		return "", fmt.Errorf("passphrase must be at least 10 characters")
+	}
+	again, err := ask("Repeat passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if again != passphrase {
+		return "", fmt.Errorf("passphrases don't match")
+	}
+	return passphrase, nil
+}
+
 func init() {
+	backupInitCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "age X25519 public key to seal the keyring to (repeatable)")
+	backupInitCmd.Flags().BoolVar(&backupUsePassphrase, "passphrase", false, "Also seal to a passphrase when --recipient is given")
+	backupRotateCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "Replace the recipients the keyring is sealed to (repeatable)")
+	backupRotateCmd.Flags().BoolVar(&backupChangePassphrase, "change-passphrase", false, "Seal the keyring with a new passphrase")
+	backupVerifyCmd.Flags().IntVar(&backupVerifySample, "sample", 20, "Number of objects to check (0 for all)")
+	backupRestoreCmd.Flags().StringVar(&restoreSnapshot, "snapshot", "latest", "Snapshot ID from memento backup list")
+	backupRestoreCmd.Flags().StringVar(&restoreDir, "to", "", "Directory to restore into; must be new or empty")
+	backupRestoreCmd.Flags().StringVar(&restoreOnly, "only", "", "Restore only the database (db) or only screenshots (screenshots)")
+	backupRestoreCmd.Flags().StringVar(&restoreFrom, "from", "", "First day of screenshots to restore (e.g., '2026-01-15', '1 week ago')")
+	backupRestoreCmd.Flags().StringVar(&restoreUntil, "until", "", "Last day of screenshots to restore")
+	for _, cmd := range []*cobra.Command{backupInitCmd, backupVerifyCmd, backupRestoreCmd} {
+		cmd.Flags().StringVar(&backupIdentityFile, "identity", "", "Identity file to open the keyring with instead of the passphrase")
+	}
+
 	backupCmd.AddCommand(backupNowCmd)
 	backupCmd.AddCommand(backupStatusCmd)
+	backupCmd.AddCommand(backupInitCmd)
+	backupCmd.AddCommand(backupRotateCmd)
+	backupCmd.AddCommand(backupVerifyCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupKeygenCmd)
 }
@@ -0,0 +1,462 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/mahirisikli/memento/internal/tui"
+)
+
+const browseHelp = "j/k move · h/l day · / search · n/N next/prev · tab text pane · o open · t today · q quit"
+
+// browseItem is one row of the interactive timeline: a screenshot or a
+// typing session.
+type browseItem struct {
+	Time       time.Time
+	App        string
+	Title      string
+	Text       string
+	Screenshot *storage.Screenshot
+	Session    *storage.TypingSession
+}
+
+type browser struct {
+	db    *storage.DB
+	fm    *storage.FileManager
+	term  *tui.Terminal
+	day   time.Time
+	items []browseItem
+
+	cursor int
+	offset int
+
+	query     string
+	searching bool
+
+	textFocus  bool
+	textScroll int
+
+	images     string
+	imageCache map[string][]byte
+	status     string
+
+	// viewers wait for the temporary images of opened screenshots to be
+	// removed
+	viewers []func()
+}
+
+// runBrowser shows the interactive timeline for day until the user quits.
+func runBrowser(db *storage.DB, fm *storage.FileManager, day time.Time) error {
+	term, err := tui.Open()
+	if err != nil {
+		return err
+	}
+	defer term.Close()
+
+	b := &browser{
+		db:         db,
+		fm:         fm,
+		term:       term,
+		images:     tui.DetectImageProtocol(),
+		imageCache: make(map[string][]byte),
+	}
+	if err := b.load(day); err != nil {
+		return err
+	}
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer signal.Stop(resize)
+
+	keys := term.Keys()
+	b.draw()
+	for {
+		select {
+		case <-resize:
+			b.draw()
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := b.handle(key); quit {
+				tui.ClearImages(term, b.images)
+				for _, wait := range b.viewers {
+					wait()
+				}
+				return nil
+			}
+			b.draw()
+		}
+	}
+}
+
+func (b *browser) load(day time.Time) error {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 0, 1)
+
+	screenshots, err := b.db.GetScreenshotsByDateRange(from, to, 100000)
+	if err != nil {
+		return fmt.Errorf("failed to get screenshots: %w", err)
+	}
+	sessions, err := b.db.GetTypingSessionsByDateRange(from, to, "", 100000)
+	if err != nil {
+		return fmt.Errorf("failed to get typing sessions: %w", err)
+	}
+
+	items := make([]browseItem, 0, len(screenshots)+len(sessions))
+	for i := range screenshots {
+		s := &screenshots[i]
+		items = append(items, browseItem{Time: s.Timestamp, App: s.ActiveApp, Title: s.ActiveWindowTitle, Text: s.OCRText, Screenshot: s})
+	}
+	for i := range sessions {
+		s := &sessions[i]
+		items = append(items, browseItem{Time: s.StartTime, App: s.ActiveApp, Title: s.ActiveWindowTitle, Text: s.Text, Session: s})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+
+	b.day = from
+	b.items = items
+	b.cursor = 0
+	b.offset = 0
+	b.textScroll = 0
+	b.status = ""
+	return nil
+}
+
+// handle applies a key press and reports whether to quit.
+func (b *browser) handle(key string) bool {
+	if b.searching {
+		switch key {
+		case tui.KeyEnter:
+			b.searching = false
+		case tui.KeyEscape, tui.KeyCtrlC:
+			b.searching = false
+			b.query = ""
+		case tui.KeyBackspace:
+			if r := []rune(b.query); len(r) > 0 {
+				b.query = string(r[:len(r)-1])
+			}
+			b.findFrom(b.cursor, 1)
+		default:
+			if len([]rune(key)) == 1 {
+				b.query += key
+				b.findFrom(b.cursor, 1)
+			}
+		}
+		return false
+	}
+
+	_, rows := b.term.Size()
+	page := max(rows-4, 1)
+	b.status = ""
+
+	if b.textFocus {
+		switch key {
+		case "j", tui.KeyDown:
+			b.textScroll++
+			return false
+		case "k", tui.KeyUp:
+			b.textScroll = max(b.textScroll-1, 0)
+			return false
+		case tui.KeyPageDown, " ":
+			b.textScroll += page / 2
+			return false
+		case tui.KeyPageUp:
+			b.textScroll = max(b.textScroll-page/2, 0)
+			return false
+		}
+	}
+
+	switch key {
+	case "q", tui.KeyCtrlC:
+		return true
+	case tui.KeyEscape:
+		b.query = ""
+		b.textFocus = false
+	case "j", tui.KeyDown:
+		b.move(1)
+	case "k", tui.KeyUp:
+		b.move(-1)
+	case tui.KeyPageDown, " ":
+		b.move(page)
+	case tui.KeyPageUp:
+		b.move(-page)
+	case "g", tui.KeyHome:
+		b.move(-len(b.items))
+	case "G", tui.KeyEnd:
+		b.move(len(b.items))
+	case "h", "[", tui.KeyLeft:
+		b.changeDay(b.day.AddDate(0, 0, -1))
+	case "l", "]", tui.KeyRight:
+		b.changeDay(b.day.AddDate(0, 0, 1))
+	case "t":
+		b.changeDay(time.Now())
+	case "/":
+		b.searching = true
+		b.query = ""
+	case "n":
+		b.findFrom(b.cursor+1, 1)
+	case "N":
+		b.findFrom(b.cursor-1, -1)
+	case tui.KeyTab:
+		b.textFocus = !b.textFocus
+	case "o", tui.KeyEnter:
+		if item := b.selected(); item != nil && item.Screenshot != nil {
+			if wait, err := openInViewer(b.fm, item.Screenshot); err != nil {
+				b.status = "Failed to open screenshot: " + err.Error()
+			} else {
+				b.viewers = append(b.viewers, wait)
+			}
+		}
+	}
+	return false
+}
+
+func (b *browser) move(delta int) {
+	if len(b.items) == 0 {
+		return
+	}
+	b.cursor = min(max(b.cursor+delta, 0), len(b.items)-1)
+	b.textScroll = 0
+}
+
+func (b *browser) changeDay(day time.Time) {
+	if err := b.load(day); err != nil {
+		b.status = err.Error()
+	}
+}
+
+func (b *browser) selected() *browseItem {
+	if b.cursor < 0 || b.cursor >= len(b.items) {
+		return nil
+	}
+	return &b.items[b.cursor]
+}
+
+func (b *browser) matches(item *browseItem) bool {
+	if b.query == "" {
+		return false
+	}
+	q := strings.ToLower(b.query)
+	return strings.Contains(strings.ToLower(item.Text), q) ||
+		strings.Contains(strings.ToLower(item.Title), q) ||
+		strings.Contains(strings.ToLower(item.App), q)
+}
+
+// findFrom moves the cursor to the first match at or after start in
+// direction dir, wrapping around the day.
+func (b *browser) findFrom(start, dir int) {
+	n := len(b.items)
+	if n == 0 || b.query == "" {
+		return
+	}
+	for i := 0; i < n; i++ {
+		idx := ((start+dir*i)%n + n) % n
+		if b.matches(&b.items[idx]) {
+			b.cursor = idx
+			b.textScroll = b.firstMatchLine(idx)
+			return
+		}
+	}
+	b.status = fmt.Sprintf("No match for %q", b.query)
+}
+
+// firstMatchLine returns the line of the text pane holding the first match,
+// so a search scrolls the hit into view.
+func (b *browser) firstMatchLine(idx int) int {
+	cols, _ := b.term.Size()
+	_, textWidth := b.layout(cols)
+	q := strings.ToLower(b.query)
+	for i, line := range tui.Wrap(b.items[idx].Text, textWidth) {
+		if strings.Contains(strings.ToLower(line), q) {
+			return max(i-2, 0)
+		}
+	}
+	return 0
+}
+
+func (b *browser) layout(cols int) (listWidth, textWidth int) {
+	listWidth = min(max(cols*2/5, 30), cols-20)
+	textWidth = cols - listWidth - 3
+	return listWidth, max(textWidth, 10)
+}
+
+func (b *browser) draw() {
+	t := b.term
+	cols, rows := t.Size()
+	listWidth, textWidth := b.layout(cols)
+	bodyRows := rows - 2
+	textCol := listWidth + 2
+
+	tui.ClearImages(t, b.images)
+	t.Clear()
+
+	// Header
+	header := fmt.Sprintf(" memento · %s · %d items", b.day.Format("Mon 2 Jan 2006"), len(b.items))
+	if b.query != "" {
+		header += fmt.Sprintf(" · search: %s", b.query)
+	}
+	t.Print(0, 0, cols, tui.StyleHeader, header)
+
+	// List
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+bodyRows {
+		b.offset = b.cursor - bodyRows + 1
+	}
+	if len(b.items) == 0 {
+		t.Print(1, 2, listWidth-1, tui.StyleDim, "No activity recorded this day.")
+	}
+	for row := 0; row < bodyRows; row++ {
+		idx := b.offset + row
+		if idx >= len(b.items) {
+			break
+		}
+		item := &b.items[idx]
+		kind := "▣"
+		if item.Session != nil {
+			kind = "⌨"
+		}
+		marker := " "
+		if b.matches(item) {
+			marker = "•"
+		}
+		line := fmt.Sprintf("%s%s %s %s - %s", marker, item.Time.Format("15:04:05"), kind, item.App, item.Title)
+		style := tui.StyleNormal
+		if idx == b.cursor {
+			style = tui.StyleReverse
+			if b.textFocus {
+				style = tui.StyleBold
+			}
+		}
+		t.Print(0, row+1, listWidth, style, line)
+	}
+	for row := 1; row <= bodyRows; row++ {
+		t.Print(listWidth, row, 1, tui.StyleDim, "│")
+	}
+
+	// Detail pane
+	row := 1
+	if item := b.selected(); item != nil {
+		title := fmt.Sprintf("%s  %s", item.Time.Format("15:04:05"), item.App)
+		t.Print(textCol, row, textWidth, tui.StyleBold, title)
+		row++
+		if item.Title != "" {
+			t.Print(textCol, row, textWidth, tui.StyleDim, item.Title)
+			row++
+		}
+		if item.Session != nil {
+			t.Print(textCol, row, textWidth, tui.StyleDim, fmt.Sprintf("Typed %d keys in %s",
+				item.Session.KeyCount, item.Session.EndTime.Sub(item.Session.StartTime).Round(time.Second)))
+			row++
+		}
+		row++
+
+		imageRow := row
+		imageRows := 0
+		if item.Screenshot != nil && b.images != tui.ImageNone {
+			imageRows = bodyRows / 2
+			row += imageRows + 1
+		}
+
+		label := "OCR text"
+		if item.Session != nil {
+			label = "Typed text"
+		}
+		if b.textFocus {
+			label += " (tab to return)"
+		}
+		t.Print(textCol, row, textWidth, tui.StyleDim, "── "+label+" "+strings.Repeat("─", max(textWidth-len([]rune(label))-4, 0)))
+		row++
+
+		lines := tui.Wrap(item.Text, textWidth)
+		if item.Text == "" {
+			lines = []string{"(none)"}
+		}
+		available := bodyRows + 1 - row
+		b.textScroll = min(b.textScroll, max(len(lines)-available, 0))
+		for i := 0; i < available && b.textScroll+i < len(lines); i++ {
+			b.printHighlighted(textCol, row+i, textWidth, lines[b.textScroll+i])
+		}
+
+		if imageRows > 0 {
+			if png, err := b.preview(item.Screenshot); err == nil {
+				t.MoveTo(textCol, imageRow)
+				tui.DrawImage(t, b.images, png, textWidth, imageRows)
+			} else {
+				t.Print(textCol, imageRow, textWidth, tui.StyleDim, "Preview unavailable: "+err.Error())
+			}
+		}
+	}
+
+	// Footer
+	footer := " " + browseHelp
+	style := tui.StyleDim
+	if b.searching {
+		footer = "/" + b.query
+		style = tui.StyleNormal
+	} else if b.status != "" {
+		footer = " " + b.status
+	}
+	t.Print(0, rows-1, cols, style, footer)
+	t.Flush()
+}
+
+// printHighlighted prints a line with occurrences of the search query
+// highlighted.
+func (b *browser) printHighlighted(col, row, width int, line string) {
+	t := b.term
+	t.Print(col, row, width, tui.StyleNormal, line)
+	if b.query == "" {
+		return
+	}
+	lower := []rune(strings.ToLower(line))
+	q := []rune(strings.ToLower(b.query))
+	runes := []rune(line)
+	if len(lower) != len(runes) {
+		return
+	}
+	for i := 0; i+len(q) <= len(lower) && i < width; i++ {
+		if string(lower[i:i+len(q)]) == string(q) {
+			t.Print(col+i, row, min(len(q), width-i), tui.StyleHighlite, string(runes[i:i+len(q)]))
+			i += len(q) - 1
+		}
+	}
+}
+
+// preview converts a screenshot to a small PNG for inline display, caching
+// the result for the session.
+func (b *browser) preview(s *storage.Screenshot) ([]byte, error) {
+	if png, ok := b.imageCache[s.Filepath]; ok {
+		return png, nil
+	}
+	path, release, err := b.fm.ImageFile(s.Image())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("memento_preview_%d.png", time.Now().UnixNano()))
+	defer os.Remove(tmp)
+	if err := exec.Command("sips", "-s", "format", "png", "-Z", "800", path, "--out", tmp).Run(); err != nil {
+		if err := exec.Command("dwebp", "-quiet", path, "-o", tmp).Run(); err != nil {
+			return nil, fmt.Errorf("failed to convert screenshot")
+		}
+	}
+	png, err := os.ReadFile(tmp)
+	if err != nil {
+		return nil, err
+	}
+	b.imageCache[s.Filepath] = png
+	return png, nil
+}
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/mahirisikli/memento/internal/capture"
@@ -13,12 +16,14 @@ import (
 var (
 	captureQuality    int
 	captureFullScreen bool
+	captureMode       string
 	captureOCR        bool
 )
 
 func init() {
 	captureCmd.Flags().IntVar(&captureQuality, "quality", 80, "WebP quality (1-100)")
-	captureCmd.Flags().BoolVar(&captureFullScreen, "fullscreen", false, "Capture full screen")
+	captureCmd.Flags().BoolVar(&captureFullScreen, "fullscreen", false, "Capture all displays (same as --mode all_displays)")
+	captureCmd.Flags().StringVar(&captureMode, "mode", "", "Capture mode: all_displays, active_display, active_window (default from config)")
 	captureCmd.Flags().BoolVar(&captureOCR, "ocr", false, "Run OCR immediately")
 }
 
@@ -29,52 +34,47 @@ var captureCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		storagePath := getStoragePath()
 
-		db, err := storage.NewDB(storagePath)
+		config, err := LoadConfig()
 		if err != nil {
-			return fmt.Errorf("failed to open database: %w", err)
+			return fmt.Errorf("failed to load config: %w", err)
 		}
-		defer db.Close()
-
-		fm := storage.NewFileManager(storagePath)
-		screenshotCapture := capture.NewScreenshotCapture(captureQuality, captureFullScreen)
 
-		windowInfo, _ := capture.GetActiveWindow()
-
-		filepath := fm.GetScreenshotPath(time.Now())
-		if err := fm.EnsureDir(filepath); err != nil {
-			return fmt.Errorf("failed to create directory: %w", err)
+		mode := config.CaptureMode
+		if captureFullScreen {
+			mode = capture.ModeAllDisplays
+		}
+		if captureMode != "" {
+			if !capture.IsCaptureMode(captureMode) {
+				return fmt.Errorf("unknown capture mode %q (expected one of: %s)", captureMode, strings.Join(capture.CaptureModes, ", "))
+			}
+			mode = captureMode
 		}
 
-		result, err := screenshotCapture.CaptureToFile(filepath)
+		db, err := openDB(storagePath)
 		if err != nil {
-			return fmt.Errorf("failed to capture screenshot: %w", err)
+			return fmt.Errorf("failed to open database: %w", err)
 		}
+		defer db.Close()
 
-		screenshot := &storage.Screenshot{
-			Timestamp: result.Timestamp,
-			Filepath:  filepath,
-			Width:     result.Width,
-			Height:    result.Height,
-			FileSize:  int64(len(result.Data)),
-		}
-		if windowInfo != nil {
-			screenshot.ActiveWindowTitle = windowInfo.Title
-			screenshot.ActiveApp = windowInfo.App
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
 		}
+		screenshotCapture := capture.NewScreenshotCapture(captureQuality, mode)
+		screenshotCapture.SetFileWriter(fm.WriteImage)
 
-		id, err := db.InsertScreenshot(screenshot)
+		screenshot, result, err := captureAndStore(db, fm, screenshotCapture, capture.ReasonManual)
 		if err != nil {
-			return fmt.Errorf("failed to save screenshot: %w", err)
+			return err
 		}
+		id := screenshot.ID
+		filepath := screenshot.Filepath
 
 		if captureOCR {
 			ocrEngine := ocr.NewOCREngine()
-			text, err := ocrEngine.ExtractText(filepath)
-			if err != nil {
+			defer ocrEngine.Close()
+			if err := ocrScreenshot(db, fm, ocrEngine, config, screenshot); err != nil {
 				fmt.Printf("Warning: OCR failed: %v\n", err)
-			} else {
-				db.UpdateScreenshotOCR(id, text)
-				screenshot.OCRText = text
 			}
 		}
 
@@ -82,14 +82,16 @@ var captureCmd = &cobra.Command{
 		switch format {
 		case "json":
 			outputJSON(map[string]interface{}{
-				"id":         id,
-				"filepath":   filepath,
-				"width":      result.Width,
-				"height":     result.Height,
-				"size":       len(result.Data),
-				"app":        screenshot.ActiveApp,
-				"window":     screenshot.ActiveWindowTitle,
-				"ocr_text":   screenshot.OCRText,
+				"id":           id,
+				"filepath":     filepath,
+				"width":        result.Width,
+				"height":       result.Height,
+				"size":         len(result.Data),
+				"app":          screenshot.ActiveApp,
+				"window":       screenshot.ActiveWindowTitle,
+				"ocr_text":     screenshot.OCRText,
+				"ocr_language": screenshot.OCRLanguage,
+				"displays":     displayRows(result),
 			})
 		case "plain":
 			fmt.Printf("%d\t%s\t%s\n", id, filepath, screenshot.ActiveApp)
@@ -100,6 +102,16 @@ var captureCmd = &cobra.Command{
 			fmt.Printf("  Size:     %dx%d (%d bytes)\n", result.Width, result.Height, len(result.Data))
 			fmt.Printf("  App:      %s\n", screenshot.ActiveApp)
 			fmt.Printf("  Window:   %s\n", screenshot.ActiveWindowTitle)
+			if len(result.Displays) > 1 {
+				fmt.Printf("  Displays: %d\n", len(result.Displays))
+				for _, d := range displayRows(result) {
+					active := ""
+					if d.Active {
+						active = " (active)"
+					}
+					fmt.Printf("    #%d %dx%d at %d,%d%s: %s\n", d.DisplayIndex, d.Width, d.Height, d.X, d.Y, active, d.Filepath)
+				}
+			}
 			if screenshot.OCRText != "" {
 				snippet := screenshot.OCRText
 				if len(snippet) > 100 {
@@ -112,3 +124,209 @@ var captureCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// captureAndStore takes a screenshot and records it, along with each
+// captured display, in the database.
+func captureAndStore(db *storage.DB, fm *storage.FileManager, sc *capture.ScreenshotCapture, reason string) (*storage.Screenshot, *capture.CaptureResult, error) {
+	windowInfo, _ := capture.GetActiveWindow()
+
+	filepath := fm.GetScreenshotPath(time.Now())
+	if err := fm.EnsureDir(filepath); err != nil {
+		return nil, nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	result, err := sc.CaptureToFile(filepath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+
+	// A missing thumbnail is regenerated when it's first needed
+	thumbnail := fm.GetThumbnailPath(filepath, result.Timestamp)
+	if err := makeThumbnail(fm, storage.ImageRef{Path: filepath}, thumbnail); err != nil {
+		thumbnail = ""
+	}
+
+	screenshot := &storage.Screenshot{
+		Timestamp:     result.Timestamp,
+		Filepath:      filepath,
+		Width:         result.Width,
+		Height:        result.Height,
+		FileSize:      int64(len(result.Data)),
+		CaptureReason: reason,
+		ThumbnailPath: thumbnail,
+	}
+	if windowInfo != nil {
+		screenshot.ActiveWindowTitle = windowInfo.Title
+		screenshot.ActiveApp = windowInfo.App
+	}
+	if result.Window != nil {
+		screenshot.WindowID = result.WindowID
+		screenshot.WindowX = result.Window.X
+		screenshot.WindowY = result.Window.Y
+		screenshot.WindowWidth = result.Window.Width
+		screenshot.WindowHeight = result.Window.Height
+	}
+
+	id, err := db.InsertScreenshot(screenshot)
+	if err != nil {
+		return nil, result, fmt.Errorf("failed to save screenshot: %w", err)
+	}
+	screenshot.ID = id
+
+	if err := db.InsertScreenshotDisplays(id, displayRows(result)); err != nil {
+		return screenshot, result, fmt.Errorf("failed to save display metadata: %w", err)
+	}
+	return screenshot, result, nil
+}
+
+// ensureThumbnail returns the path of s's thumbnail, generating it and
+// recording it on the screenshot row if it is missing.
+func ensureThumbnail(db *storage.DB, fm *storage.FileManager, s *storage.Screenshot) (string, error) {
+	if s.ThumbnailPath != "" {
+		if _, err := os.Stat(s.ThumbnailPath); err == nil {
+			return s.ThumbnailPath, nil
+		}
+	}
+	path := fm.GetThumbnailPath(s.Filepath, s.Timestamp)
+	if err := makeThumbnail(fm, s.Image(), path); err != nil {
+		return "", err
+	}
+	if err := db.UpdateScreenshotThumbnail(s.ID, path); err != nil {
+		return "", fmt.Errorf("failed to save thumbnail path: %w", err)
+	}
+	s.ThumbnailPath = path
+	return path, nil
+}
+
+// makeThumbnail writes a thumbnail of image to dst, encrypted if the archive
+// is.
+func makeThumbnail(fm *storage.FileManager, image storage.ImageRef, dst string) error {
+	src, release, err := fm.ImageFile(image)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if !fm.Encrypted() {
+		return capture.MakeThumbnail(src, dst)
+	}
+
+	tmp, err := os.CreateTemp("", "memento_thumb_*.webp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := capture.MakeThumbnail(src, tmp.Name()); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	return fm.WriteImage(dst, data)
+}
+
+// viewerDelay is how long a temporary image handed to a viewer is kept:
+// open returns once the app is asked to open the file, not once it read it.
+const viewerDelay = 5 * time.Second
+
+// openInViewer opens s in the default app. A packed or encrypted image is
+// extracted to a temporary file, which is removed viewerDelay later; wait
+// blocks until then, so a command doesn't exit leaving it behind.
+func openInViewer(fm *storage.FileManager, s *storage.Screenshot) (wait func(), err error) {
+	path, release, err := fm.ImageFile(s.Image())
+	if err != nil {
+		return nil, err
+	}
+	if err := exec.Command("open", path).Run(); err != nil {
+		release()
+		return nil, err
+	}
+	if path == s.Filepath {
+		return func() {}, nil
+	}
+	done := make(chan struct{})
+	time.AfterFunc(viewerDelay, func() {
+		release()
+		close(done)
+	})
+	return func() { <-done }, nil
+}
+
+func displayRows(result *capture.CaptureResult) []storage.ScreenshotDisplay {
+	rows := make([]storage.ScreenshotDisplay, 0, len(result.Displays))
+	for _, img := range result.Displays {
+		rows = append(rows, storage.ScreenshotDisplay{
+			DisplayID:    img.Display.ID,
+			DisplayIndex: img.Display.Index,
+			Name:         img.Display.Name,
+			X:            img.Display.X,
+			Y:            img.Display.Y,
+			Width:        img.Display.Width,
+			Height:       img.Display.Height,
+			Main:         img.Display.Main,
+			Active:       img.Active,
+			Filepath:     img.Filepath,
+			ImageWidth:   img.Width,
+			ImageHeight:  img.Height,
+			FileSize:     int64(len(img.Data)),
+		})
+	}
+	return rows
+}
+
+// ocrScreenshot recognizes the text of every display image in s, then stores
+// the text, its language, extracted entities and the diff against the
+// previous capture of the same window.
+func ocrScreenshot(db *storage.DB, fm *storage.FileManager, engine *ocr.OCREngine, config *Config, s *storage.Screenshot) error {
+	images := []storage.ImageRef{s.Image()}
+	if displays, err := db.GetScreenshotDisplays(s.ID); err == nil && len(displays) > 1 {
+		images = images[:0]
+		for _, d := range displays {
+			images = append(images, d.Image())
+		}
+	}
+
+	languages := config.OCRLanguagesFor(s.ActiveApp)
+	engine.SetLanguages(languages)
+
+	var texts []string
+	for _, image := range images {
+		text, err := ocrImage(fm, engine, image)
+		if err != nil {
+			// Only the primary image is required
+			if image.Path == s.Filepath {
+				return err
+			}
+			continue
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	text := strings.Join(texts, "\n")
+	lang := ocr.DetectLanguage(text, languages)
+
+	if err := db.UpdateScreenshotOCR(s.ID, text, lang); err != nil {
+		return fmt.Errorf("failed to update OCR: %w", err)
+	}
+	s.OCRText = text
+	s.OCRLanguage = lang
+
+	if err := storeScreenshotEntities(db, s); err != nil {
+		return fmt.Errorf("failed to store entities: %w", err)
+	}
+	if err := storeScreenDiff(db, s); err != nil {
+		return fmt.Errorf("failed to diff screen text: %w", err)
+	}
+	return nil
+}
+
+func ocrImage(fm *storage.FileManager, engine *ocr.OCREngine, image storage.ImageRef) (string, error) {
+	path, release, err := fm.ImageFile(image)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return engine.ExtractText(path)
+}
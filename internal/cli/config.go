@@ -5,24 +5,90 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/mahirisikli/memento/internal/backup"
+	"github.com/mahirisikli/memento/internal/capture"
 	"github.com/spf13/cobra"
 )
 
 type Config struct {
-	ScreenshotIntervalSeconds int           `json:"screenshot_interval_seconds"`
-	ScreenshotQuality         int           `json:"screenshot_quality"`
-	CaptureFullScreen         bool          `json:"capture_full_screen"`
-	OCRBatchIntervalMinutes   int           `json:"ocr_batch_interval_minutes"`
-	Backup                    BackupConfig  `json:"backup"`
-	StoragePath               string        `json:"storage_path"`
+	ScreenshotIntervalSeconds int                 `json:"screenshot_interval_seconds"`
+	ScreenshotQuality         int                 `json:"screenshot_quality"`
+	CaptureMode               string              `json:"capture_mode"`
+	CaptureMinIntervalSeconds int                 `json:"capture_min_interval_seconds"`
+	CaptureMaxIntervalSeconds int                 `json:"capture_max_interval_seconds"`
+	CaptureOnSwitch           bool                `json:"capture_on_switch"`
+	CaptureAfterTyping        bool                `json:"capture_after_typing"`
+	IdleTimeoutSeconds        int                 `json:"idle_timeout_seconds"`
+	OCRBatchIntervalMinutes   int                 `json:"ocr_batch_interval_minutes"`
+	OCRLanguages              []string            `json:"ocr_languages"`
+	OCRAppLanguages           map[string][]string `json:"ocr_app_languages,omitempty"`
+	Projects                  []ProjectRule       `json:"projects,omitempty"`
+	DigestEnabled             bool                `json:"digest_enabled"`
+	CompactScreenshots        bool                `json:"compact_screenshots"`
+	MaxStorageGB              float64             `json:"max_storage_gb,omitempty"`
+	Backup                    BackupConfig        `json:"backup"`
+	StoragePath               string              `json:"storage_path"`
+
+	projectsOnce    sync.Once
+	projectPatterns []*regexp.Regexp
+}
+
+// ProjectRule assigns time to a project when the window title, or with
+// Field "app" the app name, matches Pattern (a case-insensitive regexp).
+type ProjectRule struct {
+	Name    string `json:"name"`
+	Field   string `json:"field,omitempty"`
+	Pattern string `json:"pattern"`
 }
 
+// BackupConfig describes where backups go: Target "s3" (the default), an
+// S3-compatible bucket, or "local", a directory such as one on an external
+// drive. The R2 names are historical; any S3-compatible endpoint works.
 type BackupConfig struct {
-	Enabled    bool   `json:"enabled"`
-	Schedule   string `json:"schedule"`
-	R2Bucket   string `json:"r2_bucket"`
-	R2Endpoint string `json:"r2_endpoint"`
+	Enabled         bool   `json:"enabled"`
+	Schedule        string `json:"schedule"`
+	Target          string `json:"target,omitempty"`
+	Path            string `json:"path,omitempty"`
+	KeepDaily       int    `json:"keep_daily"`
+	KeepWeekly      int    `json:"keep_weekly"`
+	R2Bucket        string `json:"r2_bucket"`
+	R2Endpoint      string `json:"r2_endpoint"`
+	Region          string `json:"region,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+// S3Config returns the connection settings, with MEMENTO_S3_ENDPOINT,
+// MEMENTO_S3_BUCKET, MEMENTO_S3_REGION, AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY taking precedence over the config file.
+func (b BackupConfig) S3Config() backup.S3Config {
+	env := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+	return backup.S3Config{
+		Endpoint:        env("MEMENTO_S3_ENDPOINT", b.R2Endpoint),
+		Bucket:          env("MEMENTO_S3_BUCKET", b.R2Bucket),
+		Region:          env("MEMENTO_S3_REGION", env("AWS_REGION", b.Region)),
+		AccessKeyID:     env("AWS_ACCESS_KEY_ID", b.AccessKeyID),
+		SecretAccessKey: env("AWS_SECRET_ACCESS_KEY", b.SecretAccessKey),
+	}
+}
+
+// LocalPath returns Path with a leading ~ expanded.
+func (b BackupConfig) LocalPath() string {
+	if rest, ok := strings.CutPrefix(b.Path, "~"); ok && (rest == "" || rest[0] == '/') {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, rest)
+	}
+	return b.Path
 }
 
 func DefaultConfig() *Config {
@@ -30,11 +96,21 @@ func DefaultConfig() *Config {
 	return &Config{
 		ScreenshotIntervalSeconds: 600,
 		ScreenshotQuality:         80,
-		CaptureFullScreen:         false,
+		CaptureMode:               capture.ModeAllDisplays,
+		CaptureMinIntervalSeconds: 60,
+		CaptureMaxIntervalSeconds: 1800,
+		CaptureOnSwitch:           true,
+		CaptureAfterTyping:        true,
+		IdleTimeoutSeconds:        300,
 		OCRBatchIntervalMinutes:   60,
+		OCRLanguages:              []string{"en-US"},
+		DigestEnabled:             true,
+		CompactScreenshots:        true,
 		Backup: BackupConfig{
-			Enabled:  false,
-			Schedule: "daily",
+			Enabled:    false,
+			Schedule:   "daily",
+			KeepDaily:  7,
+			KeepWeekly: 4,
 		},
 		StoragePath: filepath.Join(home, ".memento"),
 	}
@@ -58,6 +134,57 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+// OCRLanguagesFor returns the OCR languages for screenshots of app, falling
+// back to the global list when the app has no override.
+func (c *Config) OCRLanguagesFor(app string) []string {
+	for name, langs := range c.OCRAppLanguages {
+		if len(langs) > 0 && strings.EqualFold(name, app) {
+			return langs
+		}
+	}
+	return c.OCRLanguages
+}
+
+// ProjectFor returns the first project whose rule matches app or title.
+func (c *Config) ProjectFor(app, title string) string {
+	// Patterns are compiled on first use; invalid ones never match
+	c.projectsOnce.Do(func() {
+		c.projectPatterns = make([]*regexp.Regexp, len(c.Projects))
+		for i, rule := range c.Projects {
+			c.projectPatterns[i], _ = regexp.Compile("(?i)" + rule.Pattern)
+		}
+	})
+	for i, rule := range c.Projects {
+		re := c.projectPatterns[i]
+		if re == nil {
+			continue
+		}
+		subject := title
+		if rule.Field == "app" {
+			subject = app
+		}
+		if re.MatchString(subject) {
+			return rule.Name
+		}
+	}
+	return ""
+}
+
+// MaxStorageBytes returns the storage limit in bytes, or 0 if there is none.
+func (c *Config) MaxStorageBytes() int64 {
+	return int64(c.MaxStorageGB * (1 << 30))
+}
+
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func SaveConfig(config *Config) error {
 	configPath := filepath.Join(getStoragePath(), "config.json")
 	
@@ -70,7 +197,11 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 	
-	return os.WriteFile(configPath, data, 0644)
+	// May hold backup credentials
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(configPath, 0600)
 }
 
 var configCmd = &cobra.Command{
@@ -87,6 +218,10 @@ var configShowCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 		
+		if config.Backup.SecretAccessKey != "" {
+			config.Backup.SecretAccessKey = "********"
+		}
+
 		format := getOutputFormat()
 		switch format {
 		case "json", "plain":
@@ -96,14 +231,57 @@ var configShowCmd = &cobra.Command{
 			fmt.Println("=====================")
 			fmt.Printf("Screenshot Interval: %d seconds\n", config.ScreenshotIntervalSeconds)
 			fmt.Printf("Screenshot Quality:  %d%%\n", config.ScreenshotQuality)
-			fmt.Printf("Capture Full Screen: %v\n", config.CaptureFullScreen)
+			fmt.Printf("Capture Mode:        %s\n", config.CaptureMode)
+			fmt.Printf("Capture Bounds:      %d-%d seconds\n", config.CaptureMinIntervalSeconds, config.CaptureMaxIntervalSeconds)
+			fmt.Printf("Capture On Switch:   %v\n", config.CaptureOnSwitch)
+			fmt.Printf("Capture On Typing:   %v\n", config.CaptureAfterTyping)
+			fmt.Printf("Idle Timeout:        %d seconds\n", config.IdleTimeoutSeconds)
 			fmt.Printf("OCR Batch Interval:  %d minutes\n", config.OCRBatchIntervalMinutes)
+			fmt.Printf("OCR Languages:       %s\n", strings.Join(config.OCRLanguages, ", "))
+			if len(config.OCRAppLanguages) > 0 {
+				apps := make([]string, 0, len(config.OCRAppLanguages))
+				for app := range config.OCRAppLanguages {
+					apps = append(apps, app)
+				}
+				sort.Strings(apps)
+				for _, app := range apps {
+					fmt.Printf("  %-18s %s\n", app+":", strings.Join(config.OCRAppLanguages[app], ", "))
+				}
+			}
+			if len(config.Projects) > 0 {
+				fmt.Println("Projects:")
+				for _, rule := range config.Projects {
+					field := rule.Field
+					if field == "" {
+						field = "title"
+					}
+					fmt.Printf("  %-18s %s ~ %s\n", rule.Name+":", field, rule.Pattern)
+				}
+			}
+			fmt.Printf("Daily Digest:        %v\n", config.DigestEnabled)
+			fmt.Printf("Compact Screenshots: %v\n", config.CompactScreenshots)
+			if config.MaxStorageGB > 0 {
+				fmt.Printf("Max Storage:         %g GB\n", config.MaxStorageGB)
+			} else {
+				fmt.Printf("Max Storage:         unlimited\n")
+			}
 			fmt.Printf("Storage Path:        %s\n", config.StoragePath)
 			fmt.Println()
 			fmt.Println("Backup:")
 			fmt.Printf("  Enabled:  %v\n", config.Backup.Enabled)
 			fmt.Printf("  Schedule: %s\n", config.Backup.Schedule)
-			fmt.Printf("  R2 Bucket: %s\n", config.Backup.R2Bucket)
+			if config.Backup.Target == "local" {
+				fmt.Printf("  Target:   local\n")
+				fmt.Printf("  Path:     %s\n", config.Backup.Path)
+			} else {
+				fmt.Printf("  Target:   s3\n")
+				fmt.Printf("  Bucket:   %s\n", config.Backup.R2Bucket)
+				fmt.Printf("  Endpoint: %s\n", config.Backup.R2Endpoint)
+				if config.Backup.Region != "" {
+					fmt.Printf("  Region:   %s\n", config.Backup.Region)
+				}
+			}
+			fmt.Printf("  Keep:     %d daily, %d weekly\n", config.Backup.KeepDaily, config.Backup.KeepWeekly)
 		}
 		return nil
 	},
@@ -131,18 +309,131 @@ var configSetCmd = &cobra.Command{
 			var v int
 			fmt.Sscanf(value, "%d", &v)
 			config.ScreenshotQuality = v
+		case "capture_mode":
+			if !capture.IsCaptureMode(value) {
+				return fmt.Errorf("unknown capture mode %q (expected one of: %s)", value, strings.Join(capture.CaptureModes, ", "))
+			}
+			config.CaptureMode = value
 		case "fullscreen":
-			config.CaptureFullScreen = value == "true" || value == "1"
+			// Older alias for capture_mode
+			if value == "true" || value == "1" {
+				config.CaptureMode = capture.ModeAllDisplays
+			} else {
+				config.CaptureMode = capture.ModeActiveWindow
+			}
+		case "min_interval":
+			var v int
+			fmt.Sscanf(value, "%d", &v)
+			config.CaptureMinIntervalSeconds = v
+		case "max_interval":
+			var v int
+			fmt.Sscanf(value, "%d", &v)
+			config.CaptureMaxIntervalSeconds = v
+		case "capture_on_switch":
+			config.CaptureOnSwitch = value == "true" || value == "1"
+		case "capture_after_typing":
+			config.CaptureAfterTyping = value == "true" || value == "1"
+		case "idle_timeout":
+			var v int
+			fmt.Sscanf(value, "%d", &v)
+			config.IdleTimeoutSeconds = v
 		case "ocr_interval":
 			var v int
 			fmt.Sscanf(value, "%d", &v)
 			config.OCRBatchIntervalMinutes = v
+		case "ocr_languages":
+			config.OCRLanguages = parseList(value)
+		case "ocr_app_languages":
+			// Format: "App=de-DE,tr-TR"; an empty list removes the override
+			app, langs, ok := strings.Cut(value, "=")
+			if !ok || strings.TrimSpace(app) == "" {
+				return fmt.Errorf("expected App=lang1,lang2, got %q", value)
+			}
+			app = strings.TrimSpace(app)
+			if config.OCRAppLanguages == nil {
+				config.OCRAppLanguages = make(map[string][]string)
+			}
+			if list := parseList(langs); len(list) > 0 {
+				config.OCRAppLanguages[app] = list
+			} else {
+				delete(config.OCRAppLanguages, app)
+			}
+		case "project":
+			// Format: "Name=pattern" matches window titles, "Name=app:pattern"
+			// app names; an empty pattern removes the project's rules
+			name, pattern, ok := strings.Cut(value, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("expected Name=pattern or Name=app:pattern, got %q", value)
+			}
+			name = strings.TrimSpace(name)
+			rule := ProjectRule{Name: name, Pattern: strings.TrimSpace(pattern)}
+			if p, ok := strings.CutPrefix(rule.Pattern, "app:"); ok {
+				rule.Field = "app"
+				rule.Pattern = p
+			} else if p, ok := strings.CutPrefix(rule.Pattern, "title:"); ok {
+				rule.Pattern = p
+			}
+			if rule.Pattern == "" {
+				var kept []ProjectRule
+				for _, r := range config.Projects {
+					if r.Name != name {
+						kept = append(kept, r)
+					}
+				}
+				config.Projects = kept
+				break
+			}
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("invalid project pattern %q: %w", rule.Pattern, err)
+			}
+			config.Projects = append(config.Projects, rule)
+		case "digest_enabled":
+			config.DigestEnabled = value == "true" || value == "1"
+		case "compact_screenshots":
+			config.CompactScreenshots = value == "true" || value == "1"
+		case "max_storage_gb":
+			// 0 removes the limit
+			var v float64
+			if _, err := fmt.Sscanf(value, "%g", &v); err != nil || v < 0 {
+				return fmt.Errorf("expected a size in GB, got %q", value)
+			}
+			config.MaxStorageGB = v
 		case "backup_enabled":
 			config.Backup.Enabled = value == "true" || value == "1"
-		case "r2_bucket":
+		case "backup_schedule":
+			if _, err := backup.ParseSchedule(value); err != nil {
+				return err
+			}
+			config.Backup.Schedule = value
+		case "backup_target":
+			if value != "s3" && value != "local" {
+				return fmt.Errorf("unknown backup target %q (expected s3 or local)", value)
+			}
+			config.Backup.Target = value
+		case "backup_path":
+			config.Backup.Path = value
+		case "backup_keep_daily":
+			var v int
+			if _, err := fmt.Sscanf(value, "%d", &v); err != nil || v < 0 {
+				return fmt.Errorf("expected a number of days, got %q", value)
+			}
+			config.Backup.KeepDaily = v
+		case "backup_keep_weekly":
+			var v int
+			if _, err := fmt.Sscanf(value, "%d", &v); err != nil || v < 0 {
+				return fmt.Errorf("expected a number of weeks, got %q", value)
+			}
+			config.Backup.KeepWeekly = v
+		case "r2_bucket", "s3_bucket":
 			config.Backup.R2Bucket = value
-		case "r2_endpoint":
+		case "r2_endpoint", "s3_endpoint":
 			config.Backup.R2Endpoint = value
+		case "s3_region":
+			config.Backup.Region = value
+		case "s3_access_key_id":
+			config.Backup.AccessKeyID = value
+		case "s3_secret_access_key":
+			config.Backup.SecretAccessKey = value
 		default:
 			return fmt.Errorf("unknown config key: %s", key)
 		}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/mahirisikli/memento/internal/backup"
 	"github.com/mahirisikli/memento/internal/capture"
 	"github.com/mahirisikli/memento/internal/ocr"
 	"github.com/mahirisikli/memento/internal/storage"
@@ -20,6 +22,7 @@ var (
 	screenshotInterval int
 	screenshotQuality  int
 	fullScreen         bool
+	daemonCaptureMode  string
 	enableKeylogger    bool
 	enableOCR          bool
 )
@@ -27,7 +30,8 @@ var (
 func init() {
 	startCmd.Flags().IntVar(&screenshotInterval, "interval", 600, "Screenshot interval in seconds")
 	startCmd.Flags().IntVar(&screenshotQuality, "quality", 80, "WebP quality (1-100)")
-	startCmd.Flags().BoolVar(&fullScreen, "fullscreen", false, "Capture full screen instead of active window")
+	startCmd.Flags().BoolVar(&fullScreen, "fullscreen", false, "Capture all displays (same as --mode all_displays)")
+	startCmd.Flags().StringVar(&daemonCaptureMode, "mode", "", "Capture mode: all_displays, active_display, active_window (default from config)")
 	startCmd.Flags().BoolVar(&enableKeylogger, "keys", true, "Enable keystroke logging")
 	startCmd.Flags().BoolVar(&enableOCR, "ocr", true, "Enable OCR processing")
 }
@@ -46,10 +50,16 @@ var startCmd = &cobra.Command{
 			if !cmd.Flags().Changed("quality") {
 				screenshotQuality = config.ScreenshotQuality
 			}
-			if !cmd.Flags().Changed("fullscreen") {
-				fullScreen = config.CaptureFullScreen
+			if !cmd.Flags().Changed("mode") {
+				daemonCaptureMode = config.CaptureMode
 			}
 		}
+		if fullScreen {
+			daemonCaptureMode = capture.ModeAllDisplays
+		}
+		if daemonCaptureMode != "" && !capture.IsCaptureMode(daemonCaptureMode) {
+			return fmt.Errorf("unknown capture mode %q (expected one of: %s)", daemonCaptureMode, strings.Join(capture.CaptureModes, ", "))
+		}
 		return runDaemon()
 	},
 }
@@ -126,19 +136,48 @@ func runDaemon() error {
 	// Screen recording permission is checked when we take the first screenshot
 	// The screencapture command will trigger the permission dialog if needed
 
-	db, err := storage.NewDB(storagePath)
+	db, err := openDB(storagePath)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
-	fm := storage.NewFileManager(storagePath)
+	fm, err := openFiles(storagePath)
+	if err != nil {
+		return err
+	}
+	if fm.Encrypted() {
+		log.Println("Archive is encrypted and unlocked")
+	}
 	if err := fm.EnsureLogsDir(); err != nil {
 		return fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
-	screenshotCapture := capture.NewScreenshotCapture(screenshotQuality, fullScreen)
+	// Load config for capture, OCR and backup settings
+	config, err := LoadConfig()
+	if err != nil {
+		log.Printf("Failed to load config, using defaults: %v", err)
+		config = DefaultConfig()
+	}
+
+	screenshotCapture := capture.NewScreenshotCapture(screenshotQuality, daemonCaptureMode)
+	screenshotCapture.SetFileWriter(fm.WriteImage)
 	ocrEngine := ocr.NewOCREngine()
+	defer ocrEngine.Close()
+
+	scheduler := capture.NewScheduler(capture.ScheduleConfig{
+		Interval:    time.Duration(screenshotInterval) * time.Second,
+		MinInterval: time.Duration(config.CaptureMinIntervalSeconds) * time.Second,
+		MaxInterval: time.Duration(config.CaptureMaxIntervalSeconds) * time.Second,
+		IdleTimeout: time.Duration(config.IdleTimeoutSeconds) * time.Second,
+	})
+	scheduler.OnPauseChange = func(paused bool, why string) {
+		if paused {
+			log.Printf("Capturing paused: %s", why)
+		} else {
+			log.Println("Capturing resumed")
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -169,10 +208,18 @@ func runDaemon() error {
 				ActiveWindowTitle: session.Window,
 				ActiveApp:         session.App,
 			}
-			if _, err := db.InsertTypingSession(ts); err != nil {
+			id, err := db.InsertTypingSession(ts)
+			if err != nil {
 				log.Printf("Failed to insert typing session: %v", err)
-			} else {
-				log.Printf("Typing session saved: %q (%d keys, %s)", truncate(session.Text, 50), session.KeyCount, session.App)
+				return
+			}
+			log.Printf("Typing session saved: %q (%d keys, %s)", truncate(session.Text, 50), session.KeyCount, session.App)
+			ts.ID = id
+			if err := storeTypingSessionEntities(db, ts); err != nil {
+				log.Printf("Failed to store entities for typing session %d: %v", id, err)
+			}
+			if config.CaptureAfterTyping {
+				scheduler.Trigger(capture.ReasonTyping)
 			}
 		})
 
@@ -208,91 +255,166 @@ func runDaemon() error {
 		}
 	}
 
-	screenshotTicker := time.NewTicker(time.Duration(screenshotInterval) * time.Second)
-	defer screenshotTicker.Stop()
-
 	ocrTicker := time.NewTicker(60 * time.Minute)
 	defer ocrTicker.Stop()
 
-	// Load config for backup settings
-	config, _ := LoadConfig()
 	var backupTicker *time.Ticker
-	var lastBackupDate string
+	var backupSchedule backup.Schedule
 
-	if config.Backup.Enabled && config.Backup.R2Bucket != "" {
-		// Check backup every hour, but only run once per day
-		backupTicker = time.NewTicker(1 * time.Hour)
-		log.Printf("Backup enabled: will sync to r2:%s daily", config.Backup.R2Bucket)
+	if config.Backup.Enabled {
+		target, err := backupTarget(config)
+		if err == nil {
+			backupSchedule, err = backup.ParseSchedule(config.Backup.Schedule)
+		}
+		if err != nil {
+			log.Printf("Backup disabled: %v", err)
+		} else {
+			// Checked often so a missed run is caught up soon after wake-up
+			backupTicker = time.NewTicker(5 * time.Minute)
+			log.Printf("Backup enabled: will back up to %s, schedule %q", target, config.Backup.Schedule)
+		}
 	}
 
 	runBackup := func() {
-		if config == nil || !config.Backup.Enabled || config.Backup.R2Bucket == "" {
+		if backupSchedule == nil {
 			return
 		}
-
-		// Only run once per day
-		today := time.Now().Format("2006-01-02")
-		if lastBackupDate == today {
+		history, err := backup.LoadHistory(backupHistoryPath(storagePath))
+		if err != nil {
+			log.Printf("Failed to load backup history: %v", err)
 			return
 		}
-
-		// Run backup between 2-4 AM to avoid interference
-		hour := time.Now().Hour()
-		if hour < 2 || hour > 4 {
+		if next := history.NextRun(backupSchedule, time.Now()); time.Now().Before(next) {
 			return
 		}
 
-		log.Println("Starting daily backup to R2...")
-		remotePath := fmt.Sprintf("r2:%s/memento", config.Backup.R2Bucket)
-
-		rcloneCmd := exec.Command("rclone", "sync", storagePath, remotePath,
-			"--exclude", "*.log",
-			"--exclude", ".venv/**",
-			"--exclude", "logs/**",
-		)
-
-		output, err := rcloneCmd.CombinedOutput()
+		log.Println("Starting scheduled backup...")
+		result, err := performBackup(ctx, config, storagePath, "schedule", nil)
 		if err != nil {
-			log.Printf("Backup failed: %v - %s", err, string(output))
+			log.Printf("Backup failed: %v", err)
+			if result != nil {
+				for _, e := range result.Errors {
+					log.Printf("Backup: %s", e)
+				}
+			}
 			return
 		}
 
-		lastBackupDate = today
-		log.Printf("Backup completed successfully to %s", remotePath)
+		history, _ = backup.LoadHistory(backupHistoryPath(storagePath))
+		log.Printf("Backup completed: snapshot %s, %d files copied (%s), %d unchanged; next run %s", result.Snapshot,
+			result.Uploaded, formatBytes(result.BytesUploaded), result.Skipped, history.NextRun(backupSchedule, time.Now()).Format("2006-01-02 15:04"))
+		if result.SnapshotsRemoved > 0 || result.ObjectsRemoved > 0 {
+			log.Printf("Backup: removed %d old snapshots and %d objects no snapshot uses (%s)",
+				result.SnapshotsRemoved, result.ObjectsRemoved, formatBytes(result.BytesRemoved))
+		}
 	}
 
-	captureScreenshot := func() {
-		windowInfo, _ := capture.GetActiveWindow()
-
-		filepath := fm.GetScreenshotPath(time.Now())
-		if err := fm.EnsureDir(filepath); err != nil {
-			log.Printf("Failed to create directory: %v", err)
+	// writeDigests saves the previous day's digest once the day is over.
+	// Digests quote typed text, so an encrypted archive gets none.
+	writeDigests := func() {
+		if !config.DigestEnabled || fm.Encrypted() {
+			return
+		}
+		yesterday := time.Now().AddDate(0, 0, -1)
+		path := filepath.Join(digestsDir(storagePath), yesterday.Format("2006-01-02")+".md")
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		screenshots, err := db.GetScreenshotsByDateRange(
+			time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, time.Local),
+			time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 23, 59, 59, 0, time.Local), 1)
+		if err != nil || len(screenshots) == 0 {
+			// Nothing was recorded that day
 			return
 		}
+		// The digest reads the day's stored activities; complete them first
+		// in case the daemon wasn't running all day
+		dayStart := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, time.Local)
+		if err := updateActivities(db, config, dayStart, dayStart.AddDate(0, 0, 1)); err != nil {
+			log.Printf("Failed to update activities: %v", err)
+		}
+		if _, err := writeDigest(db, fm, config, storagePath, yesterday); err != nil {
+			log.Printf("Failed to write digest: %v", err)
+			return
+		}
+		log.Printf("Digest written to %s", path)
+	}
 
-		result, err := screenshotCapture.CaptureToFile(filepath)
+	// compactScreenshots packs the oldest finished month of loose
+	// screenshots; a large backlog is worked through one month per hour.
+	// Months holding only files no row references are passed over.
+	compactScreenshots := func() {
+		if !config.CompactScreenshots {
+			return
+		}
+		months, err := compactableMonths(fm, time.Now())
 		if err != nil {
-			log.Printf("Failed to capture screenshot: %v", err)
+			log.Printf("Failed to list screenshot months: %v", err)
 			return
 		}
+		for _, month := range months {
+			result, err := fm.CompactMonth(db, month)
+			if err != nil {
+				log.Printf("Failed to compact %s: %v", month.Format("2006-01"), err)
+				return
+			}
+			if result.Images > 0 {
+				log.Printf("Compacted %s: %d images (%s) in %d segments", result.Month, result.Images, formatBytes(result.Bytes), len(result.Segments))
+				return
+			}
+		}
+	}
 
-		screenshot := &storage.Screenshot{
-			Timestamp: result.Timestamp,
-			Filepath:  filepath,
-			Width:     result.Width,
-			Height:    result.Height,
-			FileSize:  int64(len(result.Data)),
+	// enforceStorageLimit prunes the images of the oldest screenshots, keeping
+	// their text, while the storage directory is over max_storage_gb
+	enforceStorageLimit := func() {
+		limit := config.MaxStorageBytes()
+		if limit <= 0 {
+			return
+		}
+		usage, err := fm.DiskUsage()
+		if err != nil {
+			log.Printf("Failed to measure storage: %v", err)
+			return
+		}
+		if usage.Total <= limit {
+			return
+		}
+		result, err := fm.PruneImages(db, usage.Total-limit)
+		if err != nil {
+			log.Printf("Failed to prune screenshots: %v", err)
+			return
+		}
+		if result.Screenshots == 0 {
+			log.Printf("Storage is over its limit (%s of %s) but no screenshots can be pruned", formatBytes(usage.Total), formatBytes(limit))
+			return
 		}
-		if windowInfo != nil {
-			screenshot.ActiveWindowTitle = windowInfo.Title
-			screenshot.ActiveApp = windowInfo.App
+		log.Printf("Storage was over its limit (%s of %s): pruned the images of %d screenshots up to %s, freeing %s",
+			formatBytes(usage.Total), formatBytes(limit), result.Screenshots, result.Through.Format("2006-01-02 15:04"), formatBytes(result.Bytes))
+	}
+
+	// refreshActivities keeps today's activities up to date; in the first
+	// hour of a day it finishes the previous day's too
+	refreshActivities := func() {
+		now := time.Now()
+		since := now.Add(-time.Hour)
+		from := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, now.Location())
+		if err := updateActivities(db, config, from, now); err != nil {
+			log.Printf("Failed to update activities: %v", err)
 		}
+	}
 
-		if _, err := db.InsertScreenshot(screenshot); err != nil {
-			log.Printf("Failed to insert screenshot: %v", err)
-		} else {
-			log.Printf("Captured screenshot: %s (%dx%d)", filepath, result.Width, result.Height)
+	captureScreenshot := func(reason string) {
+		screenshot, result, err := captureAndStore(db, fm, screenshotCapture, reason)
+		if result != nil {
+			scheduler.Observe(result.Hash)
+		}
+		if err != nil {
+			log.Printf("Failed to capture screenshot: %v", err)
+			return
 		}
+		log.Printf("Captured screenshot: %s (%dx%d, %d displays, %s; next in %s)",
+			screenshot.Filepath, result.Width, result.Height, len(result.Displays), reason, scheduler.Interval())
 	}
 
 	processOCR := func() {
@@ -307,23 +429,57 @@ func runDaemon() error {
 		}
 
 		for _, s := range screenshots {
-			text, err := ocrEngine.ExtractText(s.Filepath)
-			if err != nil {
+			if err := ocrScreenshot(db, fm, ocrEngine, config, &s); err != nil {
 				log.Printf("OCR failed for %s: %v", s.Filepath, err)
 				continue
 			}
-			if err := db.UpdateScreenshotOCR(s.ID, text); err != nil {
-				log.Printf("Failed to update OCR: %v", err)
+			log.Printf("OCR processed: %s (%d chars, %s)", s.Filepath, len(s.OCRText), s.OCRLanguage)
+		}
+	}
+
+	focusTracker := capture.NewFocusTracker(&capture.PollingWindowProvider{Interval: 2 * time.Second},
+		time.Duration(config.IdleTimeoutSeconds)*time.Second, func(e capture.FocusEvent) {
+			_, err := db.InsertFocusEvent(&storage.FocusEvent{
+				StartTime:         e.Start,
+				EndTime:           e.End,
+				ActiveApp:         e.App,
+				ActiveWindowTitle: e.Title,
+			})
+			if err != nil {
+				log.Printf("Failed to insert focus event: %v", err)
+			}
+		})
+	if config.CaptureOnSwitch {
+		focusTracker.OnSwitch = func(prev, cur *capture.WindowInfo) {
+			if prev.App != cur.App {
+				scheduler.Trigger(capture.ReasonAppSwitch)
 			} else {
-				log.Printf("OCR processed: %s (%d chars)", s.Filepath, len(text))
+				scheduler.Trigger(capture.ReasonWindowSwitch)
 			}
 		}
 	}
+	focusDone := make(chan struct{})
+	go func() {
+		focusTracker.Run(ctx)
+		close(focusDone)
+	}()
+	// Let the tracker record the last focus event before the database closes
+	defer func() {
+		cancel()
+		<-focusDone
+	}()
 
 	log.Println("Taking initial screenshot...")
-	captureScreenshot()
+	go scheduler.Run(ctx, captureScreenshot)
+
+	log.Printf("Daemon running. Screenshot interval: %ds (adaptive between %ds and %ds)",
+		screenshotInterval, config.CaptureMinIntervalSeconds, config.CaptureMaxIntervalSeconds)
 
-	log.Printf("Daemon running. Screenshot interval: %ds", screenshotInterval)
+	refreshActivities()
+	writeDigests()
+	enforceStorageLimit()
+	hourlyTicker := time.NewTicker(1 * time.Hour)
+	defer hourlyTicker.Stop()
 
 	// Create a nil channel if backup is disabled (will never receive)
 	var backupChan <-chan time.Time
@@ -336,12 +492,15 @@ func runDaemon() error {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-screenshotTicker.C:
-			captureScreenshot()
 		case <-ocrTicker.C:
 			processOCR()
 		case <-backupChan:
 			runBackup()
+		case <-hourlyTicker.C:
+			refreshActivities()
+			writeDigests()
+			compactScreenshots()
+			enforceStorageLimit()
 		}
 	}
 }
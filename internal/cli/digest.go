@@ -0,0 +1,392 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/extract"
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Blocks shorter than this are left out of the timeline
+	digestMinBlock = 2 * time.Minute
+	digestTopTyped = 10
+	digestTopLinks = 30
+)
+
+var (
+	digestDate string
+	digestSave bool
+)
+
+func init() {
+	digestCmd.Flags().StringVar(&digestDate, "date", "", "Day to summarize, e.g. 2026-01-15 (default today)")
+	digestCmd.Flags().BoolVar(&digestSave, "save", false, "Write the digest to the digests directory instead of printing it")
+}
+
+var digestCmd = &cobra.Command{
+	Use:   "digest",
+	Short: "Write a Markdown journal entry for a day",
+	Long: `Summarize a day as a Markdown journal: the timeline grouped into activity blocks,
+top apps by time, notable typed text with secrets redacted, links seen on screen
+and thumbnails of key screenshots.
+
+With --save the digest is written to ~/.memento/digests/<date>.md. The daemon
+writes the previous day's digest automatically unless digest_enabled is false.
+Digests of an encrypted archive are only printed, never saved, since they
+quote its text in plaintext.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		day := now
+		if digestDate != "" {
+			parsed := parseRelativeTime(digestDate, now)
+			if parsed.IsZero() {
+				return fmt.Errorf("invalid date %q", digestDate)
+			}
+			day = parsed
+		}
+
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
+		}
+
+		if digestSave {
+			path, err := writeDigest(db, fm, config, storagePath, day)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Digest written to %s\n", path)
+			return nil
+		}
+
+		digest, err := buildDigest(db, fm, config, day)
+		if err != nil {
+			return err
+		}
+
+		switch getOutputFormat() {
+		case "json", "plain":
+			outputJSON(digest)
+		default:
+			fmt.Print(renderDigest(digest, ""))
+		}
+		return nil
+	},
+}
+
+type Digest struct {
+	Date         string          `json:"date"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	TotalSeconds float64         `json:"total_seconds"`
+	Keystrokes   int             `json:"keystrokes"`
+	Screenshots  int             `json:"screenshots"`
+	Blocks       []DigestBlock   `json:"blocks"`
+	Apps         []ReportRow     `json:"apps"`
+	Typed        []DigestTyped   `json:"typed"`
+	Links        []*uniqueEntity `json:"links"`
+}
+
+// DigestBlock is one activity of the day, named after its project or app.
+type DigestBlock struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Name       string    `json:"name"`
+	Seconds    float64   `json:"seconds"`
+	Apps       []string  `json:"apps"`
+	Titles     []string  `json:"titles"`
+	Keywords   []string  `json:"keywords,omitempty"`
+	Screenshot string    `json:"screenshot,omitempty"`
+}
+
+type DigestTyped struct {
+	Time   time.Time `json:"time"`
+	App    string    `json:"app"`
+	Window string    `json:"window,omitempty"`
+	Keys   int       `json:"keys"`
+	Text   string    `json:"text"`
+}
+
+func buildDigest(db *storage.DB, fm *storage.FileManager, config *Config, day time.Time) (*Digest, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 0, 1)
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+
+	report, err := buildReport(db, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+	digest := &Digest{
+		Date:         from.Format("2006-01-02"),
+		From:         from,
+		To:           to,
+		TotalSeconds: report.TotalSeconds,
+		Keystrokes:   report.Keystrokes,
+		Apps:         report.Apps,
+	}
+
+	screenshots, err := db.GetScreenshotsByDateRange(from, to, 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get screenshots: %w", err)
+	}
+	digest.Screenshots = len(screenshots)
+
+	activities, err := loadActivities(db, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+	digest.Blocks = digestBlocks(db, fm, config, activities, screenshots)
+
+	sessions, err := db.GetTypingSessionsByDateRange(from, to, "", 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get typing sessions: %w", err)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].KeyCount > sessions[j].KeyCount
+	})
+	for _, s := range sessions {
+		if len(digest.Typed) >= digestTopTyped {
+			break
+		}
+		text := strings.TrimSpace(extract.Redact(s.Text))
+		if len(strings.Fields(text)) < 3 {
+			continue
+		}
+		digest.Typed = append(digest.Typed, DigestTyped{
+			Time:   s.StartTime,
+			App:    s.ActiveApp,
+			Window: s.ActiveWindowTitle,
+			Keys:   s.KeyCount,
+			Text:   truncate(text, 400),
+		})
+	}
+	sort.SliceStable(digest.Typed, func(i, j int) bool {
+		return digest.Typed[i].Time.Before(digest.Typed[j].Time)
+	})
+
+	entities, err := db.GetEntities(extract.TypeURL, "", from, to, "", 10000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+	// URLs seen on screen can carry tokens and credentials
+	for i := range entities {
+		entities[i].Value = extract.Redact(entities[i].Value)
+	}
+	digest.Links = uniqueEntities(entities)
+	if len(digest.Links) > digestTopLinks {
+		digest.Links = digest.Links[:digestTopLinks]
+	}
+	return digest, nil
+}
+
+func digestBlocks(db *storage.DB, fm *storage.FileManager, config *Config, activities []storage.Activity, screenshots []storage.Screenshot) []DigestBlock {
+	var blocks []DigestBlock
+	for _, a := range activities {
+		if a.DurationSeconds < digestMinBlock.Seconds() {
+			continue
+		}
+		title := ""
+		if len(a.Titles) > 0 {
+			title = a.Titles[0]
+		}
+		name := config.ProjectFor(a.DominantApp, title)
+		if name == "" {
+			name = a.DominantApp
+		}
+		titles := a.Titles
+		if len(titles) > 3 {
+			titles = titles[:3]
+		}
+		blocks = append(blocks, DigestBlock{
+			Start:      a.StartTime,
+			End:        a.EndTime,
+			Name:       name,
+			Seconds:    a.DurationSeconds,
+			Apps:       a.Apps,
+			Titles:     titles,
+			Keywords:   a.Keywords,
+			Screenshot: digestThumbnail(db, fm, keyScreenshot(screenshots, a.StartTime, a.EndTime)),
+		})
+	}
+	return blocks
+}
+
+// keyScreenshot picks the screenshot closest to the middle of a block,
+// passing over those whose image was pruned.
+func keyScreenshot(screenshots []storage.Screenshot, start, end time.Time) *storage.Screenshot {
+	mid := start.Add(end.Sub(start) / 2)
+	var best *storage.Screenshot
+	var bestDist time.Duration
+	for i, s := range screenshots {
+		if s.PrunedAt != nil || s.Timestamp.Before(start) || s.Timestamp.After(end) {
+			continue
+		}
+		dist := s.Timestamp.Sub(mid)
+		if dist < 0 {
+			dist = -dist
+		}
+		if best == nil || dist < bestDist {
+			best = &screenshots[i]
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+// digestThumbnail returns the thumbnail of s for the digest to link to. The
+// screenshot itself may be packed into a segment, so only its thumbnail is a
+// file a Markdown viewer can open; with the archive encrypted not even that
+// is, and there is no link.
+func digestThumbnail(db *storage.DB, fm *storage.FileManager, s *storage.Screenshot) string {
+	if s == nil || fm.Encrypted() {
+		return ""
+	}
+	path, err := ensureThumbnail(db, fm, s)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// renderDigest formats a digest as Markdown. With linkDir set, thumbnail
+// links are made relative to it so the file stays valid if the storage
+// directory moves.
+func renderDigest(d *Digest, linkDir string) string {
+	link := func(path string) string {
+		if linkDir != "" {
+			if rel, err := filepath.Rel(linkDir, path); err == nil {
+				path = rel
+			}
+		}
+		return strings.ReplaceAll(path, " ", "%20")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", d.From.Format("Monday, 2 January 2006"))
+	if d.TotalSeconds == 0 && d.Keystrokes == 0 && d.Screenshots == 0 {
+		b.WriteString("No activity recorded.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Tracked **%s** · %d keystrokes · %d screenshots\n",
+		formatDuration(secondsDuration(d.TotalSeconds)), d.Keystrokes, d.Screenshots)
+
+	if len(d.Blocks) > 0 {
+		b.WriteString("\n## Timeline\n")
+		for _, block := range d.Blocks {
+			fmt.Fprintf(&b, "\n### %s–%s · %s (%s)\n\n", block.Start.Format("15:04"), block.End.Format("15:04"),
+				markdownEscape(block.Name), formatDuration(secondsDuration(block.Seconds)))
+			fmt.Fprintf(&b, "- Apps: %s\n", markdownEscape(strings.Join(block.Apps, ", ")))
+			for _, title := range block.Titles {
+				fmt.Fprintf(&b, "- %s\n", markdownEscape(truncate(title, 100)))
+			}
+			if len(block.Keywords) > 0 {
+				fmt.Fprintf(&b, "- Keywords: %s\n", markdownEscape(strings.Join(block.Keywords, ", ")))
+			}
+			if block.Screenshot != "" {
+				fmt.Fprintf(&b, "\n[![%s](%s)](%s)\n", block.Start.Format("15:04"), link(block.Screenshot), link(block.Screenshot))
+			}
+		}
+	}
+
+	if len(d.Apps) > 0 {
+		b.WriteString("\n## Top apps\n\n| App | Time | Share | Keys |\n|-----|------|-------|------|\n")
+		for i, app := range d.Apps {
+			if i >= 10 {
+				break
+			}
+			fmt.Fprintf(&b, "| %s | %s | %.0f%% | %d |\n", markdownEscape(app.Name),
+				formatDuration(secondsDuration(app.Seconds)), 100*app.Share, app.Keystrokes)
+		}
+	}
+
+	if len(d.Typed) > 0 {
+		b.WriteString("\n## Typed\n")
+		for _, t := range d.Typed {
+			fmt.Fprintf(&b, "\n**%s** · %s", t.Time.Format("15:04"), markdownEscape(t.App))
+			if t.Window != "" {
+				fmt.Fprintf(&b, " — %s", markdownEscape(truncate(t.Window, 60)))
+			}
+			b.WriteString("\n\n")
+			for _, line := range strings.Split(t.Text, "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+		}
+	}
+
+	if len(d.Links) > 0 {
+		b.WriteString("\n## Links\n\n")
+		for _, l := range d.Links {
+			url := l.Value
+			if !strings.Contains(url, "://") {
+				url = "https://" + url
+			}
+			fmt.Fprintf(&b, "- <%s> (%dx, first at %s)\n", url, l.Count, l.FirstSeen.Format("15:04"))
+		}
+	}
+	return b.String()
+}
+
+func markdownEscape(s string) string {
+	r := strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]", "#", "\\#")
+	return r.Replace(s)
+}
+
+func digestsDir(storagePath string) string {
+	return filepath.Join(storagePath, "digests")
+}
+
+// writeDigest renders the digest for day into the digests directory and
+// returns the file's path.
+func writeDigest(db *storage.DB, fm *storage.FileManager, config *Config, storagePath string, day time.Time) (string, error) {
+	if fm.Encrypted() {
+		return "", fmt.Errorf("digests of an encrypted archive aren't saved, since they would quote its text in plaintext. Print one with: memento digest")
+	}
+	digest, err := buildDigest(db, fm, config, day)
+	if err != nil {
+		return "", err
+	}
+	dir := digestsDir(storagePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create digests directory: %w", err)
+	}
+	path := filepath.Join(dir, digest.Date+".md")
+	if err := os.WriteFile(path, []byte(renderDigest(digest, dir)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write digest: %w", err)
+	}
+	return path, nil
+}
+
+// removeDigests deletes the saved digests, which quote typed text in
+// plaintext, and returns how many it deleted.
+func removeDigests(storagePath string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(digestsDir(storagePath), "*.md"))
+	if err != nil {
+		return 0, err
+	}
+	for i, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return i, err
+		}
+	}
+	return len(paths), nil
+}
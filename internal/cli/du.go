@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// growthWindow is how far back memento du looks to project growth.
+const growthWindow = 30 * 24 * time.Hour
+
+var duTop int
+
+func init() {
+	duCmd.Flags().IntVar(&duTop, "top", 10, "Apps to list in text output (0 for all)")
+}
+
+// DiskUsage is the report of memento du. Years, months and apps count the
+// screenshots that still have their images.
+type DiskUsage struct {
+	Path   string               `json:"path"`
+	Usage  *storage.Usage       `json:"usage"`
+	Limit  int64                `json:"limit,omitempty"`
+	Years  []storage.ImageUsage `json:"years"`
+	Months []storage.ImageUsage `json:"months"`
+	Apps   []storage.ImageUsage `json:"apps"`
+	Pruned int                  `json:"pruned_screenshots"`
+	Growth *StorageGrowth       `json:"growth,omitempty"`
+}
+
+// StorageGrowth projects how fast screenshots take up space from the
+// captures of the last Days days. With a storage limit, LimitInDays is when
+// it will be reached and RetainedDays how many days of screenshots fit.
+type StorageGrowth struct {
+	Days         float64 `json:"days"`
+	PerDay       int64   `json:"bytes_per_day"`
+	PerMonth     int64   `json:"bytes_per_month"`
+	PerYear      int64   `json:"bytes_per_year"`
+	LimitInDays  float64 `json:"limit_in_days,omitempty"`
+	RetainedDays float64 `json:"retained_days,omitempty"`
+}
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show what takes up disk space",
+	Long: `Show the size of the storage directory split into the database, screenshots,
+thumbnails and everything else; the size of the screenshots per year, month and
+app; and how fast screenshots grow, projected from the last 30 days of
+captures.
+
+With max_storage_gb set, also show when the limit will be reached and how many
+days of screenshots fit within it. Once over the limit, the daemon deletes the
+images of the oldest screenshots, keeping their text:
+
+  memento config set max_storage_gb 10`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		storagePath := getStoragePath()
+		// Sizes only, so an encrypted archive needn't be unlocked
+		db, err := storage.NewDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+
+		report, err := buildDiskUsage(db, storage.NewFileManager(storagePath), config.MaxStorageBytes(), time.Now())
+		if err != nil {
+			return err
+		}
+		report.Path = storagePath
+
+		switch getOutputFormat() {
+		case "json":
+			outputJSON(report)
+		case "plain":
+			headers := []string{"group", "name", "screenshots", "bytes"}
+			rows := [][]string{
+				{"storage", "total", "", fmt.Sprintf("%d", report.Usage.Total)},
+				{"storage", "database", "", fmt.Sprintf("%d", report.Usage.Database)},
+				{"storage", "screenshots", "", fmt.Sprintf("%d", report.Usage.Screenshots)},
+				{"storage", "thumbnails", "", fmt.Sprintf("%d", report.Usage.Thumbnails)},
+				{"storage", "other", "", fmt.Sprintf("%d", report.Usage.Other)},
+			}
+			for _, group := range []struct {
+				name string
+				rows []storage.ImageUsage
+			}{{"year", report.Years}, {"month", report.Months}, {"app", report.Apps}} {
+				for _, u := range group.rows {
+					rows = append(rows, []string{group.name, u.Name, fmt.Sprintf("%d", u.Screenshots), fmt.Sprintf("%d", u.Bytes)})
+				}
+			}
+			outputPlain(headers, rows)
+		default:
+			outputDiskUsageText(report)
+		}
+		return nil
+	},
+}
+
+func buildDiskUsage(db *storage.DB, fm *storage.FileManager, limit int64, now time.Time) (*DiskUsage, error) {
+	usage, err := fm.DiskUsage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure storage: %w", err)
+	}
+	report := &DiskUsage{Usage: usage, Limit: limit}
+
+	if report.Months, err = db.ImageUsageByMonth(); err != nil {
+		return nil, fmt.Errorf("failed to get usage per month: %w", err)
+	}
+	if report.Apps, err = db.ImageUsageByApp(); err != nil {
+		return nil, fmt.Errorf("failed to get usage per app: %w", err)
+	}
+	if report.Pruned, err = db.CountPrunedScreenshots(); err != nil {
+		return nil, fmt.Errorf("failed to count pruned screenshots: %w", err)
+	}
+	for _, m := range report.Months {
+		year := m.Name
+		if len(year) > 4 {
+			year = year[:4]
+		}
+		if n := len(report.Years); n > 0 && report.Years[n-1].Name == year {
+			report.Years[n-1].Screenshots += m.Screenshots
+			report.Years[n-1].Bytes += m.Bytes
+		} else {
+			report.Years = append(report.Years, storage.ImageUsage{Name: year, Screenshots: m.Screenshots, Bytes: m.Bytes})
+		}
+	}
+
+	bytes, first, err := db.ImageBytesSince(now.Add(-growthWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent captures: %w", err)
+	}
+	if bytes > 0 {
+		// A younger archive is measured over its whole life, at least a day
+		days := max(now.Sub(first).Hours()/24, 1)
+		perDay := float64(bytes) / days
+		growth := &StorageGrowth{
+			Days:     days,
+			PerDay:   int64(perDay),
+			PerMonth: int64(perDay * 30),
+			PerYear:  int64(perDay * 365),
+		}
+		if limit > 0 {
+			if usage.Total < limit {
+				growth.LimitInDays = float64(limit-usage.Total) / perDay
+			}
+			// Pruning only frees the space of screenshots
+			if room := limit - (usage.Total - usage.Screenshots); room > 0 {
+				growth.RetainedDays = float64(room) / perDay
+			}
+		}
+		report.Growth = growth
+	}
+	return report, nil
+}
+
+func outputDiskUsageText(report *DiskUsage) {
+	u := report.Usage
+	fmt.Printf("Storage: %s\n", report.Path)
+	limit := ""
+	if report.Limit > 0 {
+		limit = fmt.Sprintf(" (%.0f%% of the %s limit)", float64(u.Total)*100/float64(report.Limit), formatBytes(report.Limit))
+	}
+	fmt.Printf("  %-12s %10s%s\n", "Total", formatBytes(u.Total), limit)
+	fmt.Printf("  %-12s %10s\n", "Database", formatBytes(u.Database))
+	fmt.Printf("  %-12s %10s\n", "Screenshots", formatBytes(u.Screenshots))
+	fmt.Printf("  %-12s %10s\n", "Thumbnails", formatBytes(u.Thumbnails))
+	fmt.Printf("  %-12s %10s\n", "Other", formatBytes(u.Other))
+
+	section := func(title string, rows []storage.ImageUsage, top int) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", title)
+		for i, r := range rows {
+			if top > 0 && i == top {
+				fmt.Printf("  ... and %d more\n", len(rows)-top)
+				break
+			}
+			name := r.Name
+			if name == "" {
+				name = "(unknown)"
+			}
+			fmt.Printf("  %-24s %10s  %6d screenshots\n", truncate(name, 24), formatBytes(r.Bytes), r.Screenshots)
+		}
+	}
+	section("By year", report.Years, 0)
+	section("By month", report.Months, 0)
+	section("By app", report.Apps, duTop)
+
+	if g := report.Growth; g != nil {
+		fmt.Printf("\nGrowth: %s/day, %s/month, %s/year (last %.0f days)\n",
+			formatBytes(g.PerDay), formatBytes(g.PerMonth), formatBytes(g.PerYear), g.Days)
+		if report.Limit > 0 {
+			if g.LimitInDays > 0 {
+				fmt.Printf("  The limit is reached in about %.0f days.\n", g.LimitInDays)
+			}
+			if g.RetainedDays > 0 {
+				fmt.Printf("  At the limit, about %.0f days of screenshots are kept.\n", g.RetainedDays)
+			} else {
+				fmt.Println("  The database and thumbnails alone exceed the limit.")
+			}
+		}
+	}
+	if report.Pruned > 0 {
+		fmt.Printf("\n%d screenshots were pruned to stay within the limit; their text is kept.\n", report.Pruned)
+	}
+}
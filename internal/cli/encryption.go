@@ -0,0 +1,366 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// archivePassphraseEnv holds the archive passphrase for unattended use.
+const archivePassphraseEnv = "MEMENTO_ARCHIVE_PASSPHRASE"
+
+// keychainService is the Keychain item the archive key is kept under; the
+// account is the storage path.
+const keychainService = "memento archive key"
+
+var (
+	encryptionKeychain bool
+	encryptionKeyFile  string
+)
+
+// archiveCiphers caches unlocked archives so the passphrase is asked once
+// per command.
+var archiveCiphers = make(map[string]*storage.Cipher)
+
+// unlockArchive returns the cipher of an encrypted archive, or nil if the
+// archive isn't encrypted. The key is taken from the key file or Keychain
+// when set up, otherwise from the passphrase in MEMENTO_ARCHIVE_PASSPHRASE
+// or asked for on the terminal.
+func unlockArchive(storagePath string) (*storage.Cipher, error) {
+	if c, ok := archiveCiphers[storagePath]; ok {
+		return c, nil
+	}
+	enc, err := storage.LoadEncryption(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archive encryption: %w", err)
+	}
+	if enc == nil {
+		archiveCiphers[storagePath] = nil
+		return nil, nil
+	}
+
+	var key []byte
+	if enc.KeyFile != "" {
+		if k, err := storage.ReadKeyFile(enc.KeyFile); err == nil && enc.CheckKey(k) == nil {
+			key = k
+		}
+	}
+	if key == nil && enc.Keychain {
+		if k, err := keychainKey(storagePath); err == nil && enc.CheckKey(k) == nil {
+			key = k
+		}
+	}
+	if key == nil {
+		passphrase, err := readPassphrase(archivePassphraseEnv, "Archive passphrase: ", false)
+		if err != nil {
+			return nil, fmt.Errorf("the archive is encrypted: %w", err)
+		}
+		if key, err = enc.OpenPassphrase(passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := storage.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	archiveCiphers[storagePath] = c
+	return c, nil
+}
+
+// openDB opens the database and unlocks it if the archive is encrypted.
+func openDB(storagePath string) (*storage.DB, error) {
+	db, err := storage.NewDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	c, err := unlockArchive(storagePath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.SetCipher(c)
+	return db, nil
+}
+
+// openFiles returns a FileManager for the storage directory, unlocked if
+// the archive is encrypted.
+func openFiles(storagePath string) (*storage.FileManager, error) {
+	fm := storage.NewFileManager(storagePath)
+	c, err := unlockArchive(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	fm.SetCipher(c)
+	return fm, nil
+}
+
+func keychainAccount(storagePath string) string {
+	if abs, err := filepath.Abs(storagePath); err == nil {
+		return abs
+	}
+	return storagePath
+}
+
+// keychainKey reads the archive key from the login Keychain.
+func keychainKey(storagePath string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", keychainAccount(storagePath), "-w").Output()
+	if err != nil {
+		return nil, fmt.Errorf("archive key not found in Keychain: %w", err)
+	}
+	return hex.DecodeString(strings.TrimSpace(string(out)))
+}
+
+// storeKeychainKey adds the archive key to the login Keychain. The command
+// goes to security on stdin so the key doesn't show up in the process list.
+func storeKeychainKey(storagePath string, key []byte) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %s\n",
+		keychainService, keychainAccount(storagePath), hex.EncodeToString(key)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store archive key in Keychain: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Encrypt the archive at rest",
+}
+
+var encryptionInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Encrypt the archive with a new key",
+	Long: `Encrypt typed text, OCR text, screenshots and thumbnails with AES-256-GCM
+under a new archive key, then encrypt what the archive already holds.
+
+The key is sealed with a passphrase in ~/.memento/encryption.json. Commands
+that read the archive ask for the passphrase, or read it from
+MEMENTO_ARCHIVE_PASSPHRASE. To let the daemon unlock the archive at start
+without a prompt, also keep the key in the Keychain or in a key file, e.g. on
+a removable drive:
+
+  memento encryption init --keychain
+  memento encryption init --key-file /Volumes/KEY/memento.key
+
+Activity keywords and extracted entities are encrypted with the text they
+come from. Saved digests are deleted and no longer written; memento digest
+still prints them. Timestamps, apps and window titles stay readable, so
+timelines and reports work as before; text search decrypts as it goes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		if enc, err := storage.LoadEncryption(storagePath); err != nil {
+			return fmt.Errorf("failed to load archive encryption: %w", err)
+		} else if enc != nil {
+			return fmt.Errorf("the archive is already encrypted. Use: memento encryption apply")
+		}
+
+		keyFile := ""
+		if encryptionKeyFile != "" {
+			abs, err := filepath.Abs(encryptionKeyFile)
+			if err != nil {
+				return err
+			}
+			absStorage, _ := filepath.Abs(storagePath)
+			if rel, err := filepath.Rel(absStorage, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				return fmt.Errorf("the key file must be outside %s, which is backed up", storagePath)
+			}
+			keyFile = abs
+		}
+
+		passphrase, err := readPassphrase(archivePassphraseEnv, "New archive passphrase: ", true)
+		if err != nil {
+			return err
+		}
+		key, err := storage.NewArchiveKey()
+		if err != nil {
+			return err
+		}
+		enc, err := storage.NewEncryption(key, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to seal archive key: %w", err)
+		}
+		if encryptionKeychain {
+			if err := storeKeychainKey(storagePath, key); err != nil {
+				return err
+			}
+			enc.Keychain = true
+		}
+		if keyFile != "" {
+			if err := storage.WriteKeyFile(keyFile, key); err != nil {
+				return fmt.Errorf("failed to write key file: %w", err)
+			}
+			enc.KeyFile = keyFile
+		}
+		if err := os.MkdirAll(storagePath, 0755); err != nil {
+			return err
+		}
+		if err := enc.Save(storagePath); err != nil {
+			return fmt.Errorf("failed to save archive encryption: %w", err)
+		}
+
+		c, err := storage.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		archiveCiphers[storagePath] = c
+		if err := encryptArchive(storagePath); err != nil {
+			return err
+		}
+		if getOutputFormat() != "json" {
+			fmt.Println("Keep the passphrase safe: without it, the archive can't be read.")
+			fmt.Println("Restart the daemon so new captures are encrypted, then run memento encryption apply once more.")
+		}
+		return nil
+	},
+}
+
+var encryptionApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Encrypt what the archive still holds in plaintext",
+	Long: `Encrypt the text and images still stored in plaintext, such as what a daemon
+started before memento encryption init wrote, and delete saved digests.
+Segments are rewritten with their images encrypted. Safe to interrupt and
+run again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		if c, err := unlockArchive(storagePath); err != nil {
+			return err
+		} else if c == nil {
+			return fmt.Errorf("the archive isn't encrypted. Use: memento encryption init")
+		}
+		return encryptArchive(storagePath)
+	},
+}
+
+// encryptArchive encrypts the plaintext text and images of an unlocked
+// archive and reports what it did.
+func encryptArchive(storagePath string) error {
+	db, err := openDB(storagePath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	fm, err := openFiles(storagePath)
+	if err != nil {
+		return err
+	}
+
+	texts, err := db.EncryptText()
+	if err != nil {
+		return err
+	}
+	var progress func(string)
+	if getOutputFormat() == "text" {
+		var files int
+		progress = func(path string) {
+			files++
+			fmt.Printf("\r%d files encrypted", files)
+		}
+	}
+	result, err := fm.EncryptImages(db, progress)
+	if progress != nil && result.Images > 0 {
+		fmt.Println()
+	}
+	if err != nil {
+		return err
+	}
+	result.Texts = texts
+	if result.Digests, err = removeDigests(storagePath); err != nil {
+		return fmt.Errorf("failed to remove digests: %w", err)
+	}
+
+	switch getOutputFormat() {
+	case "json":
+		outputJSON(result)
+	case "plain":
+		fmt.Printf("%d\t%d\t%d\t%d\n", result.Texts, result.Images, result.Segments, result.Digests)
+	default:
+		fmt.Printf("Encrypted %d texts and %d images (%d segments rewritten)\n", result.Texts, result.Images, result.Segments)
+		if result.Digests > 0 {
+			fmt.Printf("Deleted %d saved digests, which quoted typed text in plaintext\n", result.Digests)
+		}
+	}
+	return nil
+}
+
+var encryptionStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the archive is encrypted and how it unlocks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		enc, err := storage.LoadEncryption(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to load archive encryption: %w", err)
+		}
+
+		status := map[string]interface{}{"encrypted": enc != nil}
+		var unlock []string
+		if enc != nil {
+			unlock = append(unlock, "passphrase")
+			if enc.Keychain {
+				available := false
+				if k, err := keychainKey(storagePath); err == nil && enc.CheckKey(k) == nil {
+					available = true
+				}
+				status["keychain"] = available
+				unlock = append(unlock, "keychain")
+			}
+			if enc.KeyFile != "" {
+				available := false
+				if k, err := storage.ReadKeyFile(enc.KeyFile); err == nil && enc.CheckKey(k) == nil {
+					available = true
+				}
+				status["key_file"] = enc.KeyFile
+				status["key_file_available"] = available
+				unlock = append(unlock, "key file")
+			}
+			status["unlock"] = unlock
+		}
+
+		switch getOutputFormat() {
+		case "json":
+			outputJSON(status)
+		case "plain":
+			fmt.Printf("%v\t%s\n", enc != nil, strings.Join(unlock, ","))
+		default:
+			if enc == nil {
+				fmt.Println("The archive isn't encrypted. Use: memento encryption init")
+				return nil
+			}
+			fmt.Println("Archive Encryption")
+			fmt.Println("==================")
+			fmt.Printf("Encrypted: yes (AES-256-GCM)\n")
+			fmt.Printf("Unlock:    %s\n", strings.Join(unlock, ", "))
+			if enc.Keychain {
+				fmt.Printf("Keychain:  %s\n", availability(status["keychain"].(bool)))
+			}
+			if enc.KeyFile != "" {
+				fmt.Printf("Key file:  %s (%s)\n", enc.KeyFile, availability(status["key_file_available"].(bool)))
+			}
+		}
+		return nil
+	},
+}
+
+func availability(ok bool) string {
+	if ok {
+		return "available"
+	}
+	return "NOT AVAILABLE"
+}
+
+func init() {
+	encryptionInitCmd.Flags().BoolVar(&encryptionKeychain, "keychain", false, "Also keep the key in the login Keychain so the daemon unlocks unattended")
+	encryptionInitCmd.Flags().StringVar(&encryptionKeyFile, "key-file", "", "Also write the key to this file so the daemon unlocks unattended")
+
+	encryptionCmd.AddCommand(encryptionInitCmd)
+	encryptionCmd.AddCommand(encryptionApplyCmd)
+	encryptionCmd.AddCommand(encryptionStatusCmd)
+}
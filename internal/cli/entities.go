@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/extract"
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	entitiesType    string
+	entitiesFrom    string
+	entitiesTo      string
+	entitiesToday   bool
+	entitiesApp     string
+	entitiesSearch  string
+	entitiesUnique  bool
+	entitiesLimit   int
+	entitiesRebuild bool
+)
+
+func init() {
+	entitiesCmd.Flags().StringVar(&entitiesType, "type", "", "Entity type: "+strings.Join(extract.Types, ", "))
+	entitiesCmd.Flags().StringVar(&entitiesFrom, "from", "", "Start time")
+	entitiesCmd.Flags().StringVar(&entitiesTo, "to", "", "End time")
+	entitiesCmd.Flags().BoolVar(&entitiesToday, "today", false, "Show today's entities")
+	entitiesCmd.Flags().StringVar(&entitiesApp, "app", "", "Filter by application")
+	entitiesCmd.Flags().StringVar(&entitiesSearch, "search", "", "Only values containing this text")
+	entitiesCmd.Flags().BoolVar(&entitiesUnique, "unique", false, "Show each value once with a count")
+	entitiesCmd.Flags().IntVar(&entitiesLimit, "limit", 100, "Maximum entities to return")
+	entitiesCmd.Flags().BoolVar(&entitiesRebuild, "rebuild", false, "Re-extract entities from all stored OCR text and typing sessions")
+}
+
+var entitiesCmd = &cobra.Command{
+	Use:   "entities",
+	Short: "List URLs, emails, paths, SHAs, issue keys, IPs and phone numbers",
+	Long:  `List structured entities extracted from OCR text and typing sessions, such as URLs, email addresses, file paths, git SHAs, issue keys, IP addresses and phone numbers.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if entitiesType != "" && !isEntityType(entitiesType) {
+			return fmt.Errorf("unknown entity type %q (expected one of: %s)", entitiesType, strings.Join(extract.Types, ", "))
+		}
+
+		db, err := openDB(getStoragePath())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+
+		if entitiesRebuild {
+			screenshots, sessions, err := rebuildEntities(db)
+			if err != nil {
+				return fmt.Errorf("failed to rebuild entities: %w", err)
+			}
+			fmt.Printf("Re-extracted entities from %d screenshots and %d typing sessions\n", screenshots, sessions)
+			return nil
+		}
+
+		now := time.Now()
+		var from, to time.Time
+		if entitiesToday {
+			from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			to = now
+		} else {
+			from, to = parseTimeRange(entitiesFrom, entitiesTo)
+		}
+
+		entities, err := db.GetEntities(entitiesType, entitiesSearch, from, to, entitiesApp, entitiesLimit)
+		if err != nil {
+			return fmt.Errorf("failed to get entities: %w", err)
+		}
+
+		if entitiesUnique {
+			return outputUniqueEntities(entities)
+		}
+
+		format := getOutputFormat()
+		switch format {
+		case "json":
+			outputJSON(map[string]interface{}{
+				"from":     from,
+				"to":       to,
+				"type":     entitiesType,
+				"count":    len(entities),
+				"entities": entities,
+			})
+		case "plain":
+			headers := []string{"timestamp", "type", "value", "app", "window", "source"}
+			var rows [][]string
+			for _, e := range entities {
+				rows = append(rows, []string{
+					e.Timestamp.Format(time.RFC3339),
+					e.Type,
+					e.Value,
+					e.ActiveApp,
+					e.ActiveWindowTitle,
+					entitySource(e),
+				})
+			}
+			outputPlain(headers, rows)
+		default:
+			if len(entities) == 0 {
+				fmt.Println("No entities found.")
+				return nil
+			}
+			fmt.Printf("Entities (%s to %s): %d\n\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), len(entities))
+			for _, e := range entities {
+				fmt.Printf("[%s] %-8s %s\n", e.Timestamp.Format("2006-01-02 15:04"), e.Type, e.Value)
+				fmt.Printf("  %s - %s (%s)\n", e.ActiveApp, truncate(e.ActiveWindowTitle, 60), entitySource(e))
+			}
+		}
+		return nil
+	},
+}
+
+type uniqueEntity struct {
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func outputUniqueEntities(entities []storage.Entity) error {
+	unique := uniqueEntities(entities)
+
+	format := getOutputFormat()
+	switch format {
+	case "json":
+		outputJSON(map[string]interface{}{
+			"count":    len(unique),
+			"entities": unique,
+		})
+	case "plain":
+		headers := []string{"type", "value", "count", "first_seen", "last_seen"}
+		var rows [][]string
+		for _, u := range unique {
+			rows = append(rows, []string{
+				u.Type,
+				u.Value,
+				fmt.Sprintf("%d", u.Count),
+				u.FirstSeen.Format(time.RFC3339),
+				u.LastSeen.Format(time.RFC3339),
+			})
+		}
+		outputPlain(headers, rows)
+	default:
+		if len(unique) == 0 {
+			fmt.Println("No entities found.")
+			return nil
+		}
+		for _, u := range unique {
+			fmt.Printf("%4dx %-8s %s (last seen %s)\n", u.Count, u.Type, u.Value, u.LastSeen.Format("2006-01-02 15:04"))
+		}
+	}
+	return nil
+}
+
+// uniqueEntities groups entities by type and value, most frequent first.
+func uniqueEntities(entities []storage.Entity) []*uniqueEntity {
+	byKey := make(map[string]*uniqueEntity)
+	var unique []*uniqueEntity
+	for _, e := range entities {
+		key := e.Type + "\x00" + e.Value
+		u, ok := byKey[key]
+		if !ok {
+			u = &uniqueEntity{Type: e.Type, Value: e.Value, FirstSeen: e.Timestamp, LastSeen: e.Timestamp}
+			byKey[key] = u
+			unique = append(unique, u)
+		}
+		u.Count++
+		if e.Timestamp.Before(u.FirstSeen) {
+			u.FirstSeen = e.Timestamp
+		}
+		if e.Timestamp.After(u.LastSeen) {
+			u.LastSeen = e.Timestamp
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return unique[i].Count > unique[j].Count
+	})
+	return unique
+}
+
+func entitySource(e storage.Entity) string {
+	if e.ScreenshotID != 0 {
+		return fmt.Sprintf("screenshot %d", e.ScreenshotID)
+	}
+	return fmt.Sprintf("typing session %d", e.TypingSessionID)
+}
+
+func isEntityType(t string) bool {
+	for _, known := range extract.Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func toStorageEntities(found []extract.Entity) []storage.Entity {
+	entities := make([]storage.Entity, 0, len(found))
+	for _, e := range found {
+		entities = append(entities, storage.Entity{Type: e.Type, Value: e.Value})
+	}
+	return entities
+}
+
+// storeScreenshotEntities extracts entities from a screenshot's OCR text.
+func storeScreenshotEntities(db *storage.DB, s *storage.Screenshot) error {
+	return db.ReplaceScreenshotEntities(s.ID, s.Timestamp, toStorageEntities(extract.Extract(s.OCRText)))
+}
+
+// storeTypingSessionEntities extracts entities from a flushed typing session.
+func storeTypingSessionEntities(db *storage.DB, s *storage.TypingSession) error {
+	return db.ReplaceTypingSessionEntities(s.ID, s.StartTime, toStorageEntities(extract.Extract(s.Text)))
+}
+
+func rebuildEntities(db *storage.DB) (int, int, error) {
+	screenshotCount := 0
+	var lastID int64
+	for {
+		screenshots, err := db.GetOCRProcessedScreenshots(lastID, 500)
+		if err != nil {
+			return screenshotCount, 0, err
+		}
+		if len(screenshots) == 0 {
+			break
+		}
+		for i := range screenshots {
+			if err := storeScreenshotEntities(db, &screenshots[i]); err != nil {
+				return screenshotCount, 0, err
+			}
+			screenshotCount++
+			lastID = screenshots[i].ID
+		}
+	}
+
+	sessionCount := 0
+	lastID = 0
+	for {
+		sessions, err := db.GetTypingSessionsAfter(lastID, 500)
+		if err != nil {
+			return screenshotCount, sessionCount, err
+		}
+		if len(sessions) == 0 {
+			break
+		}
+		for i := range sessions {
+			if err := storeTypingSessionEntities(db, &sessions[i]); err != nil {
+				return screenshotCount, sessionCount, err
+			}
+			sessionCount++
+			lastID = sessions[i].ID
+		}
+	}
+	return screenshotCount, sessionCount, nil
+}
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/export"
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportDate    string
+	exportFPS     int
+	exportWidth   int
+	exportColumns int
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{exportTimelapseCmd, exportSheetCmd} {
+		cmd.Flags().StringVar(&exportDate, "date", "", "Day to export, e.g. 2026-01-15 or yesterday (default today)")
+	}
+	exportTimelapseCmd.Flags().IntVar(&exportFPS, "fps", 4, "Frames (screenshots) per second")
+	exportTimelapseCmd.Flags().IntVar(&exportWidth, "width", 0, "Video width in pixels (default 1280, 800 for GIF)")
+	exportSheetCmd.Flags().IntVar(&exportColumns, "columns", 6, "Screenshots per row")
+
+	exportCmd.AddCommand(exportTimelapseCmd)
+	exportCmd.AddCommand(exportSheetCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Render a day's screenshots as a timelapse or contact sheet",
+	Long: `Render a day's screenshots for retros and incident reports. Every frame is
+labelled with its time and app.
+
+The destination is given with -o; its extension picks the format:
+
+  memento export timelapse --date yesterday --fps 4 -o day.mp4
+  memento export contact-sheet --date 2026-01-15 -o sheet.png`,
+}
+
+var exportTimelapseCmd = &cobra.Command{
+	Use:   "timelapse",
+	Short: "Render a day's screenshots as a video (.mp4, .gif or .webp)",
+	Long: `Render a day's screenshots as a timelapse. GIFs are encoded directly; animated
+WebP needs img2webp (brew install webp) and MP4 needs ffmpeg (brew install ffmpeg).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		day, frames, release, err := exportFrames(false)
+		if err != nil {
+			return err
+		}
+		defer release()
+		path := exportPath(day, ".mp4")
+
+		opts := export.TimelapseOptions{FPS: exportFPS, Width: exportWidth}
+		if getOutputFormat() != "json" {
+			opts.Progress = func(done, total int) {
+				fmt.Fprintf(os.Stderr, "\rRendering frame %d/%d", done, total)
+				if done == total {
+					fmt.Fprintln(os.Stderr)
+				}
+			}
+		}
+		if err := export.Timelapse(frames, path, opts); err != nil {
+			return fmt.Errorf("failed to render timelapse: %w", err)
+		}
+		return reportExport(path, day, len(frames))
+	},
+}
+
+var exportSheetCmd = &cobra.Command{
+	Use:   "contact-sheet",
+	Short: "Render a day's screenshots as a grid image (.png or .jpg)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		day, frames, release, err := exportFrames(true)
+		if err != nil {
+			return err
+		}
+		defer release()
+		path := exportPath(day, ".png")
+
+		title := fmt.Sprintf("%s  -  %d screenshots, %s to %s", day.Format("Monday, January 2, 2006"), len(frames),
+			frames[0].Time.Format("15:04"), frames[len(frames)-1].Time.Format("15:04"))
+		sheet, err := export.ContactSheet(frames, export.SheetOptions{Title: title, Columns: exportColumns})
+		if err != nil {
+			return fmt.Errorf("failed to render contact sheet: %w", err)
+		}
+		if err := export.WriteImage(sheet, path); err != nil {
+			return fmt.Errorf("failed to write contact sheet: %w", err)
+		}
+		return reportExport(path, day, len(frames))
+	},
+}
+
+// exportFrames gathers the screenshots of the --date day, oldest first. With
+// thumbnails set, frames point at thumbnails where they can be made. Images
+// packed in segments or encrypted are extracted to temporary files, which
+// release removes.
+func exportFrames(thumbnails bool) (time.Time, []export.Frame, func(), error) {
+	var temps []func()
+	release := func() {
+		for _, r := range temps {
+			r()
+		}
+	}
+
+	now := time.Now()
+	day := now
+	if exportDate != "" {
+		day = parseRelativeTime(exportDate, now)
+		if day.IsZero() {
+			return day, nil, release, fmt.Errorf("invalid date %q", exportDate)
+		}
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+
+	storagePath := getStoragePath()
+	db, err := openDB(storagePath)
+	if err != nil {
+		return day, nil, release, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	fm, err := openFiles(storagePath)
+	if err != nil {
+		return day, nil, release, err
+	}
+
+	screenshots, err := db.GetScreenshotsByDateRange(day, day.AddDate(0, 0, 1), 100000)
+	if err != nil {
+		return day, nil, release, fmt.Errorf("failed to list screenshots: %w", err)
+	}
+
+	var frames []export.Frame
+	for i := len(screenshots) - 1; i >= 0; i-- {
+		s := &screenshots[i]
+		if !fm.ImageExists(s.Image()) {
+			continue
+		}
+		image := s.Image()
+		if thumbnails {
+			if thumb, err := ensureThumbnail(db, fm, s); err == nil {
+				image = storage.ImageRef{Path: thumb}
+			}
+		}
+		path, r, err := fm.ImageFile(image)
+		if err != nil {
+			continue
+		}
+		temps = append(temps, r)
+		frames = append(frames, export.Frame{Path: path, Time: s.Timestamp, App: s.ActiveApp, Title: s.ActiveWindowTitle})
+	}
+	if len(frames) == 0 {
+		for _, f := range dayDirectoryFrames(fm, day) {
+			path, r, err := fm.ImageFile(storage.ImageRef{Path: f.Path})
+			if err != nil {
+				continue
+			}
+			temps = append(temps, r)
+			f.Path = path
+			frames = append(frames, f)
+		}
+	}
+	if len(frames) == 0 {
+		return day, nil, release, fmt.Errorf("no screenshots on %s", day.Format("2006-01-02"))
+	}
+	return day, frames, release, nil
+}
+
+// dayDirectoryFrames lists the screenshots in a day's directory directly, for
+// files that aren't (or are no longer) in the database.
+func dayDirectoryFrames(fm *storage.FileManager, day time.Time) []export.Frame {
+	dir := filepath.Dir(fm.GetScreenshotPath(day))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var frames []export.Frame
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".webp" || strings.Contains(name, "_display") {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02_15-04-05", strings.TrimSuffix(name, ".webp"), time.Local)
+		if err != nil {
+			continue
+		}
+		frames = append(frames, export.Frame{Path: filepath.Join(dir, name), Time: t})
+	}
+	sort.Slice(frames, func(i, j int) bool { return frames[i].Time.Before(frames[j].Time) })
+	return frames
+}
+
+// exportPath is the file given with -o, or memento-<date><ext> in the
+// current directory. Output formats like json still apply to the summary.
+func exportPath(day time.Time, ext string) string {
+	if filepath.Ext(outputFormat) != "" {
+		return outputFormat
+	}
+	return fmt.Sprintf("memento-%s%s", day.Format("2006-01-02"), ext)
+}
+
+func reportExport(path string, day time.Time, frames int) error {
+	if getOutputFormat() == "json" {
+		outputJSON(map[string]interface{}{
+			"path":        path,
+			"date":        day.Format("2006-01-02"),
+			"screenshots": frames,
+		})
+		return nil
+	}
+	fmt.Printf("Wrote %s (%d screenshots)\n", path, frames)
+	return nil
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	focusFrom    string
+	focusTo      string
+	focusToday   bool
+	focusApp     string
+	focusSummary bool
+	focusLimit   int
+)
+
+func init() {
+	focusCmd.Flags().StringVar(&focusFrom, "from", "", "Start time (e.g., \"2026-01-15 14:00\")")
+	focusCmd.Flags().StringVar(&focusTo, "to", "", "End time")
+	focusCmd.Flags().BoolVar(&focusToday, "today", false, "Show today's focus events")
+	focusCmd.Flags().StringVar(&focusApp, "app", "", "Filter by application")
+	focusCmd.Flags().BoolVar(&focusSummary, "summary", false, "Show total time per app instead of individual events")
+	focusCmd.Flags().IntVar(&focusLimit, "limit", 10000, "Maximum events to return")
+}
+
+var focusCmd = &cobra.Command{
+	Use:   "focus",
+	Short: "Show which app and window had focus, and for how long",
+	Long:  `List every app and window switch recorded by the daemon with its start, end and duration. Events are clipped to the requested time range.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		var from, to time.Time
+		if focusToday || (focusFrom == "" && focusTo == "") {
+			from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			to = now
+		} else {
+			from, to = parseTimeRange(focusFrom, focusTo)
+		}
+
+		db, err := storage.NewDB(getStoragePath())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+
+		events, err := db.GetFocusEvents(from, to, focusApp, focusLimit)
+		if err != nil {
+			return fmt.Errorf("failed to get focus events: %w", err)
+		}
+		events = clipFocusEvents(events, from, to)
+
+		if focusSummary {
+			return outputFocusSummary(from, to, events)
+		}
+
+		format := getOutputFormat()
+		switch format {
+		case "json":
+			outputJSON(map[string]interface{}{
+				"from":   from,
+				"to":     to,
+				"count":  len(events),
+				"events": events,
+			})
+		case "plain":
+			headers := []string{"start", "end", "seconds", "app", "window"}
+			var rows [][]string
+			for _, e := range events {
+				rows = append(rows, []string{
+					e.StartTime.Format(time.RFC3339),
+					e.EndTime.Format(time.RFC3339),
+					fmt.Sprintf("%.0f", e.DurationSeconds),
+					e.ActiveApp,
+					e.ActiveWindowTitle,
+				})
+			}
+			outputPlain(headers, rows)
+		default:
+			if len(events) == 0 {
+				fmt.Println("No focus events found.")
+				return nil
+			}
+			fmt.Printf("Focus: %s to %s (%d events)\n\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), len(events))
+			for _, e := range events {
+				fmt.Printf("[%s - %s] %8s  %s - %s\n", e.StartTime.Format("15:04:05"), e.EndTime.Format("15:04:05"),
+					formatDuration(e.Duration()), e.ActiveApp, truncate(e.ActiveWindowTitle, 60))
+			}
+		}
+		return nil
+	},
+}
+
+// clipFocusEvents trims events to [from, to] so durations only count time
+// inside the range.
+func clipFocusEvents(events []storage.FocusEvent, from, to time.Time) []storage.FocusEvent {
+	clipped := events[:0]
+	for _, e := range events {
+		if e.StartTime.Before(from) {
+			e.StartTime = from
+		}
+		if e.EndTime.After(to) {
+			e.EndTime = to
+		}
+		if !e.EndTime.After(e.StartTime) {
+			continue
+		}
+		e.DurationSeconds = e.Duration().Seconds()
+		clipped = append(clipped, e)
+	}
+	return clipped
+}
+
+type focusTotal struct {
+	App     string  `json:"app"`
+	Seconds float64 `json:"seconds"`
+	Events  int     `json:"events"`
+}
+
+func outputFocusSummary(from, to time.Time, events []storage.FocusEvent) error {
+	byApp := make(map[string]*focusTotal)
+	var totals []*focusTotal
+	var sum float64
+	for _, e := range events {
+		t, ok := byApp[e.ActiveApp]
+		if !ok {
+			t = &focusTotal{App: e.ActiveApp}
+			byApp[e.ActiveApp] = t
+			totals = append(totals, t)
+		}
+		t.Seconds += e.DurationSeconds
+		t.Events++
+		sum += e.DurationSeconds
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].Seconds > totals[j].Seconds
+	})
+
+	format := getOutputFormat()
+	switch format {
+	case "json":
+		outputJSON(map[string]interface{}{
+			"from":          from,
+			"to":            to,
+			"total_seconds": sum,
+			"apps":          totals,
+		})
+	case "plain":
+		headers := []string{"app", "seconds", "events"}
+		var rows [][]string
+		for _, t := range totals {
+			rows = append(rows, []string{t.App, fmt.Sprintf("%.0f", t.Seconds), fmt.Sprintf("%d", t.Events)})
+		}
+		outputPlain(headers, rows)
+	default:
+		if len(totals) == 0 {
+			fmt.Println("No focus events found.")
+			return nil
+		}
+		fmt.Printf("Focus: %s to %s (%s tracked)\n\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"),
+			formatDuration(secondsDuration(sum)))
+		for _, t := range totals {
+			fmt.Printf("%10s  %5.1f%%  %s (%d switches)\n", formatDuration(secondsDuration(t.Seconds)),
+				100*t.Seconds/sum, t.App, t.Events)
+		}
+	}
+	return nil
+}
+
+// formatDuration renders d compactly, e.g. "2h05m", "13m29s" or "42s".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
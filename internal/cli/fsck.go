@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fsckRepair bool
+	fsckQuick  bool
+)
+
+func init() {
+	fsckCmd.Flags().BoolVar(&fsckRepair, "repair", false, "Fix what can be fixed: delete dangling rows, re-import orphans, correct file sizes")
+	fsckCmd.Flags().BoolVar(&fsckQuick, "quick", false, "Only check that images exist, without reading them")
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check the database and screenshots against each other",
+	Long: `Check the archive for problems:
+
+  integrity          PRAGMA integrity_check fails
+  dangling_row       a row's image is missing
+  empty_image        a row's image is zero bytes
+  undecodable_image  a row's image isn't a complete WebP
+  size_mismatch      a row's file_size differs from its image
+  orphaned_file      an image or temporary file no row references
+  orphaned_segment   a segment no row references
+
+With --repair, rows whose image is missing or broken are deleted along with
+the broken file, file sizes are corrected, and orphaned screenshots and the
+screenshots in orphaned segments are re-imported (OCR picks them up again).
+Files left by interrupted writes and loose copies of packed images are
+removed. Nothing is repaired if the database fails its integrity check.
+
+Files changed in the last minute are skipped, so fsck is safe to run while
+the daemon is capturing.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
+		}
+
+		opts := storage.CheckOptions{Repair: fsckRepair, Quick: fsckQuick}
+		if getOutputFormat() == "text" {
+			opts.Progress = func(done, total int) {
+				if done%100 == 0 || done == total {
+					fmt.Printf("\rChecked %d of %d images", done, total)
+				}
+			}
+		}
+		result, err := fm.Check(db, opts)
+		if opts.Progress != nil && result.Rows > 0 {
+			fmt.Println()
+		}
+		if err != nil {
+			return fmt.Errorf("fsck failed: %w", err)
+		}
+
+		switch getOutputFormat() {
+		case "json":
+			outputJSON(result)
+		case "plain":
+			headers := []string{"kind", "path", "table", "id", "detail", "repaired"}
+			var rows [][]string
+			for _, issue := range result.Issues {
+				rows = append(rows, []string{
+					issue.Kind,
+					issue.Path,
+					issue.Table,
+					fmt.Sprintf("%d", issue.ID),
+					issue.Detail,
+					fmt.Sprintf("%v", issue.Repaired),
+				})
+			}
+			outputPlain(headers, rows)
+		default:
+			fmt.Printf("Database: %s\n", result.Integrity[0])
+			if fsckQuick {
+				fmt.Printf("Rows: %d, files: %d\n", result.Rows, result.Files)
+			} else {
+				fmt.Printf("Rows: %d, images read: %d (%s), files: %d\n", result.Rows, result.Images, formatBytes(result.Bytes), result.Files)
+			}
+			for _, issue := range result.Issues {
+				status := ""
+				if issue.Repaired {
+					status = " [repaired]"
+				}
+				row := ""
+				if issue.Table != "" {
+					row = fmt.Sprintf(" (%s %d)", issue.Table, issue.ID)
+				}
+				detail := ""
+				if issue.Detail != "" {
+					detail = ": " + issue.Detail
+				}
+				fmt.Printf("  %-17s %s%s%s%s\n", issue.Kind, issue.Path, row, detail, status)
+			}
+		}
+
+		if n := result.Unrepaired(); n > 0 {
+			if !fsckRepair && getOutputFormat() == "text" {
+				fmt.Println("Run memento fsck --repair to fix what can be fixed.")
+			}
+			return fmt.Errorf("%d problems found", n)
+		}
+		if getOutputFormat() == "text" {
+			fmt.Println("No problems found.")
+		}
+		return nil
+	},
+}
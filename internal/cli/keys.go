@@ -2,6 +2,8 @@ package cli
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/mahirisikli/memento/internal/storage"
@@ -45,7 +47,7 @@ var keysCmd = &cobra.Command{
 			}
 		}
 
-		db, err := storage.NewDB(getStoragePath())
+		db, err := openDB(getStoragePath())
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
@@ -102,7 +104,17 @@ var keysCmd = &cobra.Command{
 			}
 
 			fmt.Printf("Typing Sessions (%s to %s)\n", from.Format("2006-01-02 15:04"), to.Format("15:04"))
-			fmt.Printf("Sessions: %d | Total keystrokes: %d\n\n", len(sessions), totalKeys)
+			fmt.Printf("Sessions: %d | Total keystrokes: %d\n", len(sessions), totalKeys)
+			apps := make([]string, 0, len(appKeys))
+			for app := range appKeys {
+				apps = append(apps, app)
+			}
+			sort.Slice(apps, func(i, j int) bool { return appKeys[apps[i]] > appKeys[apps[j]] })
+			var byApp []string
+			for _, app := range apps {
+				byApp = append(byApp, fmt.Sprintf("%s %d", app, appKeys[app]))
+			}
+			fmt.Printf("By app: %s\n\n", strings.Join(byApp, ", "))
 
 			for _, s := range sessions {
 				duration := s.EndTime.Sub(s.StartTime).Round(time.Second)
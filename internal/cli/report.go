@@ -0,0 +1,467 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportDay   bool
+	reportWeek  bool
+	reportMonth bool
+	reportDate  string
+	reportFrom  string
+	reportTo    string
+	reportTop   int
+)
+
+func init() {
+	reportCmd.Flags().BoolVar(&reportDay, "day", false, "Report on one day (default)")
+	reportCmd.Flags().BoolVar(&reportWeek, "week", false, "Report on the week (Monday to Sunday)")
+	reportCmd.Flags().BoolVar(&reportMonth, "month", false, "Report on the calendar month")
+	reportCmd.Flags().StringVar(&reportDate, "date", "", "Day within the period to report on (default today)")
+	reportCmd.Flags().StringVar(&reportFrom, "from", "", "Custom range start")
+	reportCmd.Flags().StringVar(&reportTo, "to", "", "Custom range end")
+	reportCmd.Flags().IntVar(&reportTop, "top", 15, "Rows per section in text output (0 for all)")
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Time spent per app, window and project",
+	Long: `Aggregate time per app, per window title and per project for a day, week or month.
+
+Time comes from recorded focus events. Where no focus event covers the time it
+is estimated from screenshots: each capture counts until the next one, up to the
+maximum capture interval. Keystrokes come from typing sessions.
+
+Projects are defined with "memento config set project Name=pattern", where the
+pattern is matched against window titles ("Name=app:pattern" matches app names).
+
+Use -o json or -o csv for timesheets and scripts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		from, to, period := reportRange(time.Now())
+
+		db, err := openDB(getStoragePath())
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+
+		report, err := buildReport(db, config, from, to)
+		if err != nil {
+			return err
+		}
+		report.Period = period
+
+		switch getOutputFormat() {
+		case "json":
+			outputJSON(report)
+		case "csv":
+			return outputReportCSV(report)
+		case "plain":
+			headers := []string{"group", "name", "seconds", "share", "keystrokes"}
+			outputPlain(headers, reportRows(report))
+		default:
+			outputReportText(report)
+		}
+		return nil
+	},
+}
+
+// reportRange resolves the period flags to a time range and a name for it.
+func reportRange(now time.Time) (time.Time, time.Time, string) {
+	if reportFrom != "" || reportTo != "" {
+		from, to := parseTimeRange(reportFrom, reportTo)
+		return from, to, "custom"
+	}
+
+	day := now
+	if reportDate != "" {
+		if parsed := parseRelativeTime(reportDate, now); !parsed.IsZero() {
+			day = parsed
+		}
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location())
+
+	var from, to time.Time
+	period := "day"
+	switch {
+	case reportMonth:
+		from = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+		to = from.AddDate(0, 1, 0)
+		period = "month"
+	case reportWeek:
+		offset := (int(start.Weekday()) + 6) % 7 // days since Monday
+		from = start.AddDate(0, 0, -offset)
+		to = from.AddDate(0, 0, 7)
+		period = "week"
+	default:
+		from = start
+		to = start.AddDate(0, 0, 1)
+	}
+	if to.After(now) {
+		to = now
+	}
+	return from, to, period
+}
+
+type Report struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Source is "focus_events", "screenshots" or "mixed"; see spanSource
+	Source       string      `json:"source"`
+	TotalSeconds float64     `json:"total_seconds"`
+	Keystrokes   int         `json:"keystrokes"`
+	Apps         []ReportRow `json:"apps"`
+	Projects     []ReportRow `json:"projects"`
+	Titles       []ReportRow `json:"titles"`
+	Days         []ReportRow `json:"days"`
+}
+
+type ReportRow struct {
+	Name       string  `json:"name"`
+	Seconds    float64 `json:"seconds"`
+	Share      float64 `json:"share"`
+	Keystrokes int     `json:"keystrokes"`
+}
+
+// reportSpan is a stretch of time attributed to one app and window.
+type reportSpan struct {
+	Start time.Time
+	End   time.Time
+	App   string
+	Title string
+	// estimated is set on spans derived from screenshots
+	estimated bool
+}
+
+func buildReport(db *storage.DB, config *Config, from, to time.Time) (*Report, error) {
+	spans, err := reportSpans(db, config, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{From: from, To: to, Source: spanSource(spans)}
+
+	sessions, err := db.GetTypingSessionsByDateRange(from, to, "", 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get typing sessions: %w", err)
+	}
+
+	apps := newReportGroup()
+	projects := newReportGroup()
+	titles := newReportGroup()
+	days := newReportGroup()
+
+	for _, s := range spans {
+		seconds := s.End.Sub(s.Start).Seconds()
+		report.TotalSeconds += seconds
+		apps.add(s.App, seconds, 0)
+		titles.add(titlePattern(s.App, s.Title), seconds, 0)
+		projects.add(projectName(config, s.App, s.Title), seconds, 0)
+		days.add(s.Start.Format("2006-01-02"), seconds, 0)
+	}
+	for _, s := range sessions {
+		report.Keystrokes += s.KeyCount
+		apps.add(s.ActiveApp, 0, s.KeyCount)
+		titles.add(titlePattern(s.ActiveApp, s.ActiveWindowTitle), 0, s.KeyCount)
+		projects.add(projectName(config, s.ActiveApp, s.ActiveWindowTitle), 0, s.KeyCount)
+		days.add(s.StartTime.Format("2006-01-02"), 0, s.KeyCount)
+	}
+
+	report.Apps = apps.rows(report.TotalSeconds, true)
+	report.Projects = projects.rows(report.TotalSeconds, true)
+	report.Titles = titles.rows(report.TotalSeconds, true)
+	report.Days = days.rows(report.TotalSeconds, false)
+	return report, nil
+}
+
+// reportSpans returns focus events in [from, to] as spans, with spans
+// estimated from screenshots filling the time no focus event covers.
+func reportSpans(db *storage.DB, config *Config, from, to time.Time) ([]reportSpan, error) {
+	events, err := db.GetFocusEvents(from, to, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get focus events: %w", err)
+	}
+	var spans []reportSpan
+	for _, e := range clipFocusEvents(events, from, to) {
+		spans = append(spans, reportSpan{Start: e.StartTime, End: e.EndTime, App: e.ActiveApp, Title: e.ActiveWindowTitle})
+	}
+
+	screenshots, err := db.GetScreenshotsByDateRange(from, to, 100000)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get screenshots: %w", err)
+	}
+	estimated := screenshotSpans(screenshots, to, time.Duration(config.CaptureMaxIntervalSeconds)*time.Second)
+	spans = append(spans, uncoveredSpans(estimated, spans)...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans, nil
+}
+
+// uncoveredSpans returns the parts of spans, which must be in order, that
+// none of covered overlaps.
+func uncoveredSpans(spans, covered []reportSpan) []reportSpan {
+	// Merge covered into disjoint, ordered intervals
+	sorted := make([]reportSpan, len(covered))
+	copy(sorted, covered)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+	var merged []reportSpan
+	for _, c := range sorted {
+		if n := len(merged); n > 0 && !c.Start.After(merged[n-1].End) {
+			if c.End.After(merged[n-1].End) {
+				merged[n-1].End = c.End
+			}
+			continue
+		}
+		merged = append(merged, reportSpan{Start: c.Start, End: c.End})
+	}
+
+	var out []reportSpan
+	j := 0
+	for _, s := range spans {
+		for j < len(merged) && !merged[j].End.After(s.Start) {
+			j++
+		}
+		start := s.Start
+		for k := j; k < len(merged) && merged[k].Start.Before(s.End); k++ {
+			if merged[k].Start.After(start) {
+				part := s
+				part.Start, part.End = start, merged[k].Start
+				out = append(out, part)
+			}
+			if merged[k].End.After(start) {
+				start = merged[k].End
+			}
+		}
+		if s.End.After(start) {
+			part := s
+			part.Start = start
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// spanSource describes where spans came from: "focus_events",
+// "screenshots", or "mixed" when screenshots fill gaps between focus events.
+func spanSource(spans []reportSpan) string {
+	focus, estimated := false, false
+	for _, s := range spans {
+		if s.estimated {
+			estimated = true
+		} else {
+			focus = true
+		}
+	}
+	switch {
+	case focus && estimated:
+		return "mixed"
+	case focus:
+		return "focus_events"
+	}
+	return "screenshots"
+}
+
+// screenshotSpans estimates spans from captures: each screenshot covers the
+// time until the next one, at most maxGap, so idle stretches aren't counted.
+func screenshotSpans(screenshots []storage.Screenshot, to time.Time, maxGap time.Duration) []reportSpan {
+	if maxGap <= 0 {
+		maxGap = 10 * time.Minute
+	}
+	sorted := make([]storage.Screenshot, len(screenshots))
+	copy(sorted, screenshots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var spans []reportSpan
+	for i, s := range sorted {
+		end := to
+		if i+1 < len(sorted) {
+			end = sorted[i+1].Timestamp
+		}
+		if end.Sub(s.Timestamp) > maxGap {
+			end = s.Timestamp.Add(maxGap)
+		}
+		if !end.After(s.Timestamp) {
+			continue
+		}
+		spans = append(spans, reportSpan{Start: s.Timestamp, End: end, App: s.ActiveApp, Title: s.ActiveWindowTitle, estimated: true})
+	}
+	return spans
+}
+
+func projectName(config *Config, app, title string) string {
+	if name := config.ProjectFor(app, title); name != "" {
+		return name
+	}
+	return "(unassigned)"
+}
+
+var (
+	unreadCountPattern = regexp.MustCompile(`^\(\d+\)\s*|\s*\(\d+\)$`)
+	titleSeparators    = []string{" — ", " – ", " - ", " | "}
+)
+
+// titlePattern groups window titles that differ only in noise: unread
+// counters and a trailing app name, e.g. "(3) Inbox - Gmail - Google Chrome"
+// and "Inbox - Gmail - Google Chrome" both become
+// "Google Chrome: Inbox - Gmail".
+func titlePattern(app, title string) string {
+	title = strings.TrimSpace(unreadCountPattern.ReplaceAllString(title, ""))
+	for _, sep := range titleSeparators {
+		if i := strings.LastIndex(title, sep); i > 0 {
+			suffix := strings.TrimSpace(title[i+len(sep):])
+			if strings.EqualFold(suffix, app) || (len(suffix) >= 3 && strings.Contains(strings.ToLower(app), strings.ToLower(suffix))) {
+				title = strings.TrimSpace(title[:i])
+				break
+			}
+		}
+	}
+	if title == "" {
+		return app
+	}
+	return app + ": " + title
+}
+
+type reportGroup struct {
+	byName map[string]*ReportRow
+	order  []*ReportRow
+}
+
+func newReportGroup() *reportGroup {
+	return &reportGroup{byName: make(map[string]*ReportRow)}
+}
+
+func (g *reportGroup) add(name string, seconds float64, keystrokes int) {
+	if name == "" {
+		name = "(unknown)"
+	}
+	row, ok := g.byName[name]
+	if !ok {
+		row = &ReportRow{Name: name}
+		g.byName[name] = row
+		g.order = append(g.order, row)
+	}
+	row.Seconds += seconds
+	row.Keystrokes += keystrokes
+}
+
+// rows returns the group's rows with shares of total, sorted by time spent
+// or, with byTime false, by name.
+func (g *reportGroup) rows(total float64, byTime bool) []ReportRow {
+	rows := make([]ReportRow, 0, len(g.order))
+	for _, r := range g.order {
+		if total > 0 {
+			r.Share = r.Seconds / total
+		}
+		rows = append(rows, *r)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if byTime {
+			if rows[i].Seconds != rows[j].Seconds {
+				return rows[i].Seconds > rows[j].Seconds
+			}
+			return rows[i].Keystrokes > rows[j].Keystrokes
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+// eachReportRow calls fn for every row of every section.
+func eachReportRow(r *Report, fn func(group string, row ReportRow)) {
+	sections := []struct {
+		group string
+		rows  []ReportRow
+	}{
+		{"app", r.Apps},
+		{"project", r.Projects},
+		{"title", r.Titles},
+		{"day", r.Days},
+	}
+	for _, section := range sections {
+		for _, row := range section.rows {
+			fn(section.group, row)
+		}
+	}
+}
+
+func reportRows(r *Report) [][]string {
+	var rows [][]string
+	eachReportRow(r, func(group string, row ReportRow) {
+		rows = append(rows, []string{
+			group,
+			row.Name,
+			fmt.Sprintf("%.0f", row.Seconds),
+			fmt.Sprintf("%.4f", row.Share),
+			fmt.Sprintf("%d", row.Keystrokes),
+		})
+	})
+	return rows
+}
+
+func outputReportCSV(r *Report) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"group", "name", "seconds", "hours", "share", "keystrokes"})
+	eachReportRow(r, func(group string, row ReportRow) {
+		w.Write([]string{
+			group,
+			row.Name,
+			fmt.Sprintf("%.0f", row.Seconds),
+			fmt.Sprintf("%.2f", row.Seconds/3600),
+			fmt.Sprintf("%.4f", row.Share),
+			fmt.Sprintf("%d", row.Keystrokes),
+		})
+	})
+	w.Flush()
+	return w.Error()
+}
+
+func outputReportText(r *Report) {
+	fmt.Printf("Report (%s): %s to %s\n", r.Period, r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	fmt.Printf("Tracked: %s | Keystrokes: %d | Source: %s\n", formatDuration(secondsDuration(r.TotalSeconds)), r.Keystrokes, r.Source)
+	if r.TotalSeconds == 0 && r.Keystrokes == 0 {
+		fmt.Println("\nNo activity recorded.")
+		return
+	}
+
+	printSection := func(title string, rows []ReportRow) {
+		fmt.Printf("\n%s\n", title)
+		fmt.Println(strings.Repeat("-", len(title)))
+		for i, row := range rows {
+			if reportTop > 0 && i >= reportTop {
+				fmt.Printf("  ... %d more\n", len(rows)-i)
+				break
+			}
+			fmt.Printf("%10s  %5.1f%%  %7d keys  %s\n", formatDuration(secondsDuration(row.Seconds)), 100*row.Share, row.Keystrokes, truncate(row.Name, 70))
+		}
+	}
+	printSection("By project", r.Projects)
+	printSection("By app", r.Apps)
+	printSection("By window", r.Titles)
+	if len(r.Days) > 1 {
+		printSection("By day", r.Days)
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -27,7 +27,7 @@ func getStoragePath() string {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, json, plain")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, json, plain (report also supports csv; export takes a file name)")
 	rootCmd.PersistentFlags().StringVar(&storagePath, "storage", "", "Override storage path")
 
 	rootCmd.AddCommand(startCmd)
@@ -40,6 +40,15 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(backupCmd)
 	rootCmd.AddCommand(captureCmd)
+	rootCmd.AddCommand(entitiesCmd)
+	rootCmd.AddCommand(focusCmd)
+	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(digestCmd)
+	rootCmd.AddCommand(uiCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(encryptionCmd)
+	rootCmd.AddCommand(fsckCmd)
+	rootCmd.AddCommand(duCmd)
 }
 
 var rootCmd = &cobra.Command{
@@ -2,7 +2,7 @@ package cli
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
 	"time"
 
 	"github.com/mahirisikli/memento/internal/storage"
@@ -13,6 +13,10 @@ var (
 	screenshotsToday bool
 	screenshotsDate  string
 	screenshotsLimit int
+
+	thumbnailsForce bool
+
+	compactMonth string
 )
 
 func init() {
@@ -22,7 +26,12 @@ func init() {
 
 	screenshotsCmd.AddCommand(screenshotsListCmd)
 	screenshotsCmd.AddCommand(screenshotsShowCmd)
+	thumbnailsCmd.Flags().BoolVar(&thumbnailsForce, "force", false, "Regenerate thumbnails that already exist")
+
 	screenshotsCmd.AddCommand(screenshotsOCRCmd)
+	screenshotsCmd.AddCommand(thumbnailsCmd)
+	screenshotsCompactCmd.Flags().StringVar(&compactMonth, "month", "", "Compact only this month (YYYY-MM)")
+	screenshotsCmd.AddCommand(screenshotsCompactCmd)
 }
 
 var screenshotsCmd = &cobra.Command{
@@ -48,7 +57,7 @@ var screenshotsListCmd = &cobra.Command{
 			}
 		}
 
-		db, err := storage.NewDB(getStoragePath())
+		db, err := openDB(getStoragePath())
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
@@ -64,7 +73,7 @@ var screenshotsListCmd = &cobra.Command{
 		case "json":
 			outputJSON(results)
 		case "plain":
-			headers := []string{"id", "timestamp", "app", "filepath", "ocr_processed"}
+			headers := []string{"id", "timestamp", "app", "filepath", "ocr_processed", "reason"}
 			var rows [][]string
 			for _, r := range results {
 				ocrStatus := "no"
@@ -77,6 +86,7 @@ var screenshotsListCmd = &cobra.Command{
 					r.ActiveApp,
 					r.Filepath,
 					ocrStatus,
+					r.CaptureReason,
 				})
 			}
 			outputPlain(headers, rows)
@@ -91,7 +101,14 @@ var screenshotsListCmd = &cobra.Command{
 				if r.OCRProcessedAt != nil {
 					ocrStatus = " [OCR]"
 				}
-				fmt.Printf("[%d] %s - %s%s\n", r.ID, r.Timestamp.Format("15:04:05"), r.ActiveApp, ocrStatus)
+				if r.PrunedAt != nil {
+					ocrStatus += " [pruned]"
+				}
+				reason := ""
+				if r.CaptureReason != "" {
+					reason = " (" + r.CaptureReason + ")"
+				}
+				fmt.Printf("[%d] %s - %s%s%s\n", r.ID, r.Timestamp.Format("15:04:05"), r.ActiveApp, ocrStatus, reason)
 				fmt.Printf("     %s\n", r.Filepath)
 			}
 		}
@@ -107,7 +124,7 @@ var screenshotsShowCmd = &cobra.Command{
 		var id int64
 		fmt.Sscanf(args[0], "%d", &id)
 
-		db, err := storage.NewDB(getStoragePath())
+		db, err := openDB(getStoragePath())
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
@@ -121,8 +138,20 @@ var screenshotsShowCmd = &cobra.Command{
 
 		for _, r := range results {
 			if r.ID == id {
+				if r.PrunedAt != nil {
+					return fmt.Errorf("the image of screenshot %d was pruned on %s to stay within max_storage_gb; its text is kept", id, r.PrunedAt.Format("2006-01-02"))
+				}
 				// Open with default viewer
-				return exec.Command("open", r.Filepath).Run()
+				fm, err := openFiles(getStoragePath())
+				if err != nil {
+					return err
+				}
+				wait, err := openInViewer(fm, &r)
+				if err != nil {
+					return fmt.Errorf("failed to open screenshot: %w", err)
+				}
+				wait()
+				return nil
 			}
 		}
 
@@ -138,7 +167,7 @@ var screenshotsOCRCmd = &cobra.Command{
 		var id int64
 		fmt.Sscanf(args[0], "%d", &id)
 
-		db, err := storage.NewDB(getStoragePath())
+		db, err := openDB(getStoragePath())
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
@@ -174,3 +203,148 @@ var screenshotsOCRCmd = &cobra.Command{
 		return fmt.Errorf("screenshot with ID %d not found", id)
 	},
 }
+
+var thumbnailsCmd = &cobra.Command{
+	Use:   "thumbnails",
+	Short: "Generate missing thumbnails",
+	Long: `Generate thumbnails for screenshots that don't have one, e.g. those captured
+before thumbnails existed. Thumbnails are stored under ~/.memento/thumbnails in
+the same YYYY/MM/DD layout as the screenshots.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
+		}
+
+		var generated, existing, missing, failed int
+		var afterID int64
+		for {
+			batch, err := db.GetScreenshotsAfter(afterID, 500)
+			if err != nil {
+				return fmt.Errorf("failed to list screenshots: %w", err)
+			}
+			if len(batch) == 0 {
+				break
+			}
+			for i := range batch {
+				s := &batch[i]
+				afterID = s.ID
+				if s.PrunedAt != nil {
+					continue
+				}
+				if !fm.ImageExists(s.Image()) {
+					missing++
+					continue
+				}
+				if thumbnailsForce {
+					s.ThumbnailPath = ""
+				} else if s.ThumbnailPath != "" {
+					if _, err := os.Stat(s.ThumbnailPath); err == nil {
+						existing++
+						continue
+					}
+				}
+				if _, err := ensureThumbnail(db, fm, s); err != nil {
+					fmt.Fprintf(os.Stderr, "Screenshot %d: %v\n", s.ID, err)
+					failed++
+					continue
+				}
+				generated++
+			}
+		}
+
+		switch getOutputFormat() {
+		case "json", "plain":
+			outputJSON(map[string]int{
+				"generated":      generated,
+				"existing":       existing,
+				"missing_source": missing,
+				"failed":         failed,
+			})
+		default:
+			fmt.Printf("Generated %d thumbnails (%d already present, %d screenshots missing, %d failed)\n", generated, existing, missing, failed)
+		}
+		return nil
+	},
+}
+
+var screenshotsCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Pack finished months of screenshots into segment files",
+	Long: `Pack each finished month's screenshots into a few large segment files in
+~/.memento/screenshots/YYYY/MM, replacing thousands of small files. This speeds
+up backups and Time Machine. Every command still finds the images, and a
+segment's index lists the original file names, so it can be read without the
+database.
+
+The daemon does this on its own a day after each month ends unless
+compact_screenshots is false. Thumbnails stay separate files.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
+		}
+
+		var months []time.Time
+		if compactMonth != "" {
+			month, err := time.ParseInLocation("2006-01", compactMonth, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid --month %q: use YYYY-MM", compactMonth)
+			}
+			months = append(months, month)
+		} else if months, err = compactableMonths(fm, time.Now()); err != nil {
+			return fmt.Errorf("failed to list screenshot months: %w", err)
+		}
+
+		var results []*storage.CompactResult
+		for _, month := range months {
+			result, err := fm.CompactMonth(db, month)
+			if err != nil {
+				return fmt.Errorf("failed to compact %s: %w", month.Format("2006-01"), err)
+			}
+			results = append(results, result)
+			if getOutputFormat() != "json" {
+				fmt.Printf("%s: packed %d images (%s) into %d segments", result.Month, result.Images, formatBytes(result.Bytes), len(result.Segments))
+				if result.Missing > 0 {
+					fmt.Printf(", %d missing", result.Missing)
+				}
+				fmt.Println()
+			}
+		}
+
+		if getOutputFormat() == "json" {
+			outputJSON(results)
+		} else if len(results) == 0 {
+			fmt.Println("Nothing to compact.")
+		}
+		return nil
+	},
+}
+
+// compactableMonths returns the months that still have loose screenshots
+// and ended at least a day before now.
+func compactableMonths(fm *storage.FileManager, now time.Time) ([]time.Time, error) {
+	months, err := fm.LooseMonths()
+	if err != nil {
+		return nil, err
+	}
+	var ready []time.Time
+	for _, month := range months {
+		if month.AddDate(0, 1, 1).Before(now) {
+			ready = append(ready, month)
+		}
+	}
+	return ready, nil
+}
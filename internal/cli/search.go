@@ -2,22 +2,30 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/mahirisikli/memento/internal/extract"
 	"github.com/mahirisikli/memento/internal/storage"
 	"github.com/spf13/cobra"
 )
 
 var (
-	searchFrom  string
-	searchTo    string
-	searchLimit int
+	searchFrom   string
+	searchTo     string
+	searchLimit  int
+	searchLang   string
+	searchEntity string
+	searchNew    bool
 )
 
 func init() {
 	searchCmd.Flags().StringVar(&searchFrom, "from", "", "Start date (e.g., '2 days ago', '2026-01-15')")
 	searchCmd.Flags().StringVar(&searchTo, "to", "", "End date (e.g., 'today', '2026-01-17')")
 	searchCmd.Flags().IntVar(&searchLimit, "limit", 100, "Maximum results to return")
+	searchCmd.Flags().StringVar(&searchEntity, "entity", "", "Match the query against extracted entities of this type (url, email, path, git_sha, issue, ip, phone)")
+	searchCmd.Flags().BoolVar(&searchNew, "new", false, "Only match text when it first appeared on screen, not in later captures of the same window")
+	searchCmd.Flags().StringVar(&searchLang, "lang", "", "Only screenshots whose OCR text is in this language (e.g., 'de', 'tr-TR')")
 }
 
 var searchCmd = &cobra.Command{
@@ -28,19 +36,33 @@ var searchCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		query := args[0]
 
+		if searchEntity != "" && !isEntityType(searchEntity) {
+			return fmt.Errorf("unknown entity type %q (expected one of: %s)", searchEntity, strings.Join(extract.Types, ", "))
+		}
+
 		from, to := parseTimeRange(searchFrom, searchTo)
 
-		db, err := storage.NewDB(getStoragePath())
+		db, err := openDB(getStoragePath())
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
 		defer db.Close()
 
-		results, err := db.SearchScreenshots(query, from, to, searchLimit)
+		filter := storage.ScreenshotFilter{Language: searchLang, EntityType: searchEntity, NewTextOnly: searchNew}
+		results, err := db.SearchScreenshots(query, from, to, filter, searchLimit)
 		if err != nil {
 			return fmt.Errorf("search failed: %w", err)
 		}
 
+		// Entities typed rather than seen only exist on typing sessions
+		var entities []storage.Entity
+		if searchEntity != "" {
+			entities, err = db.GetEntities(searchEntity, query, from, to, "", searchLimit)
+			if err != nil {
+				return fmt.Errorf("search failed: %w", err)
+			}
+		}
+
 		format := getOutputFormat()
 		switch format {
 		case "json":
@@ -49,9 +71,12 @@ var searchCmd = &cobra.Command{
 				"count":   len(results),
 				"results": results,
 			}
+			if searchEntity != "" {
+				output["entities"] = entities
+			}
 			outputJSON(output)
 		case "plain":
-			headers := []string{"id", "timestamp", "app", "window", "screenshot"}
+			headers := []string{"id", "timestamp", "app", "window", "screenshot", "lang"}
 			var rows [][]string
 			for _, r := range results {
 				rows = append(rows, []string{
@@ -60,24 +85,40 @@ var searchCmd = &cobra.Command{
 					r.ActiveApp,
 					r.ActiveWindowTitle,
 					r.Filepath,
+					r.OCRLanguage,
 				})
 			}
 			outputPlain(headers, rows)
 		default:
+			if searchEntity != "" && len(entities) > 0 {
+				fmt.Printf("Matching %s entities:\n", searchEntity)
+				for _, e := range entities {
+					fmt.Printf("  [%s] %s (%s, %s)\n", e.Timestamp.Format("2006-01-02 15:04:05"), e.Value, e.ActiveApp, entitySource(e))
+				}
+				fmt.Println()
+			}
 			if len(results) == 0 {
-				fmt.Println("No results found.")
+				if len(entities) == 0 {
+					fmt.Println("No results found.")
+				}
 				return nil
 			}
 			fmt.Printf("Found %d results for \"%s\":\n\n", len(results), query)
 			for _, r := range results {
 				fmt.Printf("[%s] %s - %s\n", r.Timestamp.Format("2006-01-02 15:04:05"), r.ActiveApp, r.ActiveWindowTitle)
 				fmt.Printf("  Screenshot: %s\n", r.Filepath)
-				if r.OCRText != "" {
+				if searchNew && r.OCRNewText != "" {
+					fmt.Printf("  New: %s\n", truncate(strings.ReplaceAll(r.OCRNewText, "\n", " | "), 100))
+				} else if r.OCRText != "" {
 					snippet := r.OCRText
 					if len(snippet) > 100 {
 						snippet = snippet[:100] + "..."
 					}
-					fmt.Printf("  OCR: %s\n", snippet)
+					if r.OCRLanguage != "" {
+						fmt.Printf("  OCR (%s): %s\n", r.OCRLanguage, snippet)
+					} else {
+						fmt.Printf("  OCR: %s\n", snippet)
+					}
 				}
 				fmt.Println()
 			}
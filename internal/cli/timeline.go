@@ -2,17 +2,22 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/mahirisikli/memento/internal/textdiff"
 	"github.com/spf13/cobra"
 )
 
 var (
-	timelineDate  string
-	timelineFrom  string
-	timelineTo    string
-	timelineLimit int
+	timelineDate        string
+	timelineFrom        string
+	timelineTo          string
+	timelineLimit       int
+	timelineChanges     bool
+	timelineActivities  bool
+	timelineInteractive bool
 )
 
 func init() {
@@ -20,12 +25,18 @@ func init() {
 	timelineCmd.Flags().StringVar(&timelineFrom, "from", "", "Start date")
 	timelineCmd.Flags().StringVar(&timelineTo, "to", "", "End date")
 	timelineCmd.Flags().IntVar(&timelineLimit, "limit", 100, "Maximum results")
+	timelineCmd.Flags().BoolVar(&timelineChanges, "changes", false, "Show only text that newly appeared on screen in each capture")
+	timelineCmd.Flags().BoolVarP(&timelineInteractive, "interactive", "i", false, "Browse the day in a full-screen terminal UI")
+	timelineCmd.Flags().BoolVar(&timelineActivities, "activities", false, "Group the timeline into work sessions split by idle gaps and context switches")
 }
 
 var timelineCmd = &cobra.Command{
 	Use:   "timeline",
 	Short: "Browse activity timeline",
-	Long:  `View a timeline of captured screenshots and activity for a specific date or range.`,
+	Long: `View a timeline of captured screenshots and activity for a specific date or range.
+
+With --activities, show the work sessions the daemon stores, updated hourly.
+Days it has stored nothing for are grouped on the fly.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		now := time.Now()
 		var from, to time.Time
@@ -44,17 +55,42 @@ var timelineCmd = &cobra.Command{
 			}
 		}
 
-		db, err := storage.NewDB(getStoragePath())
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
 		defer db.Close()
 
+		if timelineInteractive {
+			fm, err := openFiles(storagePath)
+			if err != nil {
+				return err
+			}
+			return runBrowser(db, fm, from)
+		}
+
+		if timelineActivities {
+			config, err := LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			activities, err := loadActivities(db, config, from, to)
+			if err != nil {
+				return err
+			}
+			return outputTimelineActivities(from, to, activities)
+		}
+
 		results, err := db.GetScreenshotsByDateRange(from, to, timelineLimit)
 		if err != nil {
 			return fmt.Errorf("failed to get timeline: %w", err)
 		}
 
+		if timelineChanges {
+			return outputTimelineChanges(from, to, results)
+		}
+
 		format := getOutputFormat()
 		switch format {
 		case "json":
@@ -98,3 +134,136 @@ var timelineCmd = &cobra.Command{
 		return nil
 	},
 }
+
+func outputTimelineChanges(from, to time.Time, results []storage.Screenshot) error {
+	var changed []storage.Screenshot
+	for _, r := range results {
+		if r.OCRNewText != "" {
+			changed = append(changed, r)
+		}
+	}
+
+	format := getOutputFormat()
+	switch format {
+	case "json":
+		type change struct {
+			ID                   int64     `json:"id"`
+			Timestamp            time.Time `json:"timestamp"`
+			App                  string    `json:"app,omitempty"`
+			Window               string    `json:"window,omitempty"`
+			PreviousScreenshotID int64     `json:"previous_screenshot_id,omitempty"`
+			NewText              []string  `json:"new_text"`
+		}
+		changes := make([]change, 0, len(changed))
+		for _, r := range changed {
+			changes = append(changes, change{
+				ID:                   r.ID,
+				Timestamp:            r.Timestamp,
+				App:                  r.ActiveApp,
+				Window:               r.ActiveWindowTitle,
+				PreviousScreenshotID: r.PreviousScreenshotID,
+				NewText:              strings.Split(r.OCRNewText, "\n"),
+			})
+		}
+		outputJSON(map[string]interface{}{
+			"from":    from,
+			"to":      to,
+			"count":   len(changes),
+			"changes": changes,
+		})
+	case "plain":
+		headers := []string{"id", "timestamp", "app", "window", "new_text"}
+		var rows [][]string
+		for _, r := range changed {
+			rows = append(rows, []string{
+				fmt.Sprintf("%d", r.ID),
+				r.Timestamp.Format(time.RFC3339),
+				r.ActiveApp,
+				r.ActiveWindowTitle,
+				strings.ReplaceAll(r.OCRNewText, "\n", " | "),
+			})
+		}
+		outputPlain(headers, rows)
+	default:
+		if len(changed) == 0 {
+			fmt.Printf("No screen changes found for %s to %s\n", from.Format("2006-01-02"), to.Format("2006-01-02"))
+			return nil
+		}
+		fmt.Printf("Screen changes: %s to %s (%d captures)\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), len(changed))
+		for _, r := range changed {
+			fmt.Printf("\n[%s] %s - %s\n", r.Timestamp.Format("15:04:05"), r.ActiveApp, r.ActiveWindowTitle)
+			for _, line := range strings.Split(r.OCRNewText, "\n") {
+				fmt.Printf("  + %s\n", truncate(line, 120))
+			}
+		}
+	}
+	return nil
+}
+
+// storeScreenDiff records which OCR text in s was not on screen in the
+// previous capture of the same app and window.
+func storeScreenDiff(db *storage.DB, s *storage.Screenshot) error {
+	previous, err := db.GetPreviousScreenshot(s)
+	if err != nil {
+		return err
+	}
+
+	var previousID int64
+	var previousText string
+	if previous != nil {
+		previousID = previous.ID
+		previousText = previous.OCRText
+	}
+	added := textdiff.Added(previousText, s.OCRText)
+	s.PreviousScreenshotID = previousID
+	s.OCRNewText = strings.Join(added, "\n")
+	return db.UpdateScreenshotDiff(s.ID, previousID, s.OCRNewText)
+}
+
+func outputTimelineActivities(from, to time.Time, activities []storage.Activity) error {
+	format := getOutputFormat()
+	switch format {
+	case "json":
+		outputJSON(map[string]interface{}{
+			"from":       from,
+			"to":         to,
+			"count":      len(activities),
+			"activities": activities,
+		})
+	case "plain":
+		headers := []string{"start", "end", "seconds", "app", "titles", "keywords", "screenshots", "typing_sessions", "keystrokes"}
+		var rows [][]string
+		for _, a := range activities {
+			rows = append(rows, []string{
+				a.StartTime.Format(time.RFC3339),
+				a.EndTime.Format(time.RFC3339),
+				fmt.Sprintf("%.0f", a.DurationSeconds),
+				a.DominantApp,
+				strings.Join(a.Titles, " | "),
+				strings.Join(a.Keywords, ","),
+				fmt.Sprintf("%d", a.ScreenshotCount),
+				fmt.Sprintf("%d", a.TypingSessionCount),
+				fmt.Sprintf("%d", a.Keystrokes),
+			})
+		}
+		outputPlain(headers, rows)
+	default:
+		if len(activities) == 0 {
+			fmt.Printf("No activity found for %s to %s\n", from.Format("2006-01-02"), to.Format("2006-01-02"))
+			return nil
+		}
+		fmt.Printf("Activities: %s to %s (%d)\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), len(activities))
+		for _, a := range activities {
+			fmt.Printf("\n[%s - %s] %s  %s\n", a.StartTime.Format("15:04"), a.EndTime.Format("15:04"),
+				formatDuration(secondsDuration(a.DurationSeconds)), strings.Join(a.Apps, ", "))
+			for _, title := range a.Titles {
+				fmt.Printf("  %s\n", truncate(title, 80))
+			}
+			if len(a.Keywords) > 0 {
+				fmt.Printf("  Keywords: %s\n", strings.Join(a.Keywords, ", "))
+			}
+			fmt.Printf("  %d screenshots, %d typing sessions, %d keys\n", a.ScreenshotCount, a.TypingSessionCount, a.Keystrokes)
+		}
+	}
+	return nil
+}
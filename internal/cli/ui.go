@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+	"github.com/mahirisikli/memento/internal/web"
+	"github.com/spf13/cobra"
+)
+
+var (
+	uiPort int
+	uiOpen bool
+)
+
+func init() {
+	uiCmd.Flags().IntVar(&uiPort, "port", 8765, "Port to listen on (localhost only)")
+	uiCmd.Flags().BoolVar(&uiOpen, "open", false, "Open the UI in the default browser")
+}
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Browse and search the archive in a web browser",
+	Long: `Serve a local web UI for the archive: a calendar to pick a day, a filmstrip of
+screenshots with a lightbox and OCR text overlay, the day's typing sessions and
+full-text search with highlighted snippets.
+
+The server listens on 127.0.0.1 only and all assets are built in, so nothing
+is loaded from the network. The printed URL holds a token that changes with
+every run; requests without it are refused, so other users and processes on
+the Mac can't read the archive. Stop it with Ctrl-C.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storagePath := getStoragePath()
+		db, err := openDB(storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open database: %w", err)
+		}
+		defer db.Close()
+		fm, err := openFiles(storagePath)
+		if err != nil {
+			return err
+		}
+
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		token := hex.EncodeToString(secret)
+
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(uiPort))
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		server := &http.Server{
+			Handler: web.NewServer(db, fm, token, func(s *storage.Screenshot) (string, error) {
+				return ensureThumbnail(db, fm, s)
+			}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		url := "http://" + listener.Addr().String() + "/?token=" + token
+		fmt.Printf("Memento UI running at %s (Ctrl-C to stop)\n", url)
+		if uiOpen {
+			if err := exec.Command("open", url).Start(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to open browser: %v\n", err)
+			}
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigCh
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
+
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server failed: %w", err)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SheetOptions controls the contact sheet layout.
+type SheetOptions struct {
+	// Title is printed above the grid
+	Title   string
+	Columns int
+	// TileWidth is the width of one screenshot in pixels; tiles are 16:10
+	TileWidth int
+}
+
+const sheetGap = 8
+
+// ContactSheet lays frames out in a grid, each labelled with its time and
+// app. Frames that can't be decoded are drawn as empty tiles.
+func ContactSheet(frames []Frame, opts SheetOptions) (*image.RGBA, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no screenshots to render")
+	}
+	if opts.Columns <= 0 {
+		opts.Columns = 6
+	}
+	if opts.TileWidth <= 0 {
+		opts.TileWidth = 320
+	}
+	columns := min(opts.Columns, len(frames))
+	rows := (len(frames) + columns - 1) / columns
+	tileW := opts.TileWidth
+	tileH := tileW * 10 / 16
+
+	titleScale := 3
+	header := sheetGap
+	if opts.Title != "" {
+		header += cellHeight*titleScale + sheetGap
+	}
+	width := columns*(tileW+sheetGap) + sheetGap
+	height := header + rows*(tileH+sheetGap)
+
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	if opts.Title != "" {
+		drawText(sheet, sheetGap, sheetGap, fitText(opts.Title, width-2*sheetGap, titleScale), titleScale, textColor)
+	}
+
+	for i, f := range frames {
+		x := sheetGap + (i%columns)*(tileW+sheetGap)
+		y := header + (i/columns)*(tileH+sheetGap)
+		tile := image.Rect(x, y, x+tileW, y+tileH)
+
+		img, err := loadFrame(f.Path, tileW)
+		if err != nil {
+			drawText(sheet, x+sheetGap, y+tileH/2, "unavailable", 1, mutedColor)
+		} else {
+			drawFitted(sheet, tile, img)
+		}
+		drawLabel(sheet, tile, f.Label(), max(1, tileW/160))
+	}
+	return sheet, nil
+}
+
+// WriteImage encodes img as PNG or JPEG depending on the extension of path.
+func WriteImage(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85})
+	default:
+		err = png.Encode(f, img)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	return f.Close()
+}
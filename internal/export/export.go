@@ -0,0 +1,103 @@
+// Package export renders a day's screenshots into contact sheets and
+// timelapse videos with timestamp and app overlays.
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/capture"
+)
+
+// Frame is one screenshot to render.
+type Frame struct {
+	Path  string
+	Time  time.Time
+	App   string
+	Title string
+}
+
+// Label is the overlay text for the frame: time, app and window title.
+func (f Frame) Label() string {
+	label := f.Time.Format("15:04")
+	if f.App != "" {
+		label += "  " + f.App
+	}
+	if f.Title != "" && f.Title != f.App {
+		label += " - " + f.Title
+	}
+	return label
+}
+
+var (
+	background = color.RGBA{0x18, 0x18, 0x18, 0xff}
+	barColor   = color.RGBA{0x00, 0x00, 0x00, 0xb4}
+	textColor  = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	mutedColor = color.RGBA{0xa0, 0xa0, 0xa0, 0xff}
+)
+
+// loadFrame decodes a screenshot scaled so its longest side is at most
+// maxSize pixels.
+func loadFrame(path string, maxSize int) (image.Image, error) {
+	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("memento_export_%d.png", time.Now().UnixNano()))
+	defer os.Remove(tmp)
+	if err := capture.ConvertToPNG(path, tmp, maxSize); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// drawFitted draws src scaled to fit inside rect, centered, keeping its
+// aspect ratio. Scaling is nearest-neighbour; src is expected to be close to
+// the target size already.
+func drawFitted(dst draw.Image, rect image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if sb.Empty() || rect.Empty() {
+		return
+	}
+	w, h := rect.Dx(), rect.Dy()
+	if sb.Dx()*h > sb.Dy()*w {
+		h = sb.Dy() * w / sb.Dx()
+	} else {
+		w = sb.Dx() * h / sb.Dy()
+	}
+	x0 := rect.Min.X + (rect.Dx()-w)/2
+	y0 := rect.Min.Y + (rect.Dy()-h)/2
+
+	if w == sb.Dx() && h == sb.Dy() {
+		draw.Draw(dst, image.Rect(x0, y0, x0+w, y0+h), src, sb.Min, draw.Src)
+		return
+	}
+	for y := 0; y < h; y++ {
+		sy := sb.Min.Y + y*sb.Dy()/h
+		for x := 0; x < w; x++ {
+			dst.Set(x0+x, y0+y, src.At(sb.Min.X+x*sb.Dx()/w, sy))
+		}
+	}
+}
+
+// drawLabel draws text on a translucent bar along the bottom of rect.
+func drawLabel(dst draw.Image, rect image.Rectangle, text string, scale int) {
+	pad := 2 * scale
+	barHeight := cellHeight*scale + 2*pad
+	bar := image.Rect(rect.Min.X, rect.Max.Y-barHeight, rect.Max.X, rect.Max.Y)
+	draw.Draw(dst, bar, image.NewUniform(barColor), image.Point{}, draw.Over)
+	text = fitText(text, rect.Dx()-2*pad, scale)
+	drawText(dst, bar.Min.X+pad, bar.Min.Y+pad, text, scale, textColor)
+}
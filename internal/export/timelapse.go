@@ -0,0 +1,160 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TimelapseFormats are the supported output extensions.
+var TimelapseFormats = []string{".mp4", ".gif", ".webp"}
+
+// TimelapseOptions controls timelapse rendering.
+type TimelapseOptions struct {
+	FPS int
+	// Width of the video in pixels; frames are 16:10
+	Width int
+	// Progress, if set, is called after each rendered frame
+	Progress func(done, total int)
+}
+
+// Timelapse renders frames into an animation at path. The format follows
+// the extension: .gif is encoded natively, .webp needs img2webp (libwebp)
+// and .mp4 needs ffmpeg.
+func Timelapse(frames []Frame, path string, opts TimelapseOptions) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no screenshots to render")
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if err := checkEncoder(ext); err != nil {
+		return err
+	}
+	if opts.FPS <= 0 {
+		opts.FPS = 4
+	}
+	if opts.Width <= 0 {
+		opts.Width = 1280
+		if ext == ".gif" {
+			opts.Width = 800
+		}
+	}
+	// Video encoders want even dimensions
+	width := opts.Width &^ 1
+	height := (width * 10 / 16) &^ 1
+
+	switch ext {
+	case ".gif":
+		return timelapseGIF(frames, path, width, height, opts)
+	case ".mp4", ".webp":
+		dir, err := os.MkdirTemp("", "memento_timelapse_")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		var files []string
+		for i, f := range frames {
+			img := renderFrame(f, width, height)
+			file := filepath.Join(dir, fmt.Sprintf("frame_%05d.png", i))
+			if err := WriteImage(img, file); err != nil {
+				return err
+			}
+			files = append(files, file)
+			if opts.Progress != nil {
+				opts.Progress(i+1, len(frames))
+			}
+		}
+		if ext == ".mp4" {
+			return encodeMP4(dir, path, opts.FPS)
+		}
+		return encodeWebP(files, path, opts.FPS)
+	}
+	return nil
+}
+
+// checkEncoder fails early, before any frames are rendered, if ext is not a
+// supported format or its encoder isn't installed.
+func checkEncoder(ext string) error {
+	var tool, pkg string
+	switch ext {
+	case ".gif":
+		return nil
+	case ".mp4":
+		tool, pkg = "ffmpeg", "ffmpeg"
+	case ".webp":
+		tool, pkg = "img2webp", "webp"
+	default:
+		return fmt.Errorf("unsupported timelapse format %q (use %s)", ext, strings.Join(TimelapseFormats, ", "))
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s not found (install with: brew install %s)", tool, pkg)
+	}
+	return nil
+}
+
+// renderFrame draws one screenshot letterboxed to width x height with its
+// label along the bottom.
+func renderFrame(f Frame, width, height int) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	if img, err := loadFrame(f.Path, width); err == nil {
+		drawFitted(frame, frame.Bounds(), img)
+	}
+	drawLabel(frame, frame.Bounds(), f.Label(), max(2, width/640))
+	return frame
+}
+
+func timelapseGIF(frames []Frame, path string, width, height int, opts TimelapseOptions) error {
+	anim := &gif.GIF{LoopCount: 0}
+	delay := max(1, 100/opts.FPS)
+	for i, f := range frames {
+		img := renderFrame(f, width, height)
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(frames))
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(out, anim); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return out.Close()
+}
+
+func encodeMP4(dir, path string, fps int) error {
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-framerate", strconv.Itoa(fps),
+		"-i", filepath.Join(dir, "frame_%05d.png"),
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart",
+		path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func encodeWebP(files []string, path string, fps int) error {
+	args := []string{"-loop", "0", "-lossy", "-q", "75", "-d", strconv.Itoa(1000 / fps)}
+	args = append(args, files...)
+	args = append(args, "-o", path)
+	cmd := exec.Command("img2webp", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("img2webp failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
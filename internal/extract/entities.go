@@ -0,0 +1,162 @@
+package extract
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	TypeURL    = "url"
+	TypeEmail  = "email"
+	TypePath   = "path"
+	TypeGitSHA = "git_sha"
+	TypeIssue  = "issue"
+	TypeIP     = "ip"
+	TypePhone  = "phone"
+)
+
+// Types lists every entity type in the order they are extracted.
+var Types = []string{TypeURL, TypeEmail, TypePath, TypeGitSHA, TypeIssue, TypeIP, TypePhone}
+
+type Entity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+var (
+	urlPattern      = regexp.MustCompile(`\b(?:https?://|www\.)[^\s<>"'` + "`" + `]+`)
+	emailPattern    = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)
+	pathPattern     = regexp.MustCompile(`(?:^|[\s"'(=:])((?:~|\.{1,2})?/[\w.@+-]+(?:/[\w.@+-]+)+/?)`)
+	shaPattern      = regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)
+	issuePattern    = regexp.MustCompile(`\b[A-Z][A-Z0-9]{1,9}-[1-9][0-9]{0,6}\b`)
+	ipv4Pattern     = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern     = regexp.MustCompile(`(?i)(?:^|[^\w:])([0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7})(?:$|[^\w:])`)
+	phonePattern    = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\d{2,8}(?:[\s.-]\d{2,8}){0,4}`)
+	nanpPattern     = regexp.MustCompile(`^\d{3}[-.\s]\d{3}[-.\s]\d{4}$`)
+	nationalPattern = regexp.MustCompile(`^0\d{2,4}[-\s/]\d{3,8}(?:[-\s]\d{2,5})?$`)
+	datePattern     = regexp.MustCompile(`^\d{4}[-./]\d{1,2}[-./]\d{1,2}$|^\d{1,2}[-./]\d{1,2}[-./]\d{2,4}$`)
+	trailingPunct   = ".,;:!?)]}'\""
+)
+
+// Prefixes that look like issue keys but are standards or encodings.
+var issueDenylist = map[string]bool{
+	"UTF": true, "ISO": true, "SHA": true, "RFC": true, "AES": true, "CVE": true,
+	"MD": true, "GPT": true, "HTTP": true, "TLS": true, "SSL": true, "IPV": true,
+	"COVID": true, "ES": true, "ECMA": true, "PEP": true, "WCAG": true,
+}
+
+// Extract finds URLs, email addresses, file paths, git SHAs, issue keys,
+// IP addresses and phone numbers in text. Each distinct value is reported
+// once per type.
+func Extract(text string) []Entity {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	var entities []Entity
+	seen := make(map[Entity]bool)
+	add := func(typ, value string) {
+		e := Entity{Type: typ, Value: value}
+		if value == "" || seen[e] {
+			return
+		}
+		seen[e] = true
+		entities = append(entities, e)
+	}
+
+	// URLs and emails are masked out afterwards so their parts are not
+	// reported again as paths, SHAs or phone numbers.
+	masked := []byte(text)
+	mask := func(loc []int) {
+		for i := loc[0]; i < loc[1]; i++ {
+			masked[i] = ' '
+		}
+	}
+
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		add(TypeURL, strings.TrimRight(text[loc[0]:loc[1]], trailingPunct))
+		mask(loc)
+	}
+	for _, loc := range emailPattern.FindAllStringIndex(string(masked), -1) {
+		add(TypeEmail, text[loc[0]:loc[1]])
+		mask(loc)
+	}
+
+	rest := string(masked)
+	for _, m := range pathPattern.FindAllStringSubmatch(rest, -1) {
+		add(TypePath, strings.TrimRight(m[1], trailingPunct))
+	}
+	for _, m := range shaPattern.FindAllString(rest, -1) {
+		if isGitSHA(m) {
+			add(TypeGitSHA, m)
+		}
+	}
+	for _, m := range issuePattern.FindAllString(rest, -1) {
+		key := m[:strings.IndexByte(m, '-')]
+		if !issueDenylist[key] {
+			add(TypeIssue, m)
+		}
+	}
+	for _, loc := range ipv4Pattern.FindAllStringIndex(rest, -1) {
+		if ip := net.ParseIP(rest[loc[0]:loc[1]]); ip != nil {
+			add(TypeIP, ip.String())
+			mask(loc)
+		}
+	}
+	for _, m := range ipv6Pattern.FindAllStringSubmatch(rest, -1) {
+		candidate := m[1]
+		if !strings.Contains(candidate, "::") && strings.Count(candidate, ":") != 7 {
+			continue
+		}
+		if ip := net.ParseIP(candidate); ip != nil && ip.To4() == nil {
+			add(TypeIP, ip.String())
+		}
+	}
+
+	rest = string(masked)
+	for _, m := range phonePattern.FindAllString(rest, -1) {
+		if isPhoneNumber(m) {
+			add(TypePhone, strings.TrimSpace(m))
+		}
+	}
+
+	return entities
+}
+
+// isGitSHA rejects hex runs that are more likely plain numbers or words.
+func isGitSHA(s string) bool {
+	hasDigit, hasLetter := false, false
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			hasDigit = true
+		} else {
+			hasLetter = true
+		}
+	}
+	return hasDigit && hasLetter
+}
+
+func isPhoneNumber(s string) bool {
+	s = strings.TrimSpace(s)
+	if datePattern.MatchString(s) {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if digits < 8 || digits > 15 {
+		return false
+	}
+	// Without a country code or area code in parentheses, only accept the
+	// shapes of written numbers (555-123-4567, 030 1234567) so that tables
+	// of plain numbers are not mistaken for phone numbers.
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "00") || strings.Contains(s, "(") {
+		return true
+	}
+	return nanpPattern.MatchString(s) || nationalPattern.MatchString(s)
+}
@@ -0,0 +1,82 @@
+package ocr
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Common short words per language. Screen text is noisy (menus, code, URLs),
+// so function words are a more reliable signal than full dictionaries.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "for", "with", "on", "this", "you", "are", "not", "be", "it", "from", "or", "have", "was"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "mit", "den", "dem", "zu", "von", "auf", "für", "sie", "ich", "es", "auch", "wir"},
+	"tr": {"ve", "bir", "bu", "değil", "şey", "için", "ile", "çok", "ne", "daha", "gibi", "olarak", "ama", "var", "yok", "sonra", "kadar", "ben", "sen", "mi"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "pour", "pas", "que", "qui", "dans", "sur", "avec", "vous", "nous", "du", "au", "ce"},
+	"es": {"el", "la", "los", "las", "y", "es", "que", "en", "un", "una", "por", "con", "para", "no", "se", "del", "al", "como", "pero", "lo"},
+}
+
+// Letters that only (or almost only) occur in one of the supported languages.
+var distinctLetters = map[string]string{
+	"de": "äß",
+	"tr": "ğışİ",
+	"fr": "àâæèêëîïôœùûÿ",
+	"es": "ñ¿¡áíóú",
+}
+
+// DetectLanguage picks the candidate language (BCP-47 tags such as "de-DE")
+// that best matches text. It returns the first candidate when there is no
+// clear signal, and "" when text is empty.
+func DetectLanguage(text string, candidates []string) string {
+	if strings.TrimSpace(text) == "" || len(candidates) == 0 {
+		return ""
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	lower := strings.ToLower(text)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	best := candidates[0]
+	bestScore := 0
+	for _, candidate := range candidates {
+		base := baseLanguage(candidate)
+		score := 0
+
+		if list, ok := stopwords[base]; ok {
+			set := make(map[string]bool, len(list))
+			for _, w := range list {
+				set[w] = true
+			}
+			for _, w := range words {
+				if set[w] {
+					score++
+				}
+			}
+		}
+
+		if letters, ok := distinctLetters[base]; ok {
+			for _, r := range text {
+				if strings.ContainsRune(letters, r) {
+					score += 2
+				}
+			}
+		}
+
+		if score > bestScore {
+			best = candidate
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func baseLanguage(tag string) string {
+	tag = strings.ToLower(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,52 @@
+# Long-lived OCR helper for memento.
+#
+# Speaks line-delimited JSON on stdin/stdout: each request is a single line
+#   {"id": 1, "method": "recognize", "params": {...}}
+# and is answered by a single line
+#   {"id": 1, "result": ...} or {"id": 1, "error": "..."}
+import json
+import sys
+
+# Keep stdout reserved for protocol messages; anything a library prints
+# goes to stderr instead.
+out = sys.stdout
+sys.stdout = sys.stderr
+
+from ocrmac import ocrmac
+
+
+def recognize(params):
+    result = ocrmac.OCR(
+        params["image"],
+        recognition_level=params.get("recognition_level", "accurate"),
+        language_preference=params.get("languages") or None,
+    ).recognize()
+    return [
+        {"text": text, "confidence": confidence, "bounding_box": list(bbox)}
+        for text, confidence, bbox in result
+    ]
+
+
+METHODS = {
+    "ping": lambda params: "pong",
+    "recognize": recognize,
+}
+
+for line in sys.stdin:
+    line = line.strip()
+    if not line:
+        continue
+    try:
+        request = json.loads(line)
+    except ValueError as e:
+        response = {"id": None, "error": "invalid request: %s" % e}
+    else:
+        try:
+            method = METHODS[request.get("method")]
+            response = {"id": request.get("id"), "result": method(request.get("params") or {})}
+        except KeyError as e:
+            response = {"id": request.get("id"), "error": "unknown method or missing param: %s" % e}
+        except Exception as e:
+            response = {"id": request.get("id"), "error": "%s: %s" % (type(e).__name__, e)}
+    out.write(json.dumps(response) + "\n")
+    out.flush()
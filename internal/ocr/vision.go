@@ -1,7 +1,7 @@
 package ocr
 
 import (
-	"encoding/json"
+	_ "embed"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,20 +10,37 @@ import (
 )
 
 type OCRResult struct {
-	Text       string    `json:"text"`
-	Confidence float64   `json:"confidence"`
+	Text        string    `json:"text"`
+	Confidence  float64   `json:"confidence"`
 	BoundingBox []float64 `json:"bounding_box"`
 }
 
+// Engine is an OCR backend. Backends that need an external runtime run it
+// through a Worker so the interpreter is started once, not per image.
+type Engine interface {
+	Recognize(imagePath string) ([]OCRResult, error)
+	Close() error
+}
+
+//go:embed ocrmac_worker.py
+var ocrmacWorkerScript string
+
+// OCREngine recognizes text with the macOS Vision framework via ocrmac.
 type OCREngine struct {
 	recognitionLevel string
-	language         string
+	languages        []string
+	worker           *Worker
 }
 
+var _ Engine = (*OCREngine)(nil)
+
+// defaultLanguages are used when no languages are configured.
+var defaultLanguages = []string{"en-US"}
+
 func NewOCREngine() *OCREngine {
 	return &OCREngine{
 		recognitionLevel: "accurate",
-		language:         "en-US",
+		languages:        defaultLanguages,
 	}
 }
 
@@ -34,7 +51,32 @@ func (e *OCREngine) SetRecognitionLevel(level string) {
 }
 
 func (e *OCREngine) SetLanguage(lang string) {
-	e.language = lang
+	e.SetLanguages([]string{lang})
+}
+
+// SetLanguages sets the recognition languages in order of preference. An
+// empty list restores the default.
+func (e *OCREngine) SetLanguages(langs []string) {
+	var cleaned []string
+	for _, l := range langs {
+		if l = strings.TrimSpace(l); l != "" {
+			cleaned = append(cleaned, l)
+		}
+	}
+	if len(cleaned) == 0 {
+		cleaned = defaultLanguages
+	}
+	e.languages = cleaned
+}
+
+// ExtractTextWithLanguage runs OCR and reports which of the configured
+// languages the recognized text is most likely written in.
+func (e *OCREngine) ExtractTextWithLanguage(imagePath string) (string, string, error) {
+	text, err := e.ExtractText(imagePath)
+	if err != nil {
+		return "", "", err
+	}
+	return text, DetectLanguage(text, e.languages), nil
 }
 
 func (e *OCREngine) ExtractText(imagePath string) (string, error) {
@@ -51,21 +93,33 @@ func (e *OCREngine) ExtractText(imagePath string) (string, error) {
 }
 
 func (e *OCREngine) Recognize(imagePath string) ([]OCRResult, error) {
-	script := fmt.Sprintf(`
-import json
-from ocrmac import ocrmac
-result = ocrmac.OCR('%s', recognition_level='%s', language_preference=['%s']).recognize()
-output = []
-for text, confidence, bbox in result:
-    output.append({
-        "text": text,
-        "confidence": confidence,
-        "bounding_box": bbox
-    })
-print(json.dumps(output))
-`, imagePath, e.recognitionLevel, e.language)
-
-	// Try to find python in memento's venv first
+	if e.worker == nil {
+		e.worker = NewWorker("ocrmac worker", findPython(), "-u", "-c", ocrmacWorkerScript)
+	}
+
+	params := map[string]interface{}{
+		"image":             imagePath,
+		"recognition_level": e.recognitionLevel,
+		"languages":         e.languages,
+	}
+	var results []OCRResult
+	if err := e.worker.Call("recognize", params, &results); err != nil {
+		return nil, fmt.Errorf("OCR failed: %w", err)
+	}
+	return results, nil
+}
+
+// Close stops the OCR worker process, if one was started.
+func (e *OCREngine) Close() error {
+	if e.worker == nil {
+		return nil
+	}
+	return e.worker.Close()
+}
+
+// findPython prefers memento's own venv (where ocrmac is installed) over the
+// system python3.
+func findPython() string {
 	pythonPath := "python3"
 	execPath, _ := os.Executable()
 	if execPath != "" {
@@ -88,22 +142,7 @@ print(json.dumps(output))
 			pythonPath = venvPython
 		}
 	}
-
-	cmd := exec.Command(pythonPath, "-c", script)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("OCR failed: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("OCR failed: %w", err)
-	}
-	
-	var results []OCRResult
-	if err := json.Unmarshal(output, &results); err != nil {
-		return nil, fmt.Errorf("failed to parse OCR output: %w", err)
-	}
-	
-	return results, nil
+	return pythonPath
 }
 
 func CheckOCRAvailable() bool {
@@ -119,7 +158,7 @@ except ImportError:
     except ImportError:
         print("none")
 `
-	cmd := exec.Command("python3", "-c", script)
+	cmd := exec.Command(findPython(), "-c", script)
 	output, err := cmd.Output()
 	if err != nil {
 		return false
@@ -0,0 +1,286 @@
+package ocr
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkerTimeout = 2 * time.Minute
+	maxWorkerRestarts    = 5
+	workerRestartWindow  = time.Minute
+)
+
+// Worker supervises a long-lived helper process for Engine backends that need
+// an external runtime. Requests and responses are single-line JSON objects
+// exchanged over the helper's stdin and stdout. The process is started on the
+// first call and restarted if it crashes or stops responding.
+type Worker struct {
+	name    string
+	path    string
+	args    []string
+	timeout time.Duration
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	pipe     *os.File
+	stdout   *bufio.Reader
+	stderr   *tailWriter
+	exited   chan struct{}
+	nextID   int64
+	restarts []time.Time
+	closed   bool
+}
+
+type workerRequest struct {
+	ID     int64       `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type workerResponse struct {
+	ID     *int64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// errWorkerDied marks failures caused by the helper process rather than by the
+// request itself; those are retried once on a fresh process.
+var errWorkerDied = errors.New("worker process died")
+
+func NewWorker(name, path string, args ...string) *Worker {
+	return &Worker{
+		name:    name,
+		path:    path,
+		args:    args,
+		timeout: defaultWorkerTimeout,
+	}
+}
+
+// SetTimeout bounds how long a single request may take before the helper is
+// considered hung and killed.
+func (w *Worker) SetTimeout(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if d > 0 {
+		w.timeout = d
+	}
+}
+
+// Call sends one request and decodes the helper's result into result.
+func (w *Worker) Call(method string, params, result interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("%s worker is closed", w.name)
+	}
+
+	err := w.callLocked(method, params, result)
+	if errors.Is(err, errWorkerDied) {
+		// The helper crashed or hung; retry once on a fresh process
+		err = w.callLocked(method, params, result)
+	}
+	return err
+}
+
+func (w *Worker) callLocked(method string, params, result interface{}) error {
+	if !w.runningLocked() {
+		if err := w.startLocked(); err != nil {
+			return err
+		}
+	}
+
+	w.nextID++
+	id := w.nextID
+	line, err := json.Marshal(workerRequest{ID: id, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", w.name, err)
+	}
+	if _, err := w.stdin.Write(append(line, '\n')); err != nil {
+		w.stopLocked()
+		return fmt.Errorf("%w: %s: %v%s", errWorkerDied, w.name, err, w.stderr.suffix())
+	}
+
+	type readResult struct {
+		line []byte
+		err  error
+	}
+	done := make(chan readResult, 1)
+	stdout := w.stdout
+	go func() {
+		line, err := stdout.ReadBytes('\n')
+		done <- readResult{line, err}
+	}()
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	var read readResult
+	select {
+	case read = <-done:
+	case <-timer.C:
+		w.stopLocked()
+		return fmt.Errorf("%w: %s did not answer within %s", errWorkerDied, w.name, w.timeout)
+	}
+	if read.err != nil {
+		w.stopLocked()
+		return fmt.Errorf("%w: %s: %v%s", errWorkerDied, w.name, read.err, w.stderr.suffix())
+	}
+
+	var resp workerResponse
+	if err := json.Unmarshal(read.line, &resp); err != nil {
+		// Output is out of sync with our requests; start over
+		w.stopLocked()
+		return fmt.Errorf("failed to parse %s response: %w", w.name, err)
+	}
+	if resp.ID != nil && *resp.ID != id {
+		w.stopLocked()
+		return fmt.Errorf("%s answered request %d, expected %d", w.name, *resp.ID, id)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s: %s", w.name, resp.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to parse %s result: %w", w.name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) runningLocked() bool {
+	if w.cmd == nil {
+		return false
+	}
+	select {
+	case <-w.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+func (w *Worker) startLocked() error {
+	w.stopLocked()
+
+	// Give up if the helper keeps crashing instead of restarting forever
+	now := time.Now()
+	var recent []time.Time
+	for _, t := range w.restarts {
+		if now.Sub(t) < workerRestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= maxWorkerRestarts {
+		w.restarts = recent
+		return fmt.Errorf("%s restarted %d times in the last %s, giving up%s", w.name, len(recent), workerRestartWindow, w.stderr.suffix())
+	}
+	w.restarts = append(recent, now)
+
+	cmd := exec.Command(w.path, w.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", w.name, err)
+	}
+	// Our own pipe rather than StdoutPipe: Wait closes that one, which must
+	// not happen while a request is still reading the helper's output.
+	stdout, pw, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return fmt.Errorf("failed to start %s: %w", w.name, err)
+	}
+	cmd.Stdout = pw
+	stderr := &tailWriter{max: 4096}
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	pw.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return fmt.Errorf("failed to start %s: %w", w.name, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	w.cmd = cmd
+	w.stdin = stdin
+	w.pipe = stdout
+	w.stdout = bufio.NewReader(stdout)
+	w.stderr = stderr
+	w.exited = exited
+	return nil
+}
+
+func (w *Worker) stopLocked() {
+	if w.cmd == nil {
+		return
+	}
+	w.stdin.Close()
+	select {
+	case <-w.exited:
+	case <-time.After(2 * time.Second):
+		w.cmd.Process.Kill()
+		<-w.exited
+	}
+	// Unblocks a read left behind by a timed out request
+	w.pipe.Close()
+	w.cmd = nil
+	w.stdin = nil
+	w.pipe = nil
+	w.stdout = nil
+}
+
+// Close stops the helper process. Further calls fail.
+func (w *Worker) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.stopLocked()
+	return nil
+}
+
+// tailWriter keeps the last max bytes written to it, used to surface the
+// helper's stderr in error messages.
+type tailWriter struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) suffix() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := strings.TrimSpace(string(t.buf))
+	if s == "" {
+		return ""
+	}
+	return " (stderr: " + s + ")"
+}
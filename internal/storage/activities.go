@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// Activity is a contiguous work session: screenshots, typing sessions and
+// focus events between idle gaps or context switches.
+type Activity struct {
+	ID                 int64     `json:"id"`
+	StartTime          time.Time `json:"start_time"`
+	EndTime            time.Time `json:"end_time"`
+	DurationSeconds    float64   `json:"duration_seconds"`
+	DominantApp        string    `json:"app"`
+	Apps               []string  `json:"apps"`
+	Titles             []string  `json:"titles"`
+	Keywords           []string  `json:"keywords"`
+	ScreenshotCount    int       `json:"screenshots"`
+	TypingSessionCount int       `json:"typing_sessions"`
+	FocusEventCount    int       `json:"focus_events"`
+	Keystrokes         int       `json:"keystrokes"`
+}
+
+const activitiesSchema = `
+	CREATE TABLE IF NOT EXISTS activities (
+		id INTEGER PRIMARY KEY,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		duration_seconds REAL NOT NULL,
+		dominant_app TEXT,
+		apps TEXT,
+		titles TEXT,
+		keywords TEXT,
+		screenshot_count INTEGER NOT NULL DEFAULT 0,
+		typing_session_count INTEGER NOT NULL DEFAULT 0,
+		focus_event_count INTEGER NOT NULL DEFAULT 0,
+		keystrokes INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_activities_start ON activities(start_time);
+`
+
+// ReplaceActivities stores the activities computed for [from, to], replacing
+// the stored activities that overlap the range.
+func (db *DB) ReplaceActivities(from, to time.Time, activities []Activity) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM activities WHERE end_time > ? AND start_time < ?", from, to); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO activities (start_time, end_time, duration_seconds, dominant_app, apps, titles, keywords,
+			screenshot_count, typing_session_count, focus_event_count, keystrokes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, a := range activities {
+		_, err := stmt.Exec(a.StartTime, a.EndTime, a.DurationSeconds, a.DominantApp,
+			strings.Join(a.Apps, "\n"), strings.Join(a.Titles, "\n"), db.sealText(strings.Join(a.Keywords, "\n")),
+			a.ScreenshotCount, a.TypingSessionCount, a.FocusEventCount, a.Keystrokes)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivities lists stored activities overlapping [from, to], oldest first.
+func (db *DB) GetActivities(from, to time.Time) ([]Activity, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, start_time, end_time, duration_seconds, COALESCE(dominant_app, ''), COALESCE(apps, ''),
+			COALESCE(titles, ''), COALESCE(keywords, ''), screenshot_count, typing_session_count, focus_event_count, keystrokes
+		FROM activities
+		WHERE end_time > ? AND start_time < ?
+		ORDER BY start_time ASC
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Activity
+	for rows.Next() {
+		var a Activity
+		var apps, titles, keywords string
+		err := rows.Scan(&a.ID, &a.StartTime, &a.EndTime, &a.DurationSeconds, &a.DominantApp, &apps,
+			&titles, &keywords, &a.ScreenshotCount, &a.TypingSessionCount, &a.FocusEventCount, &a.Keystrokes)
+		if err != nil {
+			return nil, err
+		}
+		// Keywords come from typed and OCR text, so they are encrypted with it
+		if keywords, err = db.cipher.OpenText(keywords); err != nil {
+			return nil, err
+		}
+		a.Apps = splitLines(apps)
+		a.Titles = splitLines(titles)
+		a.Keywords = splitLines(keywords)
+		results = append(results, a)
+	}
+	return results, rows.Err()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The archive can be encrypted at rest. Typed text, OCR text, the activity
+// keywords and entities extracted from them, and images are encrypted with
+// AES-256-GCM under one archive key; timestamps, app names and window titles
+// stay in the clear so the archive can still be browsed by time and context
+// without decrypting everything.
+//
+// Encrypted text is stored as encryptedTextPrefix followed by the base64
+// nonce and ciphertext. An encrypted image is encryptedImageMagic, the nonce
+// and the ciphertext. Anything without the prefix or magic is plaintext, so
+// an archive can be encrypted while it is in use.
+const (
+	encryptedTextPrefix = "enc1:"
+	encryptedImageMagic = "MEMENC01"
+)
+
+// EncryptionFile is the name, relative to the storage directory, of the file
+// describing how the archive key is kept.
+const EncryptionFile = "encryption.json"
+
+// pbkdf2Iterations is the PBKDF2-HMAC-SHA256 work factor for passphrases.
+const pbkdf2Iterations = 600000
+
+// ErrLocked is returned when encrypted data is read without the archive key.
+var ErrLocked = errors.New("the archive is encrypted and locked")
+
+// ErrWrongArchiveKey is returned for a passphrase or key that doesn't open
+// the archive.
+var ErrWrongArchiveKey = errors.New("wrong passphrase or archive key")
+
+// Cipher encrypts and decrypts archive contents with the archive key.
+type Cipher struct {
+	text  cipher.AEAD
+	image cipher.AEAD
+}
+
+// NewCipher returns a Cipher for a 32-byte archive key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("archive key must be 32 bytes, not %d", len(key))
+	}
+	text, err := deriveGCM(key, "memento archive text")
+	if err != nil {
+		return nil, err
+	}
+	image, err := deriveGCM(key, "memento archive images")
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{text: text, image: image}, nil
+}
+
+func deriveGCM(key []byte, info string) (cipher.AEAD, error) {
+	sub, err := hkdf.Key(sha256.New, key, nil, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(sub)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewArchiveKey returns a random archive key.
+func NewArchiveKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func sealBox(aead cipher.AEAD, plaintext, prefix []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand doesn't fail on supported platforms
+	}
+	out := append(append([]byte{}, prefix...), nonce...)
+	return aead.Seal(out, nonce, plaintext, prefix)
+}
+
+func openBox(aead cipher.AEAD, sealed, prefix []byte) ([]byte, error) {
+	if len(sealed) < len(prefix)+aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	nonce := sealed[len(prefix) : len(prefix)+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, sealed[len(prefix)+aead.NonceSize():], prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// SealText encrypts s. Empty strings are kept as they are.
+func (c *Cipher) SealText(s string) string {
+	if s == "" || strings.HasPrefix(s, encryptedTextPrefix) {
+		return s
+	}
+	sealed := sealBox(c.text, []byte(s), nil)
+	return encryptedTextPrefix + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// OpenText decrypts text sealed by SealText and returns plaintext unchanged.
+func (c *Cipher) OpenText(s string) (string, error) {
+	encoded, ok := strings.CutPrefix(s, encryptedTextPrefix)
+	if !ok {
+		return s, nil
+	}
+	if c == nil {
+		return "", ErrLocked
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted text: %w", err)
+	}
+	plaintext, err := openBox(c.text, sealed, nil)
+	return string(plaintext), err
+}
+
+// SealImage encrypts an image. Images that are already encrypted are
+// returned as they are.
+func (c *Cipher) SealImage(data []byte) []byte {
+	if IsEncryptedImage(data) {
+		return data
+	}
+	return sealBox(c.image, data, []byte(encryptedImageMagic))
+}
+
+// OpenImage decrypts an image sealed by SealImage and returns plaintext
+// images unchanged.
+func (c *Cipher) OpenImage(data []byte) ([]byte, error) {
+	if !IsEncryptedImage(data) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrLocked
+	}
+	return openBox(c.image, data, []byte(encryptedImageMagic))
+}
+
+// IsEncryptedImage reports whether data starts like an encrypted image.
+func IsEncryptedImage(data []byte) bool {
+	return len(data) >= len(encryptedImageMagic) && string(data[:len(encryptedImageMagic)]) == encryptedImageMagic
+}
+
+// Encryption describes how the archive key of an encrypted archive is kept.
+// The key is always sealed with a passphrase, which is enough to unlock the
+// archive anywhere, e.g. after restoring a backup. Keychain and KeyFile are
+// additional places the key is kept so the daemon can unlock unattended.
+type Encryption struct {
+	Version int `json:"version"`
+	// Check identifies the archive key without revealing it.
+	Check      string          `json:"check"`
+	Passphrase *PassphraseWrap `json:"passphrase"`
+	Keychain   bool            `json:"keychain,omitempty"`
+	KeyFile    string          `json:"key_file,omitempty"`
+}
+
+// PassphraseWrap is the archive key encrypted with a key derived from a
+// passphrase.
+type PassphraseWrap struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Sealed     []byte `json:"sealed"`
+}
+
+// NewEncryption describes a new archive key sealed with passphrase.
+func NewEncryption(key []byte, passphrase string) (*Encryption, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	wrap, err := passphraseGCM(passphrase, salt, pbkdf2Iterations)
+	if err != nil {
+		return nil, err
+	}
+	return &Encryption{
+		Version:    1,
+		Check:      keyCheck(key),
+		Passphrase: &PassphraseWrap{Salt: salt, Iterations: pbkdf2Iterations, Sealed: sealBox(wrap, key, nil)},
+	}, nil
+}
+
+func passphraseGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func keyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("memento archive key check"))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// OpenPassphrase returns the archive key sealed with passphrase.
+func (e *Encryption) OpenPassphrase(passphrase string) ([]byte, error) {
+	if e.Passphrase == nil {
+		return nil, fmt.Errorf("the archive key isn't sealed with a passphrase")
+	}
+	wrap, err := passphraseGCM(passphrase, e.Passphrase.Salt, e.Passphrase.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	key, err := openBox(wrap, e.Passphrase.Sealed, nil)
+	if err != nil {
+		return nil, ErrWrongArchiveKey
+	}
+	return key, e.CheckKey(key)
+}
+
+// CheckKey returns ErrWrongArchiveKey unless key is the archive key.
+func (e *Encryption) CheckKey(key []byte) error {
+	if len(key) != 32 || !hmac.Equal([]byte(keyCheck(key)), []byte(e.Check)) {
+		return ErrWrongArchiveKey
+	}
+	return nil
+}
+
+// LoadEncryption reads the storage directory's encryption file. It returns
+// nil if the archive isn't encrypted.
+func LoadEncryption(storagePath string) (*Encryption, error) {
+	data, err := os.ReadFile(filepath.Join(storagePath, EncryptionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Encryption
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", EncryptionFile, err)
+	}
+	return &e, nil
+}
+
+// Save writes the encryption file to the storage directory.
+func (e *Encryption) Save(storagePath string) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(storagePath, EncryptionFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ReadKeyFile reads an archive key stored as hex in a file.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s doesn't hold an archive key", path)
+	}
+	return key, nil
+}
+
+// WriteKeyFile stores an archive key as hex in a new file only the user can
+// read.
+func WriteKeyFile(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
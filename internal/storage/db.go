@@ -11,21 +11,43 @@ import (
 )
 
 type DB struct {
-	conn *sql.DB
-	path string
+	conn   *sql.DB
+	path   string
+	cipher *Cipher
 }
 
+// Screenshot is one capture. Width, Height and FileSize describe its primary
+// image only; with several displays captured, each display's image and its
+// size are in screenshot_displays (see GetScreenshotDisplays).
 type Screenshot struct {
-	ID                int64     `json:"id"`
-	Timestamp         time.Time `json:"timestamp"`
-	Filepath          string    `json:"filepath"`
-	Width             int       `json:"width,omitempty"`
-	Height            int       `json:"height,omitempty"`
-	FileSize          int64     `json:"file_size,omitempty"`
-	OCRText           string    `json:"ocr_text,omitempty"`
-	OCRProcessedAt    *time.Time `json:"ocr_processed_at,omitempty"`
-	ActiveWindowTitle string    `json:"active_window_title,omitempty"`
-	ActiveApp         string    `json:"active_app,omitempty"`
+	ID                   int64      `json:"id"`
+	Timestamp            time.Time  `json:"timestamp"`
+	Filepath             string     `json:"filepath"`
+	Width                int        `json:"width,omitempty"`
+	Height               int        `json:"height,omitempty"`
+	FileSize             int64      `json:"file_size,omitempty"`
+	OCRText              string     `json:"ocr_text,omitempty"`
+	OCRProcessedAt       *time.Time `json:"ocr_processed_at,omitempty"`
+	ActiveWindowTitle    string     `json:"active_window_title,omitempty"`
+	ActiveApp            string     `json:"active_app,omitempty"`
+	OCRLanguage          string     `json:"ocr_language,omitempty"`
+	OCRNewText           string     `json:"ocr_new_text,omitempty"`
+	PreviousScreenshotID int64      `json:"previous_screenshot_id,omitempty"`
+	CaptureReason        string     `json:"capture_reason,omitempty"`
+	WindowID             uint32     `json:"window_id,omitempty"`
+	WindowX              int        `json:"window_x,omitempty"`
+	WindowY              int        `json:"window_y,omitempty"`
+	WindowWidth          int        `json:"window_width,omitempty"`
+	WindowHeight         int        `json:"window_height,omitempty"`
+	ThumbnailPath        string     `json:"thumbnail_path,omitempty"`
+	// Segment, SegmentOffset and SegmentLength locate the image once its
+	// month is compacted; Filepath is where it was
+	Segment       string `json:"segment,omitempty"`
+	SegmentOffset int64  `json:"segment_offset,omitempty"`
+	SegmentLength int64  `json:"segment_length,omitempty"`
+	// PrunedAt is when the image was deleted to stay within the storage
+	// limit; the row and its text are kept
+	PrunedAt *time.Time `json:"pruned_at,omitempty"`
 }
 
 type TypingSession struct {
@@ -45,7 +67,7 @@ func NewDB(storagePath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 	
-	conn, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL")
+	conn, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_foreign_keys=1")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -90,79 +112,315 @@ func (db *DB) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_screenshots_ocr ON screenshots(ocr_text);
 	`
 	
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema
+	if err := db.addColumn("screenshots", "ocr_language", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_screenshots_ocr_language ON screenshots(ocr_language)"); err != nil {
+		return err
+	}
+	if err := db.addColumn("screenshots", "ocr_new_text", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.addColumn("screenshots", "previous_screenshot_id", "INTEGER"); err != nil {
+		return err
+	}
+	if err := db.addColumn("screenshots", "capture_reason", "TEXT"); err != nil {
+		return err
+	}
+	for _, column := range []string{"window_id", "window_x", "window_y", "window_width", "window_height"} {
+		if err := db.addColumn("screenshots", column, "INTEGER"); err != nil {
+			return err
+		}
+	}
+	if err := db.addColumn("screenshots", "thumbnail_path", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_screenshots_context ON screenshots(active_app, active_window_title, timestamp)"); err != nil {
+		return err
+	}
+
+	if _, err := db.conn.Exec(entitiesSchema); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(displaysSchema); err != nil {
+		return err
+	}
+	for _, table := range []string{"screenshots", "screenshot_displays"} {
+		if err := db.addColumn(table, "segment", "TEXT"); err != nil {
+			return err
+		}
+		if err := db.addColumn(table, "segment_offset", "INTEGER"); err != nil {
+			return err
+		}
+		if err := db.addColumn(table, "segment_length", "INTEGER"); err != nil {
+			return err
+		}
+		if err := db.addColumn(table, "pruned_at", "DATETIME"); err != nil {
+			return err
+		}
+		if _, err := db.conn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_filepath ON %s(filepath)", table, table)); err != nil {
+			return err
+		}
+		if _, err := db.conn.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_segment ON %s(segment)", table, table)); err != nil {
+			return err
+		}
+	}
+	if _, err := db.conn.Exec(focusSchema); err != nil {
+		return err
+	}
+	_, err := db.conn.Exec(activitiesSchema)
 	return err
 }
 
+// addColumn adds a column to an existing table unless it is already present.
+func (db *DB) addColumn(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// SetCipher unlocks an encrypted archive: text is encrypted when written
+// and decrypted when read with c.
+func (db *DB) SetCipher(c *Cipher) {
+	db.cipher = c
+}
+
+// sealText encrypts s when the archive is encrypted.
+func (db *DB) sealText(s string) string {
+	if db.cipher == nil {
+		return s
+	}
+	return db.cipher.SealText(s)
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Snapshot writes a consistent copy of the database to path with VACUUM
+// INTO, which is safe while the daemon keeps writing, and checks the copy
+// with PRAGMA integrity_check. The copy has no -wal file to go with it.
+func (db *DB) Snapshot(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := db.conn.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	conn, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to check snapshot: %w", err)
+	}
+	if result != "ok" {
+		os.Remove(path)
+		return fmt.Errorf("database snapshot failed integrity check: %s", result)
+	}
+	return nil
+}
+
 func (db *DB) InsertScreenshot(s *Screenshot) (int64, error) {
 	result, err := db.conn.Exec(`
-		INSERT INTO screenshots (timestamp, filepath, width, height, file_size, active_window_title, active_app)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, s.Timestamp, s.Filepath, s.Width, s.Height, s.FileSize, s.ActiveWindowTitle, s.ActiveApp)
+		INSERT INTO screenshots (timestamp, filepath, width, height, file_size, active_window_title, active_app, capture_reason,
+			window_id, window_x, window_y, window_width, window_height, thumbnail_path)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.Timestamp, s.Filepath, s.Width, s.Height, s.FileSize, s.ActiveWindowTitle, s.ActiveApp, s.CaptureReason,
+		s.WindowID, s.WindowX, s.WindowY, s.WindowWidth, s.WindowHeight, s.ThumbnailPath)
 	if err != nil {
 		return 0, err
 	}
 	return result.LastInsertId()
 }
 
-func (db *DB) UpdateScreenshotOCR(id int64, ocrText string) error {
+func (db *DB) UpdateScreenshotOCR(id int64, ocrText, language string) error {
 	_, err := db.conn.Exec(`
-		UPDATE screenshots SET ocr_text = ?, ocr_processed_at = ? WHERE id = ?
-	`, ocrText, time.Now(), id)
+		UPDATE screenshots SET ocr_text = ?, ocr_processed_at = ?, ocr_language = ? WHERE id = ?
+	`, db.sealText(ocrText), time.Now(), language, id)
+	return err
+}
+
+// UpdateScreenshotThumbnail records where a screenshot's thumbnail is.
+func (db *DB) UpdateScreenshotThumbnail(id int64, path string) error {
+	_, err := db.conn.Exec(`UPDATE screenshots SET thumbnail_path = ? WHERE id = ?`, path, id)
 	return err
 }
 
+// UpdateScreenshotDiff records the OCR text that newly appeared compared to
+// the previous capture of the same window (previousID 0 if there was none).
+func (db *DB) UpdateScreenshotDiff(id, previousID int64, newText string) error {
+	var prev interface{}
+	if previousID != 0 {
+		prev = previousID
+	}
+	_, err := db.conn.Exec(`
+		UPDATE screenshots SET ocr_new_text = ?, previous_screenshot_id = ? WHERE id = ?
+	`, db.sealText(newText), prev, id)
+	return err
+}
+
+// GetPreviousScreenshot returns the most recent OCR-processed capture of the
+// same app and window taken before s, or nil if there is none.
+func (db *DB) GetPreviousScreenshot(s *Screenshot) (*Screenshot, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+screenshotColumns+`
+		FROM screenshots
+		WHERE active_app = ? AND active_window_title = ? AND timestamp < ? AND id != ?
+		AND ocr_processed_at IS NOT NULL
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, s.ActiveApp, s.ActiveWindowTitle, s.Timestamp, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := db.scanScreenshots(rows)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
 func (db *DB) InsertTypingSession(s *TypingSession) (int64, error) {
 	result, err := db.conn.Exec(`
 		INSERT INTO typing_sessions (start_time, end_time, text, key_count, active_window_title, active_app)
 		VALUES (?, ?, ?, ?, ?, ?)
-	`, s.StartTime, s.EndTime, s.Text, s.KeyCount, s.ActiveWindowTitle, s.ActiveApp)
+	`, s.StartTime, s.EndTime, db.sealText(s.Text), s.KeyCount, s.ActiveWindowTitle, s.ActiveApp)
 	if err != nil {
 		return 0, err
 	}
 	return result.LastInsertId()
 }
 
-func (db *DB) SearchScreenshots(query string, from, to time.Time, limit int) ([]Screenshot, error) {
+// ScreenshotFilter narrows SearchScreenshots beyond the text query and time
+// range. Zero values match everything.
+type ScreenshotFilter struct {
+	// Language matches the detected OCR language, either as a full tag
+	// ("de-DE") or a bare language code ("de").
+	Language string
+	// EntityType restricts results to screenshots containing an extracted
+	// entity of this type whose value matches the query. The query then
+	// needn't match the screenshot's text, unless NewTextOnly is set too.
+	EntityType string
+	// NewTextOnly matches the query only against text that newly appeared
+	// since the previous capture of the same window, so each hit is
+	// attributed to when the text first showed up.
+	NewTextOnly bool
+}
+
+func (db *DB) SearchScreenshots(query string, from, to time.Time, filter ScreenshotFilter, limit int) ([]Screenshot, error) {
 	if limit <= 0 {
 		limit = 100
 	}
 	
+	where := "(ocr_text LIKE ? OR active_window_title LIKE ? OR active_app LIKE ?) AND timestamp BETWEEN ? AND ?"
+	args := []interface{}{"%" + query + "%", "%" + query + "%", "%" + query + "%", from, to}
+	if filter.NewTextOnly {
+		where = "ocr_new_text LIKE ? AND timestamp BETWEEN ? AND ?"
+		args = []interface{}{"%" + query + "%", from, to}
+	} else if filter.EntityType != "" {
+		// The entity's value is matched instead of the screenshot's text
+		where = "timestamp BETWEEN ? AND ?"
+		args = []interface{}{from, to}
+	}
+	if filter.EntityType != "" {
+		where += " AND id IN (SELECT screenshot_id FROM entities WHERE type = ? AND value LIKE ?)"
+		args = append(args, filter.EntityType, "%"+query+"%")
+	}
+	if filter.Language != "" {
+		// Match both exact tags and bare language codes ("de" matches "de-DE")
+		where += " AND (ocr_language = ? OR ocr_language LIKE ?)"
+		args = append(args, filter.Language, filter.Language+"-%")
+	}
+	if db.cipher != nil {
+		return db.searchEncryptedScreenshots(query, from, to, filter, limit)
+	}
+	args = append(args, limit)
+
 	rows, err := db.conn.Query(`
-		SELECT id, timestamp, filepath, width, height, file_size, ocr_text, ocr_processed_at, active_window_title, active_app
+		SELECT `+screenshotColumns+`
 		FROM screenshots
-		WHERE (ocr_text LIKE ? OR active_window_title LIKE ? OR active_app LIKE ?)
-		AND timestamp BETWEEN ? AND ?
+		WHERE `+where+`
 		ORDER BY timestamp DESC
 		LIMIT ?
-	`, "%"+query+"%", "%"+query+"%", "%"+query+"%", from, to, limit)
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	
-	var results []Screenshot
+	return db.scanScreenshots(rows)
+}
+
+// GetScreenshot returns the screenshot with the given ID, or nil if there is
+// none.
+func (db *DB) GetScreenshot(id int64) (*Screenshot, error) {
+	rows, err := db.conn.Query(`SELECT `+screenshotColumns+` FROM screenshots WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := db.scanScreenshots(rows)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// GetDayCounts counts screenshots and typing sessions per local day
+// (YYYY-MM-DD) in a time range.
+func (db *DB) GetDayCounts(from, to time.Time) (map[string]int, error) {
+	rows, err := db.conn.Query(`
+		SELECT timestamp FROM screenshots WHERE timestamp BETWEEN ? AND ?
+		UNION ALL
+		SELECT start_time FROM typing_sessions WHERE start_time BETWEEN ? AND ?
+	`, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
 	for rows.Next() {
-		var s Screenshot
-		var ocrText sql.NullString
-		var ocrProcessedAt sql.NullTime
-		err := rows.Scan(&s.ID, &s.Timestamp, &s.Filepath, &s.Width, &s.Height, &s.FileSize, &ocrText, &ocrProcessedAt, &s.ActiveWindowTitle, &s.ActiveApp)
-		if err != nil {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
 			return nil, err
 		}
-		if ocrText.Valid {
-			s.OCRText = ocrText.String
-		}
-		if ocrProcessedAt.Valid {
-			s.OCRProcessedAt = &ocrProcessedAt.Time
-		}
-		results = append(results, s)
+		counts[t.Local().Format("2006-01-02")]++
 	}
-	return results, nil
+	return counts, rows.Err()
 }
 
 func (db *DB) GetScreenshotsByDateRange(from, to time.Time, limit int) ([]Screenshot, error) {
@@ -171,7 +429,7 @@ func (db *DB) GetScreenshotsByDateRange(from, to time.Time, limit int) ([]Screen
 	}
 	
 	rows, err := db.conn.Query(`
-		SELECT id, timestamp, filepath, width, height, file_size, ocr_text, ocr_processed_at, active_window_title, active_app
+		SELECT `+screenshotColumns+`
 		FROM screenshots
 		WHERE timestamp BETWEEN ? AND ?
 		ORDER BY timestamp DESC
@@ -182,12 +440,20 @@ func (db *DB) GetScreenshotsByDateRange(from, to time.Time, limit int) ([]Screen
 	}
 	defer rows.Close()
 	
+	return db.scanScreenshots(rows)
+}
+
+const screenshotColumns = "id, timestamp, filepath, width, height, file_size, ocr_text, ocr_processed_at, active_window_title, active_app, ocr_language, ocr_new_text, previous_screenshot_id, capture_reason, COALESCE(window_id, 0), COALESCE(window_x, 0), COALESCE(window_y, 0), COALESCE(window_width, 0), COALESCE(window_height, 0), COALESCE(thumbnail_path, ''), COALESCE(segment, ''), COALESCE(segment_offset, 0), COALESCE(segment_length, 0), pruned_at"
+
+func (db *DB) scanScreenshots(rows *sql.Rows) ([]Screenshot, error) {
 	var results []Screenshot
 	for rows.Next() {
 		var s Screenshot
-		var ocrText sql.NullString
-		var ocrProcessedAt sql.NullTime
-		err := rows.Scan(&s.ID, &s.Timestamp, &s.Filepath, &s.Width, &s.Height, &s.FileSize, &ocrText, &ocrProcessedAt, &s.ActiveWindowTitle, &s.ActiveApp)
+		var ocrText, ocrLanguage, ocrNewText, captureReason sql.NullString
+		var ocrProcessedAt, prunedAt sql.NullTime
+		var previousID sql.NullInt64
+		err := rows.Scan(&s.ID, &s.Timestamp, &s.Filepath, &s.Width, &s.Height, &s.FileSize, &ocrText, &ocrProcessedAt, &s.ActiveWindowTitle, &s.ActiveApp, &ocrLanguage, &ocrNewText, &previousID, &captureReason,
+			&s.WindowID, &s.WindowX, &s.WindowY, &s.WindowWidth, &s.WindowHeight, &s.ThumbnailPath, &s.Segment, &s.SegmentOffset, &s.SegmentLength, &prunedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -197,9 +463,40 @@ func (db *DB) GetScreenshotsByDateRange(from, to time.Time, limit int) ([]Screen
 		if ocrProcessedAt.Valid {
 			s.OCRProcessedAt = &ocrProcessedAt.Time
 		}
+		if prunedAt.Valid {
+			s.PrunedAt = &prunedAt.Time
+		}
+		if ocrLanguage.Valid {
+			s.OCRLanguage = ocrLanguage.String
+		}
+		s.OCRNewText = ocrNewText.String
+		s.PreviousScreenshotID = previousID.Int64
+		s.CaptureReason = captureReason.String
+		if s.OCRText, err = db.cipher.OpenText(s.OCRText); err != nil {
+			return nil, err
+		}
+		if s.OCRNewText, err = db.cipher.OpenText(s.OCRNewText); err != nil {
+			return nil, err
+		}
 		results = append(results, s)
 	}
-	return results, nil
+	return results, rows.Err()
+}
+
+func (db *DB) scanTypingSessions(rows *sql.Rows) ([]TypingSession, error) {
+	var results []TypingSession
+	for rows.Next() {
+		var s TypingSession
+		err := rows.Scan(&s.ID, &s.StartTime, &s.EndTime, &s.Text, &s.KeyCount, &s.ActiveWindowTitle, &s.ActiveApp)
+		if err != nil {
+			return nil, err
+		}
+		if s.Text, err = db.cipher.OpenText(s.Text); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
 }
 
 func (db *DB) GetUnprocessedScreenshots(limit int) ([]Screenshot, error) {
@@ -208,7 +505,8 @@ func (db *DB) GetUnprocessedScreenshots(limit int) ([]Screenshot, error) {
 	}
 	
 	rows, err := db.conn.Query(`
-		SELECT id, timestamp, filepath, width, height, file_size, active_window_title, active_app
+		SELECT id, timestamp, filepath, width, height, file_size, active_window_title, active_app,
+			COALESCE(segment, ''), COALESCE(segment_offset, 0), COALESCE(segment_length, 0)
 		FROM screenshots
 		WHERE ocr_processed_at IS NULL
 		ORDER BY timestamp ASC
@@ -222,7 +520,8 @@ func (db *DB) GetUnprocessedScreenshots(limit int) ([]Screenshot, error) {
 	var results []Screenshot
 	for rows.Next() {
 		var s Screenshot
-		err := rows.Scan(&s.ID, &s.Timestamp, &s.Filepath, &s.Width, &s.Height, &s.FileSize, &s.ActiveWindowTitle, &s.ActiveApp)
+		err := rows.Scan(&s.ID, &s.Timestamp, &s.Filepath, &s.Width, &s.Height, &s.FileSize, &s.ActiveWindowTitle, &s.ActiveApp,
+			&s.Segment, &s.SegmentOffset, &s.SegmentLength)
 		if err != nil {
 			return nil, err
 		}
@@ -231,6 +530,72 @@ func (db *DB) GetUnprocessedScreenshots(limit int) ([]Screenshot, error) {
 	return results, nil
 }
 
+// GetScreenshotsAfter pages through all screenshots in id order, starting
+// after afterID.
+func (db *DB) GetScreenshotsAfter(afterID int64, limit int) ([]Screenshot, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+screenshotColumns+`
+		FROM screenshots
+		WHERE id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanScreenshots(rows)
+}
+
+// GetOCRProcessedScreenshots pages through screenshots with OCR text in id
+// order, starting after afterID.
+func (db *DB) GetOCRProcessedScreenshots(afterID int64, limit int) ([]Screenshot, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+screenshotColumns+`
+		FROM screenshots
+		WHERE id > ? AND ocr_processed_at IS NOT NULL
+		ORDER BY id ASC
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanScreenshots(rows)
+}
+
+// GetTypingSessionsAfter pages through all typing sessions in id order,
+// starting after afterID.
+func (db *DB) GetTypingSessionsAfter(afterID int64, limit int) ([]TypingSession, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT id, start_time, end_time, text, key_count, active_window_title, active_app
+		FROM typing_sessions
+		WHERE id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanTypingSessions(rows)
+}
+
 func (db *DB) GetTypingSessionsByDateRange(from, to time.Time, app string, limit int) ([]TypingSession, error) {
 	if limit <= 0 {
 		limit = 1000
@@ -261,22 +626,16 @@ func (db *DB) GetTypingSessionsByDateRange(from, to time.Time, app string, limit
 	}
 	defer rows.Close()
 	
-	var results []TypingSession
-	for rows.Next() {
-		var s TypingSession
-		err := rows.Scan(&s.ID, &s.StartTime, &s.EndTime, &s.Text, &s.KeyCount, &s.ActiveWindowTitle, &s.ActiveApp)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, s)
-	}
-	return results, nil
+	return db.scanTypingSessions(rows)
 }
 
 func (db *DB) SearchTypingSessions(query string, from, to time.Time, limit int) ([]TypingSession, error) {
 	if limit <= 0 {
 		limit = 100
 	}
+	if db.cipher != nil {
+		return db.searchEncryptedTypingSessions(query, from, to, limit)
+	}
 	
 	rows, err := db.conn.Query(`
 		SELECT id, start_time, end_time, text, key_count, active_window_title, active_app
@@ -290,16 +649,7 @@ func (db *DB) SearchTypingSessions(query string, from, to time.Time, limit int)
 	}
 	defer rows.Close()
 	
-	var results []TypingSession
-	for rows.Next() {
-		var s TypingSession
-		err := rows.Scan(&s.ID, &s.StartTime, &s.EndTime, &s.Text, &s.KeyCount, &s.ActiveWindowTitle, &s.ActiveApp)
-		if err != nil {
-			return nil, err
-		}
-		results = append(results, s)
-	}
-	return results, nil
+	return db.scanTypingSessions(rows)
 }
 
 func (db *DB) GetStats() (map[string]interface{}, error) {
@@ -321,6 +671,24 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 	db.conn.QueryRow("SELECT COUNT(*) FROM screenshots WHERE ocr_processed_at IS NOT NULL").Scan(&ocrProcessed)
 	stats["ocr_processed"] = ocrProcessed
 	
+	reasons := make(map[string]int64)
+	rows, err := db.conn.Query("SELECT COALESCE(capture_reason, 'interval'), COUNT(*) FROM screenshots GROUP BY 1")
+	if err == nil {
+		for rows.Next() {
+			var reason string
+			var count int64
+			if rows.Scan(&reason, &count) == nil {
+				reasons[reason] = count
+			}
+		}
+		rows.Close()
+	}
+	stats["capture_reasons"] = reasons
+	
+	var focusCount int64
+	db.conn.QueryRow("SELECT COUNT(*) FROM focus_events").Scan(&focusCount)
+	stats["focus_event_count"] = focusCount
+	
 	var oldestScreenshot sql.NullTime
 	db.conn.QueryRow("SELECT MIN(timestamp) FROM screenshots").Scan(&oldestScreenshot)
 	if oldestScreenshot.Valid {
@@ -0,0 +1,107 @@
+package storage
+
+// ScreenshotDisplay is one display's image within a screenshot. Geometry is in
+// points in global screen coordinates; image size is in pixels. FileSize is
+// this display's image alone; the active display's image is the screenshot's
+// primary image, so its FileSize repeats the screenshot's.
+type ScreenshotDisplay struct {
+	ID           int64  `json:"id"`
+	ScreenshotID int64  `json:"screenshot_id"`
+	DisplayID    uint32 `json:"display_id"`
+	DisplayIndex int    `json:"display_index"`
+	Name         string `json:"name,omitempty"`
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Main         bool   `json:"main"`
+	Active       bool   `json:"active"`
+	Filepath     string `json:"filepath"`
+	ImageWidth   int    `json:"image_width"`
+	ImageHeight  int    `json:"image_height"`
+	FileSize     int64  `json:"file_size"`
+	// Set once the month is compacted, as on Screenshot
+	Segment       string `json:"segment,omitempty"`
+	SegmentOffset int64  `json:"segment_offset,omitempty"`
+	SegmentLength int64  `json:"segment_length,omitempty"`
+}
+
+const displaysSchema = `
+	CREATE TABLE IF NOT EXISTS screenshot_displays (
+		id INTEGER PRIMARY KEY,
+		screenshot_id INTEGER NOT NULL REFERENCES screenshots(id) ON DELETE CASCADE,
+		display_id INTEGER NOT NULL,
+		display_index INTEGER NOT NULL,
+		name TEXT,
+		x INTEGER NOT NULL,
+		y INTEGER NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		is_main INTEGER NOT NULL DEFAULT 0,
+		is_active INTEGER NOT NULL DEFAULT 0,
+		filepath TEXT NOT NULL,
+		image_width INTEGER,
+		image_height INTEGER,
+		file_size INTEGER
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_screenshot_displays_screenshot ON screenshot_displays(screenshot_id);
+`
+
+func (db *DB) InsertScreenshotDisplays(screenshotID int64, displays []ScreenshotDisplay) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO screenshot_displays (screenshot_id, display_id, display_index, name, x, y, width, height,
+			is_main, is_active, filepath, image_width, image_height, file_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range displays {
+		_, err := stmt.Exec(screenshotID, d.DisplayID, d.DisplayIndex, d.Name, d.X, d.Y, d.Width, d.Height,
+			d.Main, d.Active, d.Filepath, d.ImageWidth, d.ImageHeight, d.FileSize)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetScreenshotDisplays returns the per-display images of a screenshot, the
+// display holding the active window first. Screenshots taken before
+// multi-display capture have none.
+func (db *DB) GetScreenshotDisplays(screenshotID int64) ([]ScreenshotDisplay, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, screenshot_id, display_id, display_index, COALESCE(name, ''), x, y, width, height,
+			is_main, is_active, filepath, COALESCE(image_width, 0), COALESCE(image_height, 0), COALESCE(file_size, 0),
+			COALESCE(segment, ''), COALESCE(segment_offset, 0), COALESCE(segment_length, 0)
+		FROM screenshot_displays
+		WHERE screenshot_id = ?
+		ORDER BY is_active DESC, display_index ASC
+	`, screenshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ScreenshotDisplay
+	for rows.Next() {
+		var d ScreenshotDisplay
+		err := rows.Scan(&d.ID, &d.ScreenshotID, &d.DisplayID, &d.DisplayIndex, &d.Name, &d.X, &d.Y, &d.Width, &d.Height,
+			&d.Main, &d.Active, &d.Filepath, &d.ImageWidth, &d.ImageHeight, &d.FileSize,
+			&d.Segment, &d.SegmentOffset, &d.SegmentLength)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, d)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,442 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SetCipher unlocks an encrypted archive: images are encrypted when written
+// and decrypted when read with c.
+func (fm *FileManager) SetCipher(c *Cipher) {
+	fm.cipher = c
+}
+
+// Encrypted reports whether new images are encrypted.
+func (fm *FileManager) Encrypted() bool {
+	return fm.cipher != nil
+}
+
+func (fm *FileManager) sealImage(data []byte) []byte {
+	if fm.cipher == nil {
+		return data
+	}
+	return fm.cipher.SealImage(data)
+}
+
+// WriteImage writes an image to path, encrypted if the archive is, replacing
+// any file there in one step.
+func (fm *FileManager) WriteImage(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, fm.sealImage(data), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type decryptedImage struct {
+	*bytes.Reader
+}
+
+func (decryptedImage) Close() error {
+	return nil
+}
+
+// isEncryptedFile reports whether r, at its start, holds an encrypted image,
+// and leaves it at the start.
+func isEncryptedFile(r io.ReadSeeker) (bool, error) {
+	magic := make([]byte, len(encryptedImageMagic))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return IsEncryptedImage(magic[:n]), nil
+}
+
+// EncryptResult summarizes the encryption of what an archive held in
+// plaintext.
+type EncryptResult struct {
+	Texts    int `json:"texts"`
+	Images   int `json:"images"`
+	Segments int `json:"segments"`
+	Digests  int `json:"digests_removed"`
+}
+
+// EncryptText encrypts the typed and OCR text still stored in plaintext,
+// along with the activity keywords and entities extracted from it, then
+// rewrites the database so no plaintext is left in free pages or the
+// write-ahead log.
+func (db *DB) EncryptText() (int, error) {
+	if db.cipher == nil {
+		return 0, ErrLocked
+	}
+	columns := []struct{ table, column string }{
+		{"screenshots", "ocr_text"},
+		{"screenshots", "ocr_new_text"},
+		{"typing_sessions", "text"},
+		{"activities", "keywords"},
+		{"entities", "value"},
+	}
+	total := 0
+	for _, c := range columns {
+		for {
+			n, err := db.encryptColumn(c.table, c.column, 500)
+			if err != nil {
+				return total, fmt.Errorf("failed to encrypt %s.%s: %w", c.table, c.column, err)
+			}
+			total += n
+			if n == 0 {
+				break
+			}
+		}
+	}
+	if total > 0 {
+		if _, err := db.conn.Exec("VACUUM"); err != nil {
+			return total, fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		// Old pages stay in the -wal file until it is checkpointed
+		if _, err := db.conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return total, fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return total, nil
+}
+
+// encryptColumn encrypts up to limit plaintext values of a column.
+func (db *DB) encryptColumn(table, column string, limit int) (int, error) {
+	rows, err := db.conn.Query(fmt.Sprintf(`
+		SELECT id, %[2]s FROM %[1]s
+		WHERE %[2]s IS NOT NULL AND %[2]s != '' AND substr(%[2]s, 1, %[3]d) != ?
+		LIMIT ?
+	`, table, column, len(encryptedTextPrefix)), encryptedTextPrefix, limit)
+	if err != nil {
+		return 0, err
+	}
+	type value struct {
+		id   int64
+		text string
+	}
+	var values []value
+	for rows.Next() {
+		var v value
+		if err := rows.Scan(&v.id, &v.text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(values) == 0 {
+		return 0, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, column))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, v := range values {
+		if _, err := stmt.Exec(db.cipher.SealText(v.text), v.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(values), tx.Commit()
+}
+
+// EncryptImages encrypts the screenshots, thumbnails and segments still
+// stored in plaintext. Segments are rewritten and their rows moved to the
+// new segment, so an interrupted run leaves every image readable.
+func (fm *FileManager) EncryptImages(db *DB, progress func(path string)) (*EncryptResult, error) {
+	result := &EncryptResult{}
+	if fm.cipher == nil {
+		return result, ErrLocked
+	}
+	unlock, err := fm.LockFiles()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	var segments []string
+	for _, dir := range []string{"screenshots", "thumbnails"} {
+		err := filepath.WalkDir(filepath.Join(fm.basePath, dir), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			switch filepath.Ext(path) {
+			case ".seg":
+				segments = append(segments, path)
+			case ".webp":
+				encrypted, err := fm.encryptFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt %s: %w", path, err)
+				}
+				if encrypted {
+					result.Images++
+					if progress != nil {
+						progress(path)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, path := range segments {
+		n, err := fm.encryptSegment(db, path)
+		if err != nil {
+			return result, fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		if n > 0 {
+			result.Segments++
+			result.Images += n
+			if progress != nil {
+				progress(path)
+			}
+		}
+	}
+	return result, nil
+}
+
+// encryptFile encrypts a loose image in place, keeping its modification
+// time, unless it is encrypted already.
+func (fm *FileManager) encryptFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || IsEncryptedImage(data) {
+		return false, err
+	}
+	if err := fm.WriteImage(path, data); err != nil {
+		return false, err
+	}
+	return true, os.Chtimes(path, time.Now(), info.ModTime())
+}
+
+// encryptSegment writes the images of a segment, encrypted, to a new
+// segment in the same directory and points the rows at it. It returns how
+// many images were encrypted.
+func (fm *FileManager) encryptSegment(db *DB, path string) (int, error) {
+	// Segments no row points at are removed by cleanSegments instead
+	if used, err := db.segmentInUse(path); err != nil || !used {
+		return 0, err
+	}
+	entries, err := ReadSegmentIndex(path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	plaintext := 0
+	for _, e := range entries {
+		encrypted, err := isEncryptedFile(io.NewSectionReader(f, e.Offset, e.Length))
+		if err != nil {
+			return 0, err
+		}
+		if !encrypted {
+			plaintext++
+		}
+	}
+	if plaintext == 0 {
+		return 0, nil
+	}
+
+	dir := filepath.Dir(path)
+	next, err := fm.cleanSegments(db, dir)
+	if err != nil {
+		return 0, err
+	}
+	w, err := createSegment(filepath.Join(dir, fmt.Sprintf("segment-%03d.seg", next)))
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		image := make([]byte, e.Length)
+		if _, err := f.ReadAt(image, e.Offset); err != nil {
+			w.abort()
+			return 0, err
+		}
+		if err := w.write(e.Name, fm.cipher.SealImage(image)); err != nil {
+			w.abort()
+			return 0, err
+		}
+	}
+	if err := w.finish(); err != nil {
+		w.abort()
+		return 0, err
+	}
+	if err := db.moveSegment(path, w.path, entries, w.entries); err != nil {
+		return 0, fmt.Errorf("failed to record %s: %w", w.path, err)
+	}
+	return plaintext, os.Remove(path)
+}
+
+// moveSegment points the rows at each entry of segment from to the same
+// entry in segment to.
+func (db *DB) moveSegment(from, to string, old, moved []SegmentEntry) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := moveSegmentEntries(tx, from, to, old, moved); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func moveSegmentEntries(tx *sql.Tx, from, to string, old, moved []SegmentEntry) error {
+	for _, table := range []string{"screenshots", "screenshot_displays"} {
+		stmt, err := tx.Prepare(`UPDATE ` + table + ` SET segment = ?, segment_offset = ?, segment_length = ? WHERE segment = ? AND segment_offset = ?`)
+		if err != nil {
+			return err
+		}
+		for i, e := range old {
+			if _, err := stmt.Exec(to, moved[i].Offset, moved[i].Length, from, e.Offset); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		stmt.Close()
+	}
+	return nil
+}
+
+// searchBatch is how many rows encrypted searches decrypt at a time.
+const searchBatch = 500
+
+// searchEncryptedScreenshots is SearchScreenshots for an encrypted archive:
+// the text can't be matched in SQL, so the screenshots in the range are
+// decrypted and matched newest first until limit are found.
+func (db *DB) searchEncryptedScreenshots(query string, from, to time.Time, filter ScreenshotFilter, limit int) ([]Screenshot, error) {
+	where := "timestamp BETWEEN ? AND ?"
+	args := []interface{}{from, to}
+	if filter.Language != "" {
+		where += " AND (ocr_language = ? OR ocr_language LIKE ?)"
+		args = append(args, filter.Language, filter.Language+"-%")
+	}
+	if filter.EntityType != "" {
+		where += " AND id IN (SELECT screenshot_id FROM entities WHERE type = ?)"
+		args = append(args, filter.EntityType)
+	}
+
+	var results []Screenshot
+	for offset := 0; ; offset += searchBatch {
+		rows, err := db.conn.Query(`
+			SELECT `+screenshotColumns+`
+			FROM screenshots
+			WHERE `+where+`
+			ORDER BY timestamp DESC
+			LIMIT ? OFFSET ?
+		`, append(args, searchBatch, offset)...)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := db.scanScreenshots(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		var entities map[int64][]string
+		if filter.EntityType != "" {
+			if entities, err = db.screenshotEntityValues(filter.EntityType, batch); err != nil {
+				return nil, err
+			}
+		}
+		for _, s := range batch {
+			matched := containsFold(s.OCRText, query) || containsFold(s.ActiveWindowTitle, query) || containsFold(s.ActiveApp, query)
+			if filter.NewTextOnly {
+				matched = containsFold(s.OCRNewText, query)
+			} else if filter.EntityType != "" {
+				matched = true
+			}
+			if filter.EntityType != "" {
+				found := false
+				for _, value := range entities[s.ID] {
+					found = found || containsFold(value, query)
+				}
+				matched = matched && found
+			}
+			if matched {
+				results = append(results, s)
+				if len(results) == limit {
+					return results, nil
+				}
+			}
+		}
+		if len(batch) < searchBatch {
+			return results, nil
+		}
+	}
+}
+
+// searchEncryptedTypingSessions is SearchTypingSessions for an encrypted
+// archive.
+func (db *DB) searchEncryptedTypingSessions(query string, from, to time.Time, limit int) ([]TypingSession, error) {
+	var results []TypingSession
+	for offset := 0; ; offset += searchBatch {
+		rows, err := db.conn.Query(`
+			SELECT id, start_time, end_time, text, key_count, active_window_title, active_app
+			FROM typing_sessions
+			WHERE start_time BETWEEN ? AND ?
+			ORDER BY start_time DESC
+			LIMIT ? OFFSET ?
+		`, from, to, searchBatch, offset)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := db.scanTypingSessions(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range batch {
+			if containsFold(s.Text, query) {
+				results = append(results, s)
+				if len(results) == limit {
+					return results, nil
+				}
+			}
+		}
+		if len(batch) < searchBatch {
+			return results, nil
+		}
+	}
+}
+
+// containsFold reports whether s contains substr, ignoring case like
+// SQLite's LIKE.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
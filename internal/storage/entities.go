@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Entity struct {
+	ID                int64     `json:"id"`
+	Type              string    `json:"type"`
+	Value             string    `json:"value"`
+	Timestamp         time.Time `json:"timestamp"`
+	ScreenshotID      int64     `json:"screenshot_id,omitempty"`
+	TypingSessionID   int64     `json:"typing_session_id,omitempty"`
+	ActiveWindowTitle string    `json:"window,omitempty"`
+	ActiveApp         string    `json:"app,omitempty"`
+}
+
+const entitiesSchema = `
+	CREATE TABLE IF NOT EXISTS entities (
+		id INTEGER PRIMARY KEY,
+		type TEXT NOT NULL,
+		value TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		screenshot_id INTEGER REFERENCES screenshots(id) ON DELETE CASCADE,
+		typing_session_id INTEGER REFERENCES typing_sessions(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_entities_type_timestamp ON entities(type, timestamp);
+	CREATE INDEX IF NOT EXISTS idx_entities_value ON entities(value);
+	CREATE INDEX IF NOT EXISTS idx_entities_screenshot ON entities(screenshot_id);
+	CREATE INDEX IF NOT EXISTS idx_entities_typing_session ON entities(typing_session_id);
+`
+
+// ReplaceScreenshotEntities stores the entities found in a screenshot's OCR
+// text, replacing any from an earlier extraction.
+func (db *DB) ReplaceScreenshotEntities(screenshotID int64, timestamp time.Time, entities []Entity) error {
+	return db.replaceEntities("screenshot_id", screenshotID, timestamp, entities)
+}
+
+// ReplaceTypingSessionEntities stores the entities found in a typing
+// session's text, replacing any from an earlier extraction.
+func (db *DB) ReplaceTypingSessionEntities(sessionID int64, timestamp time.Time, entities []Entity) error {
+	return db.replaceEntities("typing_session_id", sessionID, timestamp, entities)
+}
+
+func (db *DB) replaceEntities(column string, sourceID int64, timestamp time.Time, entities []Entity) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM entities WHERE "+column+" = ?", sourceID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO entities (type, value, timestamp, " + column + ") VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entities {
+		if _, err := stmt.Exec(e.Type, db.sealText(e.Value), timestamp, sourceID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetEntities lists extracted entities in a time range, newest first. Empty
+// entityType, value or app match everything; value and app match substrings.
+func (db *DB) GetEntities(entityType, value string, from, to time.Time, app string, limit int) ([]Entity, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	// Encrypted values can't be matched in SQL; they are decrypted and
+	// matched a batch at a time instead
+	matchValue := db.cipher != nil && value != ""
+
+	where := "e.timestamp BETWEEN ? AND ?"
+	args := []interface{}{from, to}
+	if entityType != "" {
+		where += " AND e.type = ?"
+		args = append(args, entityType)
+	}
+	if value != "" && !matchValue {
+		where += " AND e.value LIKE ?"
+		args = append(args, "%"+value+"%")
+	}
+	if app != "" {
+		where += " AND COALESCE(s.active_app, t.active_app) LIKE ?"
+		args = append(args, "%"+app+"%")
+	}
+	if !matchValue {
+		return db.queryEntities(where, args, 0, limit)
+	}
+
+	var results []Entity
+	for offset := 0; ; offset += searchBatch {
+		batch, err := db.queryEntities(where, args, offset, searchBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range batch {
+			if containsFold(e.Value, value) {
+				results = append(results, e)
+				if len(results) == limit {
+					return results, nil
+				}
+			}
+		}
+		if len(batch) < searchBatch {
+			return results, nil
+		}
+	}
+}
+
+// queryEntities runs GetEntities' query for one page of results.
+func (db *DB) queryEntities(where string, args []interface{}, offset, limit int) ([]Entity, error) {
+	rows, err := db.conn.Query(`
+		SELECT e.id, e.type, e.value, e.timestamp, e.screenshot_id, e.typing_session_id,
+			COALESCE(s.active_window_title, t.active_window_title), COALESCE(s.active_app, t.active_app)
+		FROM entities e
+		LEFT JOIN screenshots s ON s.id = e.screenshot_id
+		LEFT JOIN typing_sessions t ON t.id = e.typing_session_id
+		WHERE `+where+`
+		ORDER BY e.timestamp DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Entity
+	for rows.Next() {
+		var e Entity
+		var screenshotID, sessionID sql.NullInt64
+		var window, app sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &e.Value, &e.Timestamp, &screenshotID, &sessionID, &window, &app); err != nil {
+			return nil, err
+		}
+		e.ScreenshotID = screenshotID.Int64
+		e.TypingSessionID = sessionID.Int64
+		e.ActiveWindowTitle = window.String
+		e.ActiveApp = app.String
+		if e.Value, err = db.cipher.OpenText(e.Value); err != nil {
+			return nil, err
+		}
+		results = append(results, e)
+	}
+	return results, rows.Err()
+}
+
+// screenshotEntityValues returns the values of the entities of a type found
+// in each of screenshots, by screenshot ID.
+func (db *DB) screenshotEntityValues(entityType string, screenshots []Screenshot) (map[int64][]string, error) {
+	values := make(map[int64][]string)
+	if len(screenshots) == 0 {
+		return values, nil
+	}
+	args := []interface{}{entityType}
+	for _, s := range screenshots {
+		args = append(args, s.ID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(screenshots)), ",")
+	rows, err := db.conn.Query("SELECT screenshot_id, value FROM entities WHERE type = ? AND screenshot_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		if value, err = db.cipher.OpenText(value); err != nil {
+			return nil, err
+		}
+		values[id] = append(values[id], value)
+	}
+	return values, rows.Err()
+}
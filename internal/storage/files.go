@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type FileManager struct {
 	basePath string
+	cipher   *Cipher
 }
 
 func NewFileManager(basePath string) *FileManager {
@@ -27,6 +29,22 @@ func (fm *FileManager) GetScreenshotPath(t time.Time) string {
 	return filepath.Join(dir, filename)
 }
 
+// GetThumbnailPath returns where the thumbnail of the screenshot at
+// screenshotPath lives: the same relative path under thumbnails/ instead of
+// screenshots/. Screenshots outside the tree are filed by their timestamp.
+func (fm *FileManager) GetThumbnailPath(screenshotPath string, t time.Time) string {
+	rel, err := filepath.Rel(filepath.Join(fm.basePath, "screenshots"), screenshotPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Join(
+			fmt.Sprintf("%d", t.Year()),
+			fmt.Sprintf("%02d", t.Month()),
+			fmt.Sprintf("%02d", t.Day()),
+			filepath.Base(screenshotPath),
+		)
+	}
+	return filepath.Join(fm.basePath, "thumbnails", strings.TrimSuffix(rel, filepath.Ext(rel))+".webp")
+}
+
 func (fm *FileManager) EnsureDir(path string) error {
 	dir := filepath.Dir(path)
 	return os.MkdirAll(dir, 0755)
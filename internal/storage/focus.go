@@ -0,0 +1,81 @@
+package storage
+
+import "time"
+
+// FocusEvent is a span of time during which one app window had focus.
+type FocusEvent struct {
+	ID                int64     `json:"id"`
+	StartTime         time.Time `json:"start_time"`
+	EndTime           time.Time `json:"end_time"`
+	DurationSeconds   float64   `json:"duration_seconds"`
+	ActiveApp         string    `json:"app"`
+	ActiveWindowTitle string    `json:"window,omitempty"`
+}
+
+func (e FocusEvent) Duration() time.Duration {
+	return e.EndTime.Sub(e.StartTime)
+}
+
+const focusSchema = `
+	CREATE TABLE IF NOT EXISTS focus_events (
+		id INTEGER PRIMARY KEY,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		duration_seconds REAL NOT NULL,
+		active_app TEXT NOT NULL,
+		active_window_title TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_focus_events_start ON focus_events(start_time);
+	CREATE INDEX IF NOT EXISTS idx_focus_events_app ON focus_events(active_app);
+`
+
+func (db *DB) InsertFocusEvent(e *FocusEvent) (int64, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO focus_events (start_time, end_time, duration_seconds, active_app, active_window_title)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.StartTime, e.EndTime, e.Duration().Seconds(), e.ActiveApp, e.ActiveWindowTitle)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetFocusEvents lists focus events overlapping [from, to] in chronological
+// order. Events are returned whole; callers clip them to the range as needed.
+// An empty app matches everything, otherwise it matches a substring.
+func (db *DB) GetFocusEvents(from, to time.Time, app string, limit int) ([]FocusEvent, error) {
+	if limit <= 0 {
+		limit = 10000
+	}
+
+	where := "end_time > ? AND start_time < ?"
+	args := []interface{}{from, to}
+	if app != "" {
+		where += " AND active_app LIKE ?"
+		args = append(args, "%"+app+"%")
+	}
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(`
+		SELECT id, start_time, end_time, duration_seconds, active_app, COALESCE(active_window_title, '')
+		FROM focus_events
+		WHERE `+where+`
+		ORDER BY start_time ASC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []FocusEvent
+	for rows.Next() {
+		var e FocusEvent
+		if err := rows.Scan(&e.ID, &e.StartTime, &e.EndTime, &e.DurationSeconds, &e.ActiveApp, &e.ActiveWindowTitle); err != nil {
+			return nil, err
+		}
+		results = append(results, e)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,545 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kinds of problems Check finds.
+const (
+	IssueIntegrity        = "integrity"
+	IssueDanglingRow      = "dangling_row"
+	IssueEmptyImage       = "empty_image"
+	IssueUndecodableImage = "undecodable_image"
+	IssueSizeMismatch     = "size_mismatch"
+	IssueOrphanedFile     = "orphaned_file"
+	IssueOrphanedSegment  = "orphaned_segment"
+)
+
+// ReasonReimported is the capture reason of screenshots Check re-imported
+// from files no row referenced.
+const ReasonReimported = "reimported"
+
+// orphanGrace is how old a file must be before it counts as orphaned, so a
+// capture whose row isn't written yet isn't mistaken for one.
+const orphanGrace = time.Minute
+
+// CheckIssue is one problem found by Check. Table and ID name the row it is
+// about, if any.
+type CheckIssue struct {
+	Kind     string `json:"kind"`
+	Path     string `json:"path,omitempty"`
+	Table    string `json:"table,omitempty"`
+	ID       int64  `json:"id,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// CheckResult is the report of Check.
+type CheckResult struct {
+	Integrity []string     `json:"integrity"`
+	Rows      int          `json:"rows"`
+	Images    int          `json:"images"`
+	Bytes     int64        `json:"bytes"`
+	Files     int          `json:"files"`
+	Issues    []CheckIssue `json:"issues"`
+}
+
+// Unrepaired counts the issues left.
+func (r *CheckResult) Unrepaired() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckOptions controls Check.
+type CheckOptions struct {
+	// Repair deletes rows whose image is missing or broken, removes broken
+	// and leftover files, corrects file sizes and re-imports orphaned
+	// screenshots. Nothing is repaired if the database fails its integrity
+	// check.
+	Repair bool
+	// Quick only checks that images exist, without reading them.
+	Quick bool
+	// Progress is called after each image is checked.
+	Progress func(done, total int)
+}
+
+// imageRow is a row of screenshots or screenshot_displays that references an
+// image.
+type imageRow struct {
+	table    string
+	id       int64
+	image    ImageRef
+	fileSize int64
+}
+
+// Check compares the database with the files in the storage directory: it
+// runs SQLite's integrity check, reads every referenced image and looks for
+// files and segments no row references.
+func (fm *FileManager) Check(db *DB, opts CheckOptions) (*CheckResult, error) {
+	result := &CheckResult{}
+	integrity, err := db.integrityCheck()
+	if err != nil {
+		return result, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	result.Integrity = integrity
+	repair := opts.Repair
+	if len(integrity) != 1 || integrity[0] != "ok" {
+		for _, msg := range integrity {
+			result.Issues = append(result.Issues, CheckIssue{Kind: IssueIntegrity, Path: db.path, Detail: msg})
+		}
+		repair = false
+	}
+
+	// Keep compaction from moving images while they are checked
+	unlock, err := fm.LockFiles()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	rows, err := db.imageRows()
+	if err != nil {
+		return result, fmt.Errorf("failed to list images: %w", err)
+	}
+	result.Rows = len(rows)
+
+	// Rows sharing an image (a screenshot and its active display) are
+	// checked once
+	byImage := make(map[ImageRef][]imageRow)
+	var images []ImageRef
+	for _, row := range rows {
+		if _, ok := byImage[row.image]; !ok {
+			images = append(images, row.image)
+		}
+		byImage[row.image] = append(byImage[row.image], row)
+	}
+
+	// Files are also matched by their path under screenshots/, so a
+	// storage directory that moved doesn't look like all orphans
+	referenced := make(map[string]bool)
+	for i, image := range images {
+		stored := image.Path
+		if image.Packed() {
+			stored = image.Segment
+		}
+		referenced[stored] = true
+		if rel := screenshotsRel(stored); rel != "" {
+			referenced[rel] = true
+		}
+		if err := fm.checkImage(db, image, byImage[image], repair, opts.Quick, result); err != nil {
+			return result, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(images))
+		}
+	}
+
+	if err := fm.checkOrphans(db, referenced, repair, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// checkImage checks one image and the rows referencing it.
+func (fm *FileManager) checkImage(db *DB, image ImageRef, rows []imageRow, repair, quick bool, result *CheckResult) error {
+	path := image.Path
+	if image.Packed() {
+		path = fmt.Sprintf("%s@%d", image.Segment, image.Offset)
+	}
+	report := func(kind, detail string, fix func() error) error {
+		issue := CheckIssue{Kind: kind, Path: path, Table: rows[0].table, ID: rows[0].id, Detail: detail}
+		if repair && fix != nil {
+			if err := fix(); err != nil {
+				return fmt.Errorf("failed to repair %s: %w", path, err)
+			}
+			issue.Repaired = true
+		}
+		result.Issues = append(result.Issues, issue)
+		return nil
+	}
+	// A broken image takes its rows with it; a loose file is removed too
+	remove := func() error {
+		if err := db.deleteImageRows(rows); err != nil {
+			return err
+		}
+		if !image.Packed() {
+			if err := os.Remove(image.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !fm.ImageExists(image) {
+		stored := image.Path
+		if image.Packed() {
+			stored = image.Segment
+		}
+		// Rows pointing elsewhere are likely from before the storage
+		// directory moved: leave them alone
+		base, _ := filepath.Abs(fm.basePath)
+		if rel, err := filepath.Rel(base, stored); err != nil || strings.HasPrefix(rel, "..") {
+			return report(IssueDanglingRow, "image is outside the storage directory", nil)
+		}
+		return report(IssueDanglingRow, "image is missing", remove)
+	}
+	if quick {
+		return nil
+	}
+	data, err := fm.ReadImage(image)
+	if errors.Is(err, ErrLocked) {
+		return err
+	}
+	if err != nil {
+		return report(IssueUndecodableImage, err.Error(), remove)
+	}
+	result.Images++
+	result.Bytes += int64(len(data))
+	if len(data) == 0 {
+		return report(IssueEmptyImage, "image is empty", remove)
+	}
+	if _, _, err := WebPSize(data); err != nil {
+		return report(IssueUndecodableImage, err.Error(), remove)
+	}
+	for _, row := range rows {
+		if row.fileSize == int64(len(data)) {
+			continue
+		}
+		detail := fmt.Sprintf("file_size is %d, image is %d bytes", row.fileSize, len(data))
+		issue := CheckIssue{Kind: IssueSizeMismatch, Path: path, Table: row.table, ID: row.id, Detail: detail}
+		if repair {
+			if err := db.setFileSize(row, int64(len(data))); err != nil {
+				return fmt.Errorf("failed to repair %s: %w", path, err)
+			}
+			issue.Repaired = true
+		}
+		result.Issues = append(result.Issues, issue)
+	}
+	return nil
+}
+
+// checkOrphans looks for images and segments under screenshots/ that no row
+// references. Orphaned screenshots and the screenshots in orphaned segments
+// are re-imported when repairing.
+func (fm *FileManager) checkOrphans(db *DB, referenced map[string]bool, repair bool, result *CheckResult) error {
+	packed, err := db.packedPaths()
+	if err != nil {
+		return err
+	}
+	pruned, err := db.prunedPaths()
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(filepath.Join(fm.basePath, "screenshots"))
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if ext != ".webp" && ext != ".seg" && ext != ".tmp" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || time.Since(info.ModTime()) < orphanGrace {
+			return err
+		}
+		result.Files++
+
+		rel, _ := filepath.Rel(root, path)
+		if referenced[path] || referenced[rel] {
+			return nil
+		}
+		issue := CheckIssue{Kind: IssueOrphanedFile, Path: path}
+		var fix func() error
+		switch {
+		case ext == ".seg":
+			issue.Kind = IssueOrphanedSegment
+			fix = func() error { return fm.reimportSegment(db, path) }
+		case ext == ".tmp":
+			issue.Detail = "left by an interrupted write"
+			fix = func() error { return os.Remove(path) }
+		case packed[rel]:
+			issue.Detail = "already packed in a segment"
+			fix = func() error { return os.Remove(path) }
+		case pruned[rel]:
+			issue.Detail = "left by pruning"
+			fix = func() error { return os.Remove(path) }
+		default:
+			fix = func() error { return fm.reimportFile(db, path) }
+		}
+
+		if repair {
+			if err := fix(); err != nil {
+				issue.Detail = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+		result.Issues = append(result.Issues, issue)
+		return nil
+	})
+}
+
+// screenshotsRel returns the part of path after its screenshots directory,
+// or "" if there is none.
+func screenshotsRel(path string) string {
+	sep := string(filepath.Separator) + "screenshots" + string(filepath.Separator)
+	i := strings.LastIndex(path, sep)
+	if i < 0 {
+		return ""
+	}
+	return path[i+len(sep):]
+}
+
+// screenshotTime parses the capture time from a screenshot's file name, as
+// given by GetScreenshotPath. Display images have no time of their own.
+func screenshotTime(name string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02_15-04-05", strings.TrimSuffix(filepath.Base(name), ".webp"), time.Local)
+	return t, err == nil
+}
+
+// reimportFile adds a row for an orphaned screenshot, or removes it if it
+// can't be read.
+func (fm *FileManager) reimportFile(db *DB, path string) error {
+	data, err := fm.ReadImage(ImageRef{Path: path})
+	if err != nil {
+		return err
+	}
+	width, height, err := WebPSize(data)
+	if err != nil {
+		return os.Remove(path)
+	}
+	t, ok := screenshotTime(path)
+	if !ok {
+		return fmt.Errorf("not re-imported: display images need the row of their screenshot")
+	}
+	_, err = db.InsertScreenshot(&Screenshot{
+		Timestamp:     t,
+		Filepath:      path,
+		Width:         width,
+		Height:        height,
+		FileSize:      int64(len(data)),
+		CaptureReason: ReasonReimported,
+	})
+	return err
+}
+
+// reimportSegment adds rows for the screenshots in an orphaned segment that
+// no row has.
+func (fm *FileManager) reimportSegment(db *DB, path string) error {
+	entries, err := ReadSegmentIndex(path)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(filepath.Join(fm.basePath, "screenshots"))
+	if err != nil {
+		return err
+	}
+	imported := 0
+	for _, e := range entries {
+		t, ok := screenshotTime(e.Name)
+		if !ok {
+			continue
+		}
+		original := filepath.Join(root, filepath.FromSlash(e.Name))
+		if exists, err := db.imageRowExists(original); err != nil || exists {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		image := ImageRef{Path: original, Segment: path, Offset: e.Offset, Length: e.Length}
+		data, err := fm.ReadImage(image)
+		if err != nil {
+			return err
+		}
+		width, height, err := WebPSize(data)
+		if err != nil {
+			continue
+		}
+		_, err = db.conn.Exec(`
+			INSERT INTO screenshots (timestamp, filepath, width, height, file_size, capture_reason, segment, segment_offset, segment_length)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, t, original, width, height, len(data), ReasonReimported, path, e.Offset, e.Length)
+		if err != nil {
+			return err
+		}
+		imported++
+	}
+	if imported == 0 {
+		return fmt.Errorf("not re-imported: no screenshot in it is missing a row")
+	}
+	return nil
+}
+
+// WebPSize checks that data is a complete WebP image and returns its size
+// in pixels.
+func WebPSize(data []byte) (width, height int, err error) {
+	if len(data) < 20 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, fmt.Errorf("not a WebP image")
+	}
+	if size := int(binary.LittleEndian.Uint32(data[4:8])) + 8; size > len(data) {
+		return 0, 0, fmt.Errorf("truncated: %d of %d bytes", len(data), size)
+	}
+	chunk := string(data[12:16])
+	payload := data[20:]
+	if int(binary.LittleEndian.Uint32(data[16:20])) > len(payload) {
+		return 0, 0, fmt.Errorf("truncated %s chunk", strings.TrimSpace(chunk))
+	}
+
+	switch chunk {
+	case "VP8X":
+		if len(payload) < 10 {
+			return 0, 0, fmt.Errorf("truncated VP8X chunk")
+		}
+		width = (int(payload[4]) | int(payload[5])<<8 | int(payload[6])<<16) + 1
+		height = (int(payload[7]) | int(payload[8])<<8 | int(payload[9])<<16) + 1
+	case "VP8 ":
+		if len(payload) < 10 || payload[3] != 0x9d || payload[4] != 0x01 || payload[5] != 0x2a {
+			return 0, 0, fmt.Errorf("damaged VP8 frame header")
+		}
+		width = int(binary.LittleEndian.Uint16(payload[6:8]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(payload[8:10]) & 0x3fff)
+	case "VP8L":
+		if len(payload) < 5 || payload[0] != 0x2f {
+			return 0, 0, fmt.Errorf("damaged VP8L header")
+		}
+		bits := binary.LittleEndian.Uint32(payload[1:5])
+		width = int(bits&0x3fff) + 1
+		height = int((bits>>14)&0x3fff) + 1
+	default:
+		return 0, 0, fmt.Errorf("unknown WebP chunk %q", chunk)
+	}
+	return width, height, nil
+}
+
+// integrityCheck returns the result of PRAGMA integrity_check: "ok" or the
+// problems found.
+func (db *DB) integrityCheck() ([]string, error) {
+	rows, err := db.conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// imageRowColumns are the columns scanImageRows reads after the table name.
+const imageRowColumns = "id, filepath, COALESCE(file_size, 0), COALESCE(segment, ''), COALESCE(segment_offset, 0), COALESCE(segment_length, 0)"
+
+// imageRows returns every row that references an image, leaving out those
+// whose image was pruned.
+func (db *DB) imageRows() ([]imageRow, error) {
+	rows, err := db.conn.Query(`
+		SELECT 'screenshots', ` + imageRowColumns + `
+		FROM screenshots
+		WHERE pruned_at IS NULL
+		UNION ALL
+		SELECT 'screenshot_displays', ` + imageRowColumns + `
+		FROM screenshot_displays
+		WHERE pruned_at IS NULL
+		ORDER BY 1 DESC, 2
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanImageRows(rows)
+}
+
+func scanImageRows(rows *sql.Rows) ([]imageRow, error) {
+	defer rows.Close()
+
+	var results []imageRow
+	for rows.Next() {
+		var r imageRow
+		if err := rows.Scan(&r.table, &r.id, &r.image.Path, &r.fileSize, &r.image.Segment, &r.image.Offset, &r.image.Length); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// packedPaths returns the original paths of packed images, relative to
+// the screenshots directory.
+func (db *DB) packedPaths() (map[string]bool, error) {
+	return db.relativePaths(`
+		SELECT filepath FROM screenshots WHERE segment IS NOT NULL
+		UNION
+		SELECT filepath FROM screenshot_displays WHERE segment IS NOT NULL
+	`)
+}
+
+// prunedPaths returns the original paths of pruned images, relative to the
+// screenshots directory.
+func (db *DB) prunedPaths() (map[string]bool, error) {
+	return db.relativePaths(`
+		SELECT filepath FROM screenshots WHERE pruned_at IS NOT NULL
+		UNION
+		SELECT filepath FROM screenshot_displays WHERE pruned_at IS NOT NULL
+	`)
+}
+
+func (db *DB) relativePaths(query string) (map[string]bool, error) {
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	rel := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		rel[screenshotsRel(p)] = true
+	}
+	return rel, nil
+}
+
+// imageRowExists reports whether any row references the image at path.
+func (db *DB) imageRowExists(path string) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM screenshots WHERE filepath = ?) OR EXISTS(SELECT 1 FROM screenshot_displays WHERE filepath = ?)
+	`, path, path).Scan(&exists)
+	return exists, err
+}
+
+// deleteImageRows deletes rows whose image is gone. Deleting a screenshot
+// also deletes its displays and entities.
+func (db *DB) deleteImageRows(rows []imageRow) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range rows {
+		if _, err := tx.Exec(`DELETE FROM `+row.table+` WHERE id = ?`, row.id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) setFileSize(row imageRow, size int64) error {
+	_, err := db.conn.Exec(`UPDATE `+row.table+` SET file_size = ? WHERE id = ?`, size, row.id)
+	return err
+}
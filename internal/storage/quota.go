@@ -0,0 +1,471 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Usage is how the space taken by the storage directory splits up, in bytes.
+type Usage struct {
+	Total       int64 `json:"total"`
+	Database    int64 `json:"database"`
+	Screenshots int64 `json:"screenshots"`
+	Thumbnails  int64 `json:"thumbnails"`
+	Other       int64 `json:"other"`
+}
+
+// DiskUsage adds up the files in the storage directory.
+func (fm *FileManager) DiskUsage() (*Usage, error) {
+	usage := &Usage{}
+	sep := string(filepath.Separator)
+	err := filepath.WalkDir(fm.basePath, func(path string, d fs.DirEntry, err error) error {
+		// Files may come and go while the daemon runs
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		usage.Total += size
+		rel, _ := filepath.Rel(fm.basePath, path)
+		switch {
+		case strings.HasPrefix(rel, "memento.db"):
+			usage.Database += size
+		case strings.HasPrefix(rel, "screenshots"+sep):
+			usage.Screenshots += size
+		case strings.HasPrefix(rel, "thumbnails"+sep):
+			usage.Thumbnails += size
+		default:
+			usage.Other += size
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// ImageUsage is how many screenshots of a month or app still have their
+// images, and the size of those images.
+type ImageUsage struct {
+	Name        string `json:"name"`
+	Screenshots int    `json:"screenshots"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// screenshotBytes is the size of a screenshot's images: its own and those of
+// its other displays.
+const screenshotBytes = `COALESCE(s.file_size, 0) + COALESCE((
+	SELECT SUM(d.file_size) FROM screenshot_displays d WHERE d.screenshot_id = s.id AND d.filepath != s.filepath
+), 0)`
+
+// ImageUsageByMonth returns the image usage of each month (2006-01), oldest
+// first.
+func (db *DB) ImageUsageByMonth() ([]ImageUsage, error) {
+	// Timestamps are stored in local time, so the month is their prefix
+	return db.imageUsage("substr(s.timestamp, 1, 7)", "1")
+}
+
+// ImageUsageByApp returns the image usage of each app, largest first.
+func (db *DB) ImageUsageByApp() ([]ImageUsage, error) {
+	return db.imageUsage("COALESCE(s.active_app, '')", "3 DESC")
+}
+
+func (db *DB) imageUsage(group, order string) ([]ImageUsage, error) {
+	rows, err := db.conn.Query(`
+		SELECT ` + group + `, COUNT(*), SUM(` + screenshotBytes + `)
+		FROM screenshots s
+		WHERE s.pruned_at IS NULL
+		GROUP BY 1
+		ORDER BY ` + order)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ImageUsage
+	for rows.Next() {
+		var u ImageUsage
+		if err := rows.Scan(&u.Name, &u.Screenshots, &u.Bytes); err != nil {
+			return nil, err
+		}
+		results = append(results, u)
+	}
+	return results, rows.Err()
+}
+
+// ImageBytesSince returns the size of the images captured since t, pruned
+// or not, and when the first of them was captured.
+func (db *DB) ImageBytesSince(t time.Time) (int64, time.Time, error) {
+	var bytes int64
+	err := db.conn.QueryRow(`
+		SELECT COALESCE(SUM(`+screenshotBytes+`), 0) FROM screenshots s WHERE s.timestamp >= ?
+	`, t).Scan(&bytes)
+	if err != nil || bytes == 0 {
+		return 0, time.Time{}, err
+	}
+	// MIN() would lose the column type, and with it the time parsing
+	var first time.Time
+	err = db.conn.QueryRow(`
+		SELECT timestamp FROM screenshots WHERE timestamp >= ? ORDER BY timestamp LIMIT 1
+	`, t).Scan(&first)
+	return bytes, first, err
+}
+
+// CountPrunedScreenshots returns how many screenshots had their images
+// pruned.
+func (db *DB) CountPrunedScreenshots() (int, error) {
+	var n int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM screenshots WHERE pruned_at IS NOT NULL`).Scan(&n)
+	return n, err
+}
+
+// pruneBatch is how many screenshots PruneImages considers at a time.
+const pruneBatch = 500
+
+// PruneResult summarizes a run of PruneImages. Through is when the newest
+// pruned screenshot was taken.
+type PruneResult struct {
+	Screenshots int       `json:"screenshots"`
+	Images      int       `json:"images"`
+	Bytes       int64     `json:"bytes"`
+	Segments    int       `json:"segments"`
+	Through     time.Time `json:"through,omitempty"`
+}
+
+// pruneCandidate is a screenshot whose images can be pruned, with the rows
+// of its images.
+type pruneCandidate struct {
+	id        int64
+	timestamp time.Time
+	thumbnail string
+	images    []imageRow
+}
+
+// segmentMove records that the entries old of segment from were copied to
+// the entries moved of segment to.
+type segmentMove struct {
+	from, to   string
+	old, moved []SegmentEntry
+}
+
+// PruneImages deletes the images and thumbnails of the oldest screenshots
+// until about bytes are freed. The rows stay, with their text, app and
+// window, and are marked as pruned. Screenshots whose text hasn't been
+// recognized yet are left alone. A packed month is pruned a segment at a
+// time, so segments rarely need rewriting.
+func (fm *FileManager) PruneImages(db *DB, bytes int64) (*PruneResult, error) {
+	result := &PruneResult{}
+	if bytes <= 0 {
+		return result, nil
+	}
+	unlock, err := fm.LockFiles()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	var chosen []pruneCandidate
+	segments := make(map[string]bool)
+	var planned int64
+	var after pruneCandidate
+	for done := false; !done; {
+		batch, err := db.pruneCandidates(after.timestamp, after.id, pruneBatch)
+		if err != nil {
+			return result, fmt.Errorf("failed to list screenshots: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, c := range batch {
+			// Once enough is planned, finish the segment being pruned
+			// instead of leaving it to be rewritten
+			inSegment := false
+			for _, row := range c.images {
+				inSegment = inSegment || segments[row.image.Segment]
+			}
+			if planned >= bytes && !inSegment {
+				done = true
+				break
+			}
+			chosen = append(chosen, c)
+			planned += fm.candidateSize(c)
+			for _, row := range c.images {
+				if row.image.Packed() {
+					segments[row.image.Segment] = true
+				}
+			}
+		}
+		after = batch[len(batch)-1]
+	}
+	if len(chosen) == 0 {
+		return result, nil
+	}
+	return result, fm.prune(db, chosen, segments, result)
+}
+
+// candidateSize estimates the bytes pruning c frees.
+func (fm *FileManager) candidateSize(c pruneCandidate) int64 {
+	var size int64
+	seen := make(map[ImageRef]bool)
+	for _, row := range c.images {
+		if seen[row.image] {
+			continue
+		}
+		seen[row.image] = true
+		if row.image.Packed() {
+			size += row.image.Length
+		} else if info, err := os.Stat(row.image.Path); err == nil {
+			size += info.Size()
+		}
+	}
+	if c.thumbnail != "" {
+		if info, err := os.Stat(c.thumbnail); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// prune deletes the images of the chosen screenshots. Segments still
+// holding images of other screenshots are rewritten without the pruned
+// ones first, then the rows are updated in one transaction, and only then
+// are files removed, so an interrupted run leaves every unpruned image
+// readable.
+func (fm *FileManager) prune(db *DB, chosen []pruneCandidate, segments map[string]bool, result *PruneResult) error {
+	ids := make(map[int64]bool, len(chosen))
+	for _, c := range chosen {
+		ids[c.id] = true
+	}
+
+	var moves []segmentMove
+	committed := false
+	defer func() {
+		if !committed {
+			for _, m := range moves {
+				os.Remove(m.to)
+			}
+		}
+	}()
+	next := make(map[string]int)
+	for segment := range segments {
+		kept, err := db.keptSegmentEntries(segment, ids)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", segment, err)
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		dir := filepath.Dir(segment)
+		if _, ok := next[dir]; !ok {
+			if next[dir], err = fm.cleanSegments(db, dir); err != nil {
+				return err
+			}
+		}
+		w, err := createSegment(filepath.Join(dir, fmt.Sprintf("segment-%03d.seg", next[dir])))
+		if err != nil {
+			return err
+		}
+		next[dir]++
+		if err := copySegmentEntries(segment, kept, w); err != nil {
+			w.abort()
+			return fmt.Errorf("failed to rewrite %s: %w", segment, err)
+		}
+		moves = append(moves, segmentMove{from: segment, to: w.path, old: kept, moved: w.entries})
+	}
+
+	if err := db.markPruned(chosen, moves); err != nil {
+		return fmt.Errorf("failed to record pruned screenshots: %w", err)
+	}
+	committed = true
+
+	for segment := range segments {
+		if info, err := os.Stat(segment); err == nil && os.Remove(segment) == nil {
+			result.Bytes += info.Size()
+			result.Segments++
+		}
+	}
+	for _, m := range moves {
+		if info, err := os.Stat(m.to); err == nil {
+			result.Bytes -= info.Size()
+		}
+	}
+	removed := make(map[ImageRef]bool)
+	for _, c := range chosen {
+		files := []string{c.thumbnail}
+		for _, row := range c.images {
+			if removed[row.image] {
+				continue
+			}
+			removed[row.image] = true
+			result.Images++
+			if !row.image.Packed() {
+				files = append(files, row.image.Path)
+			}
+		}
+		for _, path := range files {
+			if path == "" {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && os.Remove(path) == nil {
+				result.Bytes += info.Size()
+				// Leave no empty day directories behind
+				os.Remove(filepath.Dir(path))
+			}
+		}
+		result.Screenshots++
+		result.Through = c.timestamp
+	}
+	return nil
+}
+
+// copySegmentEntries writes entries of segment to w as they are, encrypted
+// or not, and finishes w.
+func copySegmentEntries(segment string, entries []SegmentEntry, w *segmentWriter) error {
+	f, err := os.Open(segment)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, e := range entries {
+		data := make([]byte, e.Length)
+		if _, err := f.ReadAt(data, e.Offset); err != nil {
+			return err
+		}
+		if err := w.write(e.Name, data); err != nil {
+			return err
+		}
+	}
+	return w.finish()
+}
+
+// pruneCandidates returns up to limit of the oldest screenshots after the
+// one taken at t with ID id whose images can be pruned.
+func (db *DB) pruneCandidates(t time.Time, id int64, limit int) ([]pruneCandidate, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, timestamp, COALESCE(thumbnail_path, '')
+		FROM screenshots
+		WHERE pruned_at IS NULL AND ocr_processed_at IS NOT NULL AND (timestamp > ? OR (timestamp = ? AND id > ?))
+		ORDER BY timestamp, id
+		LIMIT ?
+	`, t, t, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []pruneCandidate
+	for rows.Next() {
+		var c pruneCandidate
+		if err := rows.Scan(&c.id, &c.timestamp, &c.thumbnail); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		rows, err := db.conn.Query(`
+			SELECT 'screenshots', `+imageRowColumns+` FROM screenshots WHERE id = ?
+			UNION ALL
+			SELECT 'screenshot_displays', `+imageRowColumns+` FROM screenshot_displays WHERE screenshot_id = ?
+		`, candidates[i].id, candidates[i].id)
+		if err != nil {
+			return nil, err
+		}
+		if candidates[i].images, err = scanImageRows(rows); err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+// keptSegmentEntries returns the entries of segment that rows of screenshots
+// other than those in pruned still point at.
+func (db *DB) keptSegmentEntries(segment string, pruned map[int64]bool) ([]SegmentEntry, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, segment_offset FROM screenshots WHERE segment = ?
+		UNION ALL
+		SELECT screenshot_id, segment_offset FROM screenshot_displays WHERE segment = ?
+	`, segment, segment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	used := make(map[int64]bool)
+	for rows.Next() {
+		var id, offset int64
+		if err := rows.Scan(&id, &offset); err != nil {
+			return nil, err
+		}
+		if !pruned[id] {
+			used[offset] = true
+		}
+	}
+	if err := rows.Err(); err != nil || len(used) == 0 {
+		return nil, err
+	}
+
+	entries, err := ReadSegmentIndex(segment)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing left to keep; fsck reports the rows
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kept []SegmentEntry
+	for _, e := range entries {
+		if used[e.Offset] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// markPruned points the rows of rewritten segments at their new segments
+// and marks the chosen screenshots and their displays as pruned.
+func (db *DB) markPruned(chosen []pruneCandidate, moves []segmentMove) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range moves {
+		if err := moveSegmentEntries(tx, m.from, m.to, m.old, m.moved); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for _, stmt := range []string{
+		`UPDATE screenshots SET pruned_at = ?, thumbnail_path = NULL, segment = NULL, segment_offset = NULL, segment_length = NULL WHERE id = ?`,
+		`UPDATE screenshot_displays SET pruned_at = ?, segment = NULL, segment_offset = NULL, segment_length = NULL WHERE screenshot_id = ?`,
+	} {
+		update, err := tx.Prepare(stmt)
+		if err != nil {
+			return err
+		}
+		for _, c := range chosen {
+			if _, err := update.Exec(now, c.id); err != nil {
+				update.Close()
+				return err
+			}
+		}
+		update.Close()
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,566 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Finished months of screenshots are packed into segment files, one or more
+// per month, to keep the file count down for backups and Time Machine. The
+// rows keep their original filepath and point at the segment, offset and
+// length holding the image.
+//
+// A segment is the magic, the images back to back, a JSON index of
+// SegmentEntry, the index offset as a big-endian uint64 and the magic again,
+// so it can be read without the database.
+const segmentMagic = "MEMSEG01"
+
+// SegmentMaxSize is the size at which a new segment is started.
+const SegmentMaxSize = 512 << 20
+
+// SegmentEntry is one image in a segment. Name is its path relative to the
+// screenshots directory when it was a loose file.
+type SegmentEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// ImageRef locates an image: the loose file at Path or, once its month is
+// compacted, Length bytes at Offset in the Segment file.
+type ImageRef struct {
+	Path    string
+	Segment string
+	Offset  int64
+	Length  int64
+}
+
+// Packed reports whether the image lives in a segment.
+func (r ImageRef) Packed() bool {
+	return r.Segment != ""
+}
+
+// Image returns where the screenshot's image is.
+func (s *Screenshot) Image() ImageRef {
+	return ImageRef{Path: s.Filepath, Segment: s.Segment, Offset: s.SegmentOffset, Length: s.SegmentLength}
+}
+
+// Image returns where the display's image is.
+func (d *ScreenshotDisplay) Image() ImageRef {
+	return ImageRef{Path: d.Filepath, Segment: d.Segment, Offset: d.SegmentOffset, Length: d.SegmentLength}
+}
+
+type segmentImage struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *segmentImage) Close() error {
+	return s.f.Close()
+}
+
+// OpenImage opens an image whether it is a loose file or packed, and
+// decrypts it if it is encrypted.
+func (fm *FileManager) OpenImage(ref ImageRef) (io.ReadSeekCloser, error) {
+	r, err := fm.openStored(ref)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := isEncryptedFile(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if !encrypted {
+		return r, nil
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = fm.cipher.OpenImage(data); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ref.Path, err)
+	}
+	return decryptedImage{bytes.NewReader(data)}, nil
+}
+
+// openStored opens an image's bytes as they are stored.
+func (fm *FileManager) openStored(ref ImageRef) (io.ReadSeekCloser, error) {
+	if !ref.Packed() {
+		return os.Open(ref.Path)
+	}
+	f, err := os.Open(ref.Segment)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentImage{SectionReader: io.NewSectionReader(f, ref.Offset, ref.Length), f: f}, nil
+}
+
+// ReadImage returns the content of an image.
+func (fm *FileManager) ReadImage(ref ImageRef) ([]byte, error) {
+	r, err := fm.OpenImage(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ImageExists reports whether the image's file, or the part of the segment
+// holding it, is there.
+func (fm *FileManager) ImageExists(ref ImageRef) bool {
+	if !ref.Packed() {
+		_, err := os.Stat(ref.Path)
+		return err == nil
+	}
+	info, err := os.Stat(ref.Segment)
+	return err == nil && info.Size() >= ref.Offset+ref.Length
+}
+
+// ImageFile returns a path to the image for tools that need a file, such as
+// sips and the OCR worker. Packed and encrypted images are extracted to a
+// temporary file, which release removes; for other files release does
+// nothing.
+func (fm *FileManager) ImageFile(ref ImageRef) (path string, release func(), err error) {
+	if !ref.Packed() {
+		f, err := os.Open(ref.Path)
+		if err != nil {
+			return "", nil, err
+		}
+		encrypted, err := isEncryptedFile(f)
+		f.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		if !encrypted {
+			return ref.Path, func() {}, nil
+		}
+	}
+	r, err := fm.OpenImage(ref)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp("", "memento_image_*"+filepath.Ext(ref.Path))
+	if err != nil {
+		return "", nil, err
+	}
+	release = func() { os.Remove(tmp.Name()) }
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		release()
+		return "", nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		release()
+		return "", nil, err
+	}
+	return tmp.Name(), release, nil
+}
+
+// ReadSegmentIndex returns the entries of the segment at path.
+func ReadSegmentIndex(path string) ([]SegmentEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, 8+len(segmentMagic))
+	if info.Size() < int64(2*len(segmentMagic)+8) {
+		return nil, fmt.Errorf("%s is not a segment", path)
+	}
+	if _, err := f.ReadAt(trailer, info.Size()-int64(len(trailer))); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != segmentMagic {
+		return nil, fmt.Errorf("%s is not a segment or is incomplete", path)
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(trailer))
+	indexEnd := info.Size() - int64(len(trailer))
+	if indexOffset < int64(len(segmentMagic)) || indexOffset > indexEnd {
+		return nil, fmt.Errorf("%s has a damaged index", path)
+	}
+
+	var entries []SegmentEntry
+	if err := json.NewDecoder(io.NewSectionReader(f, indexOffset, indexEnd-indexOffset)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s has a damaged index: %w", path, err)
+	}
+	return entries, nil
+}
+
+// segmentWriter writes a segment to a temporary file and moves it into
+// place once it is complete.
+type segmentWriter struct {
+	path    string
+	f       *os.File
+	offset  int64
+	entries []SegmentEntry
+	sources []string
+}
+
+func createSegment(path string) (*segmentWriter, error) {
+	f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(f, segmentMagic); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &segmentWriter{path: path, f: f, offset: int64(len(segmentMagic))}, nil
+}
+
+// add appends the file at src under name, passed through seal.
+func (w *segmentWriter) add(name, src string, seal func([]byte) []byte) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := w.write(name, seal(data)); err != nil {
+		return err
+	}
+	w.sources = append(w.sources, src)
+	return nil
+}
+
+// write appends data under name.
+func (w *segmentWriter) write(name string, data []byte) error {
+	if _, err := w.f.Write(data); err != nil {
+		return err
+	}
+	w.entries = append(w.entries, SegmentEntry{Name: name, Offset: w.offset, Length: int64(len(data))})
+	w.offset += int64(len(data))
+	return nil
+}
+
+func (w *segmentWriter) finish() error {
+	index, err := json.Marshal(w.entries)
+	if err != nil {
+		return err
+	}
+	trailer := binary.BigEndian.AppendUint64(nil, uint64(w.offset))
+	trailer = append(trailer, segmentMagic...)
+	if _, err := w.f.Write(append(index, trailer...)); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.f.Name(), w.path)
+}
+
+func (w *segmentWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// CompactResult summarizes the compaction of one month.
+type CompactResult struct {
+	Month    string   `json:"month"`
+	Images   int      `json:"images"`
+	Bytes    int64    `json:"bytes"`
+	Segments []string `json:"segments,omitempty"`
+	// Missing counts images the database references that weren't on disk
+	Missing int `json:"missing,omitempty"`
+}
+
+// monthDir returns the directory holding a month's screenshots.
+func (fm *FileManager) monthDir(month time.Time) string {
+	return filepath.Join(fm.basePath, "screenshots", fmt.Sprintf("%d", month.Year()), fmt.Sprintf("%02d", month.Month()))
+}
+
+// LooseMonths returns the months, oldest first, whose directories still
+// hold day directories of loose screenshots.
+func (fm *FileManager) LooseMonths() ([]time.Time, error) {
+	root := filepath.Join(fm.basePath, "screenshots")
+	years, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var months []time.Time
+	for _, y := range years {
+		entries, err := os.ReadDir(filepath.Join(root, y.Name()))
+		if err != nil || !y.IsDir() {
+			continue
+		}
+		for _, m := range entries {
+			month, err := time.ParseInLocation("2006/01", y.Name()+"/"+m.Name(), time.Local)
+			if err != nil || !m.IsDir() {
+				continue
+			}
+			days, _ := os.ReadDir(filepath.Join(root, y.Name(), m.Name()))
+			for _, d := range days {
+				if d.IsDir() {
+					months = append(months, month)
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months, nil
+}
+
+// CompactMonth packs the images of a finished month into segments in the
+// month's directory, points the rows at them and removes the loose files.
+// Files no row references are left alone. In an encrypted archive, images
+// still in plaintext are encrypted on the way. An interrupted run is cleaned
+// up by the next one.
+func (fm *FileManager) CompactMonth(db *DB, month time.Time) (*CompactResult, error) {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+	result := &CompactResult{Month: month.Format("2006-01")}
+	if !time.Now().After(month.AddDate(0, 1, 0)) {
+		return result, fmt.Errorf("%s isn't over yet", result.Month)
+	}
+
+	unlock, err := fm.LockFiles()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	dir := fm.monthDir(month)
+	next, err := fm.cleanSegments(db, dir)
+	if err != nil {
+		return result, err
+	}
+	images, err := db.looseImages(dir)
+	if err != nil {
+		return result, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	var w *segmentWriter
+	defer func() {
+		if w != nil {
+			w.abort()
+		}
+	}()
+	flush := func() error {
+		if err := w.finish(); err != nil {
+			return err
+		}
+		if err := db.packImages(w.path, w.sources, w.entries); err != nil {
+			return fmt.Errorf("failed to record %s: %w", w.path, err)
+		}
+		for _, src := range w.sources {
+			os.Remove(src)
+		}
+		result.Segments = append(result.Segments, w.path)
+		w = nil
+		return nil
+	}
+
+	for _, src := range images {
+		info, err := os.Stat(src)
+		if err != nil {
+			result.Missing++
+			continue
+		}
+		if w != nil && w.offset+info.Size() > SegmentMaxSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+		if w == nil {
+			if w, err = createSegment(filepath.Join(dir, fmt.Sprintf("segment-%03d.seg", next))); err != nil {
+				return result, err
+			}
+			next++
+		}
+		name, _ := filepath.Rel(filepath.Join(fm.basePath, "screenshots"), src)
+		if err := w.add(filepath.ToSlash(name), src, fm.sealImage); err != nil {
+			return result, fmt.Errorf("failed to pack %s: %w", src, err)
+		}
+		result.Images++
+		result.Bytes += w.entries[len(w.entries)-1].Length
+	}
+	if w != nil {
+		if err := flush(); err != nil {
+			return result, err
+		}
+	}
+
+	// Loose copies of packed images left by an interrupted run
+	packed, err := db.packedImages(dir)
+	if err != nil {
+		return result, err
+	}
+	for _, path := range packed {
+		os.Remove(path)
+	}
+	removeEmptyDirs(dir)
+	return result, nil
+}
+
+// cleanSegments removes unfinished segments and ones no row points at, both
+// left by interrupted runs, and returns the next free segment number.
+func (fm *FileManager) cleanSegments(db *DB, dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	next := 0
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if strings.HasSuffix(e.Name(), ".seg.tmp") {
+			os.Remove(path)
+			continue
+		}
+		var n int
+		if _, err := fmt.Sscanf(e.Name(), "segment-%d.seg", &n); err != nil || filepath.Ext(e.Name()) != ".seg" {
+			continue
+		}
+		used, err := db.segmentInUse(path)
+		if err != nil {
+			return 0, err
+		}
+		if !used {
+			os.Remove(path)
+			continue
+		}
+		if n >= next {
+			next = n + 1
+		}
+	}
+	return next, nil
+}
+
+// LockFiles keeps two processes, such as the daemon and memento screenshots
+// compact, from moving or removing images at the same time. Compaction,
+// pruning, encryption, fsck and backups each hold it while they run.
+func (fm *FileManager) LockFiles() (unlock func(), err error) {
+	f, err := os.OpenFile(filepath.Join(fm.basePath, "compact.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("another compaction, prune or backup is running")
+	}
+	return func() { f.Close() }, nil
+}
+
+// removeEmptyDirs removes the empty directories under dir, deepest first.
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			sub := filepath.Join(dir, e.Name())
+			removeEmptyDirs(sub)
+			os.Remove(sub)
+		}
+	}
+}
+
+// pathRange returns bounds selecting the paths under dir with an index
+// range scan: every such path sorts between dir+"/" and dir+"0", since "0"
+// follows "/".
+func pathRange(dir string) (string, string) {
+	dir = filepath.Clean(dir)
+	return dir + string(filepath.Separator), dir + string(filepath.Separator+1)
+}
+
+// looseImages returns the files under dir that rows still reference
+// directly, in name order.
+func (db *DB) looseImages(dir string) ([]string, error) {
+	lo, hi := pathRange(dir)
+	rows, err := db.conn.Query(`
+		SELECT filepath FROM screenshots WHERE segment IS NULL AND pruned_at IS NULL AND filepath >= ? AND filepath < ?
+		UNION
+		SELECT filepath FROM screenshot_displays WHERE segment IS NULL AND pruned_at IS NULL AND filepath >= ? AND filepath < ?
+		ORDER BY filepath
+	`, lo, hi, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// packedImages returns the files under dir whose rows point at a segment.
+func (db *DB) packedImages(dir string) ([]string, error) {
+	lo, hi := pathRange(dir)
+	rows, err := db.conn.Query(`
+		SELECT filepath FROM screenshots WHERE segment IS NOT NULL AND filepath >= ? AND filepath < ?
+		UNION
+		SELECT filepath FROM screenshot_displays WHERE segment IS NOT NULL AND filepath >= ? AND filepath < ?
+	`, lo, hi, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var results []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+// packImages points the rows of each source file at its entry in segment.
+func (db *DB) packImages(segment string, sources []string, entries []SegmentEntry) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"screenshots", "screenshot_displays"} {
+		stmt, err := tx.Prepare(`UPDATE ` + table + ` SET segment = ?, segment_offset = ?, segment_length = ? WHERE filepath = ? AND segment IS NULL`)
+		if err != nil {
+			return err
+		}
+		for i, src := range sources {
+			if _, err := stmt.Exec(segment, entries[i].Offset, entries[i].Length, src); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		stmt.Close()
+	}
+	return tx.Commit()
+}
+
+// segmentInUse reports whether any row points at segment.
+func (db *DB) segmentInUse(segment string) (bool, error) {
+	var used bool
+	err := db.conn.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM screenshots WHERE segment = ?) OR EXISTS(SELECT 1 FROM screenshot_displays WHERE segment = ?)
+	`, segment, segment).Scan(&used)
+	return used, err
+}
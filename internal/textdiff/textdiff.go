@@ -0,0 +1,120 @@
+package textdiff
+
+import "strings"
+
+// Above this many DP cells the exact diff is replaced by a bag-of-words
+// comparison, which keeps the cost bounded for screens full of text.
+const maxLCSCells = 4_000_000
+
+// Added returns the runs of words in newText that do not appear in oldText,
+// in the order they occur. Words are compared exactly after splitting on
+// whitespace, so OCR line breaks and spacing do not count as changes.
+func Added(oldText, newText string) []string {
+	a := strings.Fields(oldText)
+	b := strings.Fields(newText)
+	if len(b) == 0 {
+		return nil
+	}
+
+	kept := commonWords(a, b)
+
+	var runs []string
+	var run []string
+	for i, word := range b {
+		if kept[i] {
+			if len(run) > 0 {
+				runs = append(runs, strings.Join(run, " "))
+				run = nil
+			}
+			continue
+		}
+		run = append(run, word)
+	}
+	if len(run) > 0 {
+		runs = append(runs, strings.Join(run, " "))
+	}
+	return runs
+}
+
+// commonWords marks the words of b that are part of a longest common
+// subsequence with a.
+func commonWords(a, b []string) []bool {
+	kept := make([]bool, len(b))
+
+	// Unchanged leading and trailing words are the common case between two
+	// captures of the same window, so strip them before the quadratic part.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		kept[prefix] = true
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		kept[len(b)-1-suffix] = true
+		suffix++
+	}
+
+	am := a[prefix : len(a)-suffix]
+	bm := b[prefix : len(b)-suffix]
+	if len(am) == 0 || len(bm) == 0 {
+		return kept
+	}
+
+	var middle []bool
+	if len(am)*len(bm) <= maxLCSCells {
+		middle = lcsMask(am, bm)
+	} else {
+		middle = bagMask(am, bm)
+	}
+	copy(kept[prefix:], middle)
+	return kept
+}
+
+func lcsMask(a, b []string) []bool {
+	n, m := len(a), len(b)
+	// lengths[i*(m+1)+j] is the LCS length of a[i:] and b[j:]
+	lengths := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			idx := i*(m+1) + j
+			if a[i] == b[j] {
+				lengths[idx] = lengths[(i+1)*(m+1)+j+1] + 1
+			} else if down, right := lengths[(i+1)*(m+1)+j], lengths[idx+1]; down >= right {
+				lengths[idx] = down
+			} else {
+				lengths[idx] = right
+			}
+		}
+	}
+
+	mask := make([]bool, m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			mask[j] = true
+			i++
+			j++
+		case lengths[(i+1)*(m+1)+j] >= lengths[i*(m+1)+j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return mask
+}
+
+func bagMask(a, b []string) []bool {
+	counts := make(map[string]int, len(a))
+	for _, w := range a {
+		counts[w]++
+	}
+	mask := make([]bool, len(b))
+	for j, w := range b {
+		if counts[w] > 0 {
+			counts[w]--
+			mask[j] = true
+		}
+	}
+	return mask
+}
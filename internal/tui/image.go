@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Inline image protocols.
+const (
+	ImageNone  = ""
+	ImageKitty = "kitty"
+	ImageITerm = "iterm"
+)
+
+// DetectImageProtocol guesses which inline image protocol the terminal
+// speaks from the environment. MEMENTO_IMAGES=kitty|iterm|none overrides it.
+func DetectImageProtocol() string {
+	switch strings.ToLower(os.Getenv("MEMENTO_IMAGES")) {
+	case "kitty":
+		return ImageKitty
+	case "iterm":
+		return ImageITerm
+	case "none", "off":
+		return ImageNone
+	}
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(os.Getenv("TERM"), "kitty") || os.Getenv("TERM_PROGRAM") == "ghostty" {
+		return ImageKitty
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm":
+		return ImageITerm
+	}
+	if os.Getenv("LC_TERMINAL") == "iTerm2" {
+		return ImageITerm
+	}
+	return ImageNone
+}
+
+// DrawImage writes a PNG image at the cursor, scaled to fit cols x rows
+// cells, using protocol.
+func DrawImage(w io.Writer, protocol string, png []byte, cols, rows int) error {
+	data := base64.StdEncoding.EncodeToString(png)
+	switch protocol {
+	case ImageKitty:
+		// Sent in chunks of at most 4096 bytes; m=1 means more follow
+		const chunk = 4096
+		for i := 0; i < len(data); i += chunk {
+			end := min(i+chunk, len(data))
+			more := 0
+			if end < len(data) {
+				more = 1
+			}
+			var err error
+			if i == 0 {
+				_, err = fmt.Fprintf(w, "\x1b_Gf=100,a=T,q=2,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, data[i:end])
+			} else {
+				_, err = fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, data[i:end])
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case ImageITerm:
+		_, err := fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a", len(png), cols, rows, data)
+		return err
+	}
+	return nil
+}
+
+// ClearImages removes images drawn with protocol. iTerm images are plain
+// cells and disappear when overwritten.
+func ClearImages(w io.Writer, protocol string) {
+	if protocol == ImageKitty {
+		fmt.Fprint(w, "\x1b_Ga=d,q=2\x1b\\")
+	}
+}
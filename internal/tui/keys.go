@@ -0,0 +1,101 @@
+package tui
+
+import "unicode/utf8"
+
+// Key names returned by ReadKey besides printable characters.
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyLeft      = "left"
+	KeyRight     = "right"
+	KeyPageUp    = "pgup"
+	KeyPageDown  = "pgdn"
+	KeyHome      = "home"
+	KeyEnd       = "end"
+	KeyEnter     = "enter"
+	KeyEscape    = "esc"
+	KeyBackspace = "backspace"
+	KeyTab       = "tab"
+	KeyCtrlC     = "ctrl+c"
+)
+
+var escapeSequences = map[string]string{
+	"\x1b[A": KeyUp, "\x1b[B": KeyDown, "\x1b[C": KeyRight, "\x1b[D": KeyLeft,
+	"\x1bOA": KeyUp, "\x1bOB": KeyDown, "\x1bOC": KeyRight, "\x1bOD": KeyLeft,
+	"\x1b[5~": KeyPageUp, "\x1b[6~": KeyPageDown,
+	"\x1b[H": KeyHome, "\x1b[1~": KeyHome, "\x1bOH": KeyHome,
+	"\x1b[F": KeyEnd, "\x1b[4~": KeyEnd, "\x1bOF": KeyEnd,
+}
+
+// Keys reads input and sends decoded keys on the returned channel until the
+// terminal is closed.
+func (t *Terminal) Keys() <-chan string {
+	keys := make(chan string, 16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 256)
+		for {
+			n, err := t.tty.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, k := range decodeKeys(buf[:n]) {
+				keys <- k
+			}
+		}
+	}()
+	return keys
+}
+
+// decodeKeys splits one read into keys. Escape sequences arrive whole in a
+// single read in practice, so a lone ESC is the escape key.
+func decodeKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b && len(b) > 1 {
+			matched := false
+			for seq, name := range escapeSequences {
+				if len(b) >= len(seq) && string(b[:len(seq)]) == seq {
+					keys = append(keys, name)
+					b = b[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if b[1] == '[' || b[1] == 'O' {
+				// Unknown sequence: skip to its final byte
+				i := 2
+				for i < len(b) && (b[i] < 0x40 || b[i] > 0x7e) {
+					i++
+				}
+				b = b[min(i+1, len(b)):]
+				continue
+			}
+		}
+
+		switch b[0] {
+		case 0x1b:
+			keys = append(keys, KeyEscape)
+		case '\r', '\n':
+			keys = append(keys, KeyEnter)
+		case 0x7f, 0x08:
+			keys = append(keys, KeyBackspace)
+		case '\t':
+			keys = append(keys, KeyTab)
+		case 0x03:
+			keys = append(keys, KeyCtrlC)
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r != utf8.RuneError && r >= 0x20 {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
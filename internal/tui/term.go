@@ -0,0 +1,175 @@
+// Package tui provides the terminal plumbing for full-screen interfaces:
+// raw mode, key decoding, screen drawing and inline images.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Terminal is the controlling terminal switched to raw mode and the
+// alternate screen.
+type Terminal struct {
+	tty   *os.File
+	out   *bufio.Writer
+	saved string
+}
+
+// Open puts the controlling terminal into raw mode. Call Close to restore it.
+func Open() (*Terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal available: %w", err)
+	}
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("failed to enter raw mode: %w", err)
+	}
+
+	t := &Terminal{tty: tty, out: bufio.NewWriterSize(tty, 64*1024), saved: strings.TrimSpace(saved)}
+	// Alternate screen, hidden cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	t.out.Flush()
+	return t, nil
+}
+
+func (t *Terminal) Close() error {
+	t.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	t.out.Flush()
+	_, err := stty(t.tty, t.saved)
+	t.tty.Close()
+	return err
+}
+
+// Size returns the terminal size in columns and rows.
+func (t *Terminal) Size() (int, int) {
+	out, err := stty(t.tty, "size")
+	if err == nil {
+		var rows, cols int
+		if _, err := fmt.Sscanf(out, "%d %d", &rows, &cols); err == nil && rows > 0 && cols > 0 {
+			return cols, rows
+		}
+	}
+	cols, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	rows, _ := strconv.Atoi(os.Getenv("LINES"))
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	return cols, rows
+}
+
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Clear erases the screen.
+func (t *Terminal) Clear() {
+	t.out.WriteString("\x1b[2J")
+}
+
+// MoveTo positions the cursor; col and row are 0-based.
+func (t *Terminal) MoveTo(col, row int) {
+	fmt.Fprintf(t.out, "\x1b[%d;%dH", row+1, col+1)
+}
+
+// Print writes s at (col, row), clipped or padded to width cells, in style.
+func (t *Terminal) Print(col, row, width int, style Style, s string) {
+	t.MoveTo(col, row)
+	t.out.WriteString(string(style))
+	t.out.WriteString(Fit(s, width))
+	t.out.WriteString(string(StyleNormal))
+}
+
+// Write writes raw output, e.g. an image escape sequence.
+func (t *Terminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// Flush sends buffered output to the terminal.
+func (t *Terminal) Flush() error {
+	return t.out.Flush()
+}
+
+// Style is an SGR escape sequence.
+type Style string
+
+const (
+	StyleNormal   Style = "\x1b[0m"
+	StyleBold     Style = "\x1b[1m"
+	StyleDim      Style = "\x1b[2m"
+	StyleReverse  Style = "\x1b[7m"
+	StyleHeader   Style = "\x1b[1;37;44m"
+	StyleHighlite Style = "\x1b[30;43m"
+)
+
+// Fit truncates s to width cells, marking the cut with an ellipsis, or pads
+// it with spaces. Control characters are replaced so they can't break the
+// layout.
+func Fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		if width == 1 {
+			return string(runes[:1])
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// Wrap breaks text into lines of at most width runes, preferring to break
+// at spaces.
+func Wrap(text string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		runes := []rune(strings.TrimRight(para, " \t\r"))
+		if len(runes) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		for len(runes) > width {
+			cut := width
+			for i := width; i > width/2; i-- {
+				if runes[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, string(runes[:cut]))
+			runes = runes[cut:]
+			for len(runes) > 0 && runes[0] == ' ' {
+				runes = runes[1:]
+			}
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
@@ -0,0 +1,386 @@
+// Package web serves the local browser UI for the archive.
+package web
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mahirisikli/memento/internal/storage"
+)
+
+//go:embed static
+var static embed.FS
+
+// Server is the HTTP handler for the web UI and its JSON API. Apart from
+// generating missing thumbnails it never changes the archive.
+//
+// Every request must carry the server's token, so other processes and users
+// on the machine can't read the archive: the URL opened first has it as the
+// token query parameter, which is exchanged for a cookie.
+type Server struct {
+	db        *storage.DB
+	fm        *storage.FileManager
+	token     string
+	thumbnail ThumbnailFunc
+	mux       *http.ServeMux
+}
+
+// tokenCookie holds the token once the browser has presented it.
+const tokenCookie = "memento_token"
+
+// ThumbnailFunc returns the path of a screenshot's thumbnail, generating it
+// if needed.
+type ThumbnailFunc func(*storage.Screenshot) (string, error)
+
+func NewServer(db *storage.DB, fm *storage.FileManager, token string, thumbnail ThumbnailFunc) *Server {
+	s := &Server{db: db, fm: fm, token: token, thumbnail: thumbnail, mux: http.NewServeMux()}
+
+	assets, _ := fs.Sub(static, "static")
+	s.mux.Handle("GET /", http.FileServer(http.FS(assets)))
+	s.mux.HandleFunc("GET /api/days", s.handleDays)
+	s.mux.HandleFunc("GET /api/day", s.handleDay)
+	s.mux.HandleFunc("GET /api/search", s.handleSearch)
+	s.mux.HandleFunc("GET /api/screenshots/{id}", s.handleScreenshot)
+	s.mux.HandleFunc("GET /images/{id}", s.handleImage)
+	s.mux.HandleFunc("GET /thumbnails/{id}", s.handleThumbnail)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// A page on another site can point its own hostname at 127.0.0.1 (DNS
+	// rebinding) and read the archive as same-origin; its requests still name
+	// that hostname, so only our own are answered
+	if !localHost(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		s.login(w, r, token)
+		return
+	}
+	if cookie, err := r.Cookie(tokenCookie); err != nil || !s.validToken(cookie.Value) {
+		http.Error(w, "forbidden: open the URL printed by memento ui", http.StatusForbidden)
+		return
+	}
+	// No framing, sniffing or assets from elsewhere
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:; style-src 'self'; script-src 'self'")
+	s.mux.ServeHTTP(w, r)
+}
+
+// login exchanges a valid token in the URL for a cookie and redirects to the
+// same page without it, so the token doesn't stay in the address bar.
+func (s *Server) login(w http.ResponseWriter, r *http.Request, token string) {
+	if !s.validToken(token) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	query := r.URL.Query()
+	query.Del("token")
+	target := *r.URL
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+}
+
+func (s *Server) validToken(token string) bool {
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// localHost reports whether r's Host header is 127.0.0.1 or localhost on the
+// port the request arrived on.
+func localHost(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(r.Host)
+	return host == "127.0.0.1:"+port || host == "localhost:"+port
+}
+
+type screenshotJSON struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	App     string    `json:"app"`
+	Window  string    `json:"window"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	OCRText string    `json:"ocr_text,omitempty"`
+	NewText string    `json:"new_text,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+type sessionJSON struct {
+	ID     int64     `json:"id"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	App    string    `json:"app"`
+	Window string    `json:"window"`
+	Keys   int       `json:"keys"`
+	Text   string    `json:"text"`
+}
+
+func toScreenshotJSON(sc storage.Screenshot, withText bool) screenshotJSON {
+	j := screenshotJSON{
+		ID:     sc.ID,
+		Time:   sc.Timestamp,
+		App:    sc.ActiveApp,
+		Window: sc.ActiveWindowTitle,
+		Width:  sc.Width,
+		Height: sc.Height,
+		Reason: sc.CaptureReason,
+	}
+	if withText {
+		j.OCRText = sc.OCRText
+		j.NewText = sc.OCRNewText
+	}
+	return j
+}
+
+func toSessionJSON(t storage.TypingSession) sessionJSON {
+	return sessionJSON{
+		ID:     t.ID,
+		Start:  t.StartTime,
+		End:    t.EndTime,
+		App:    t.ActiveApp,
+		Window: t.ActiveWindowTitle,
+		Keys:   t.KeyCount,
+		Text:   t.Text,
+	}
+}
+
+// handleDays returns activity counts per day of a month (?month=2026-01).
+func (s *Server) handleDays(w http.ResponseWriter, r *http.Request) {
+	month, err := time.ParseInLocation("2006-01", r.URL.Query().Get("month"), time.Local)
+	if err != nil {
+		now := time.Now()
+		month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+	counts, err := s.db.GetDayCounts(month, month.AddDate(0, 1, 0))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"month": month.Format("2006-01"),
+		"days":  counts,
+	})
+}
+
+// handleDay returns a day's screenshots and typing sessions (?date=2026-01-15).
+func (s *Server) handleDay(w http.ResponseWriter, r *http.Request) {
+	day, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), time.Local)
+	if err != nil {
+		now := time.Now()
+		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	from, to := day, day.AddDate(0, 0, 1)
+
+	screenshots, err := s.db.GetScreenshotsByDateRange(from, to, 100000)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sessions, err := s.db.GetTypingSessionsByDateRange(from, to, "", 100000)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Oldest first reads naturally as a filmstrip
+	shots := make([]screenshotJSON, 0, len(screenshots))
+	for i := len(screenshots) - 1; i >= 0; i-- {
+		shots = append(shots, toScreenshotJSON(screenshots[i], false))
+	}
+	typed := make([]sessionJSON, 0, len(sessions))
+	for i := len(sessions) - 1; i >= 0; i-- {
+		typed = append(typed, toSessionJSON(sessions[i]))
+	}
+	writeJSON(w, map[string]interface{}{
+		"date":        day.Format("2006-01-02"),
+		"screenshots": shots,
+		"sessions":    typed,
+	})
+}
+
+// handleSearch searches OCR text and typing sessions (?q=...&limit=50).
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, errString("missing query"))
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	from := time.Time{}
+	to := time.Now().AddDate(1, 0, 0)
+
+	screenshots, err := s.db.SearchScreenshots(query, from, to, storage.ScreenshotFilter{}, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sessions, err := s.db.SearchTypingSessions(query, from, to, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type hit struct {
+		Type         string    `json:"type"`
+		Time         time.Time `json:"time"`
+		App          string    `json:"app"`
+		Window       string    `json:"window"`
+		Snippet      string    `json:"snippet"`
+		ScreenshotID int64     `json:"screenshot_id,omitempty"`
+		SessionID    int64     `json:"session_id,omitempty"`
+	}
+	hits := make([]hit, 0, len(screenshots)+len(sessions))
+	for _, sc := range screenshots {
+		hits = append(hits, hit{Type: "screenshot", Time: sc.Timestamp, App: sc.ActiveApp, Window: sc.ActiveWindowTitle,
+			Snippet: snippet(sc.OCRText, query, 160), ScreenshotID: sc.ID})
+	}
+	for _, t := range sessions {
+		hits = append(hits, hit{Type: "typing", Time: t.StartTime, App: t.ActiveApp, Window: t.ActiveWindowTitle,
+			Snippet: snippet(t.Text, query, 160), SessionID: t.ID})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Time.After(hits[j].Time) })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	writeJSON(w, map[string]interface{}{
+		"query":   query,
+		"count":   len(hits),
+		"results": hits,
+	})
+}
+
+// handleScreenshot returns one screenshot with its OCR text.
+func (s *Server) handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, toScreenshotJSON(*sc, true))
+}
+
+// handleImage serves a screenshot's image. Files are looked up by ID so no
+// path from the request ever reaches the filesystem.
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	s.serveImage(w, r, sc)
+}
+
+// handleThumbnail serves a screenshot's thumbnail, falling back to the full
+// image when no thumbnail can be made.
+func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if s.thumbnail != nil {
+		if thumb, err := s.thumbnail(sc); err == nil {
+			if image, err := s.fm.OpenImage(storage.ImageRef{Path: thumb}); err == nil {
+				defer image.Close()
+				http.ServeContent(w, r, filepath.Base(thumb), sc.Timestamp, image)
+				return
+			}
+		}
+	}
+	s.serveImage(w, r, sc)
+}
+
+// serveImage serves the full image, which may be packed in a segment.
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request, sc *storage.Screenshot) {
+	image, err := s.fm.OpenImage(sc.Image())
+	if err != nil {
+		writeError(w, http.StatusNotFound, errString("image not found"))
+		return
+	}
+	defer image.Close()
+	http.ServeContent(w, r, filepath.Base(sc.Filepath), sc.Timestamp, image)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*storage.Screenshot, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errString("invalid screenshot id"))
+		return nil, false
+	}
+	sc, err := s.db.GetScreenshot(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if sc == nil {
+		writeError(w, http.StatusNotFound, errString("screenshot not found"))
+		return nil, false
+	}
+	return sc, true
+}
+
+// snippet returns up to width characters of text around the first
+// case-insensitive occurrence of query.
+func snippet(text, query string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	idx := strings.Index(strings.ToLower(text), strings.ToLower(query))
+	start := 0
+	if idx >= 0 {
+		start = max(len([]rune(text[:idx]))-width/3, 0)
+	}
+	end := min(start+width, len(runes))
+	out := string(runes[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
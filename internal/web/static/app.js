@@ -0,0 +1,315 @@
+// Memento web UI. Plain DOM code, no dependencies.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  month: startOfMonth(new Date()),
+  day: isoDate(new Date()),
+  counts: {},
+  screenshots: [],
+  index: -1,
+};
+
+function startOfMonth(d) {
+  return new Date(d.getFullYear(), d.getMonth(), 1);
+}
+
+function pad(n) {
+  return String(n).padStart(2, "0");
+}
+
+function isoDate(d) {
+  return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())}`;
+}
+
+function isoMonth(d) {
+  return `${d.getFullYear()}-${pad(d.getMonth() + 1)}`;
+}
+
+function clock(t) {
+  const d = new Date(t);
+  return `${pad(d.getHours())}:${pad(d.getMinutes())}`;
+}
+
+function el(tag, props, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, props || {});
+  for (const child of children) {
+    node.append(child);
+  }
+  return node;
+}
+
+async function api(path) {
+  const res = await fetch(path);
+  const body = await res.json();
+  if (!res.ok) {
+    throw new Error(body.error || res.statusText);
+  }
+  return body;
+}
+
+// highlight returns a fragment with every case-insensitive occurrence of
+// each query term wrapped in <mark>. Text is added as text nodes, never HTML.
+function highlight(text, query) {
+  const frag = document.createDocumentFragment();
+  const terms = query.split(/\s+/).filter(Boolean)
+    .map((t) => t.replace(/[.*+?^${}()|[\]\\]/g, "\\$&"))
+    .filter(Boolean);
+  if (terms.length === 0) {
+    frag.append(text);
+    return frag;
+  }
+  const re = new RegExp(terms.join("|"), "gi");
+  let last = 0;
+  for (const m of text.matchAll(re)) {
+    if (m[0] === "") {
+      continue;
+    }
+    frag.append(text.slice(last, m.index), el("mark", { textContent: m[0] }));
+    last = m.index + m[0].length;
+  }
+  frag.append(text.slice(last));
+  return frag;
+}
+
+// Calendar
+
+async function loadMonth() {
+  $("month-label").textContent = state.month.toLocaleDateString(undefined, { month: "long", year: "numeric" });
+  try {
+    state.counts = (await api(`/api/days?month=${isoMonth(state.month)}`)).days || {};
+  } catch (err) {
+    state.counts = {};
+  }
+  renderCalendar();
+}
+
+function renderCalendar() {
+  const grid = $("calendar-grid");
+  grid.replaceChildren();
+  for (const name of ["Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"]) {
+    grid.append(el("span", { className: "weekday", textContent: name }));
+  }
+
+  const first = state.month;
+  const offset = (first.getDay() + 6) % 7;
+  for (let i = 0; i < offset; i++) {
+    grid.append(el("span"));
+  }
+
+  const today = isoDate(new Date());
+  const max = Math.max(1, ...Object.values(state.counts));
+  const days = new Date(first.getFullYear(), first.getMonth() + 1, 0).getDate();
+  for (let d = 1; d <= days; d++) {
+    const date = isoDate(new Date(first.getFullYear(), first.getMonth(), d));
+    const count = state.counts[date] || 0;
+    const button = el("button", { type: "button", textContent: d, title: `${count} items` });
+    if (count > 0) {
+      button.classList.add(`level-${Math.min(3, 1 + Math.floor((count / max) * 3))}`);
+    }
+    if (date === today) {
+      button.classList.add("today");
+    }
+    if (date === state.day) {
+      button.classList.add("selected");
+    }
+    button.addEventListener("click", () => selectDay(date));
+    grid.append(button);
+  }
+}
+
+function selectDay(date) {
+  state.day = date;
+  $("search").value = "";
+  location.hash = date;
+  renderCalendar();
+  loadDay();
+}
+
+// Day view
+
+async function loadDay() {
+  $("search-view").hidden = true;
+  $("day-view").hidden = false;
+
+  const date = new Date(`${state.day}T00:00:00`);
+  $("day-title").textContent = date.toLocaleDateString(undefined, {
+    weekday: "long", year: "numeric", month: "long", day: "numeric",
+  });
+
+  let data;
+  try {
+    data = await api(`/api/day?date=${state.day}`);
+  } catch (err) {
+    $("filmstrip").replaceChildren(el("p", { className: "empty", textContent: err.message }));
+    $("sessions").replaceChildren();
+    return;
+  }
+  state.screenshots = data.screenshots;
+  renderFilmstrip();
+  renderSessions(data.sessions);
+}
+
+function renderFilmstrip() {
+  const strip = $("filmstrip");
+  strip.replaceChildren();
+  if (state.screenshots.length === 0) {
+    strip.append(el("p", { className: "empty", textContent: "No screenshots." }));
+    return;
+  }
+  state.screenshots.forEach((s, i) => {
+    const caption = `${clock(s.time)} ${s.app || ""}`;
+    const figure = el("figure", { title: s.window || s.app || "" },
+      el("img", { src: `/thumbnails/${s.id}`, loading: "lazy", alt: caption }),
+      el("figcaption", { textContent: caption }));
+    figure.addEventListener("click", () => openLightbox(i));
+    strip.append(figure);
+  });
+}
+
+function renderSessions(sessions) {
+  const list = $("sessions");
+  list.replaceChildren();
+  if (sessions.length === 0) {
+    list.append(el("li", { className: "empty", textContent: "No typing." }));
+    return;
+  }
+  for (const t of sessions) {
+    const where = [t.app, t.window].filter(Boolean).join(" — ");
+    list.append(el("li", {},
+      el("div", { className: "meta", textContent: `${clock(t.start)}–${clock(t.end)}  ${where}  (${t.keys} keys)` }),
+      el("pre", { className: "text", textContent: t.text })));
+  }
+}
+
+// Lightbox
+
+async function openLightbox(index) {
+  if (index < 0 || index >= state.screenshots.length) {
+    return;
+  }
+  state.index = index;
+  const s = state.screenshots[index];
+  $("lightbox").hidden = false;
+  $("lightbox-image").src = `/images/${s.id}`;
+  $("lightbox-caption").textContent =
+    `${clock(s.time)}  ${[s.app, s.window].filter(Boolean).join(" — ")}  (${index + 1}/${state.screenshots.length})`;
+  $("ocr-overlay").textContent = "";
+  $("ocr-overlay").hidden = !$("ocr-toggle").checked;
+
+  try {
+    const detail = await api(`/api/screenshots/${s.id}`);
+    if (state.index === index) {
+      $("ocr-overlay").textContent = detail.ocr_text || "(no OCR text)";
+    }
+  } catch (err) {
+    $("ocr-overlay").textContent = err.message;
+  }
+}
+
+function closeLightbox() {
+  $("lightbox").hidden = true;
+  $("lightbox-image").removeAttribute("src");
+  state.index = -1;
+}
+
+// Search
+
+async function search(query) {
+  $("day-view").hidden = true;
+  $("search-view").hidden = false;
+  $("search-title").textContent = `Searching for “${query}”…`;
+  const list = $("results");
+  list.replaceChildren();
+
+  let data;
+  try {
+    data = await api(`/api/search?q=${encodeURIComponent(query)}`);
+  } catch (err) {
+    $("search-title").textContent = err.message;
+    return;
+  }
+  $("search-title").textContent = `${data.count} results for “${query}”`;
+  for (const r of data.results) {
+    const when = new Date(r.time);
+    const where = [r.app, r.window].filter(Boolean).join(" — ");
+    const item = el("li", { className: "clickable" },
+      el("div", { className: "meta", textContent: `${isoDate(when)} ${clock(r.time)}  ${r.type}  ${where}` }),
+      el("div", { className: "text" }, highlight(r.snippet, query)));
+    item.addEventListener("click", () => openResult(r, isoDate(when)));
+    list.append(item);
+  }
+}
+
+async function openResult(r, date) {
+  state.day = date;
+  state.month = startOfMonth(new Date(`${date}T00:00:00`));
+  $("search").value = "";
+  location.hash = date;
+  await Promise.all([loadMonth(), loadDay()]);
+  if (r.screenshot_id) {
+    const index = state.screenshots.findIndex((s) => s.id === r.screenshot_id);
+    if (index >= 0) {
+      openLightbox(index);
+    }
+  }
+}
+
+// Wiring
+
+$("prev-month").addEventListener("click", () => {
+  state.month = new Date(state.month.getFullYear(), state.month.getMonth() - 1, 1);
+  loadMonth();
+});
+
+$("next-month").addEventListener("click", () => {
+  state.month = new Date(state.month.getFullYear(), state.month.getMonth() + 1, 1);
+  loadMonth();
+});
+
+$("search-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const query = $("search").value.trim();
+  if (query) {
+    search(query);
+  } else {
+    loadDay();
+  }
+});
+
+$("ocr-toggle").addEventListener("change", () => {
+  $("ocr-overlay").hidden = !$("ocr-toggle").checked;
+});
+
+$("lightbox-close").addEventListener("click", closeLightbox);
+$("lightbox-prev").addEventListener("click", () => openLightbox(state.index - 1));
+$("lightbox-next").addEventListener("click", () => openLightbox(state.index + 1));
+
+document.addEventListener("keydown", (e) => {
+  if ($("lightbox").hidden) {
+    return;
+  }
+  switch (e.key) {
+    case "Escape":
+      closeLightbox();
+      break;
+    case "ArrowLeft":
+      openLightbox(state.index - 1);
+      break;
+    case "ArrowRight":
+      openLightbox(state.index + 1);
+      break;
+    case "o":
+      $("ocr-toggle").click();
+      break;
+  }
+});
+
+if (/^#\d{4}-\d{2}-\d{2}$/.test(location.hash)) {
+  state.day = location.hash.slice(1);
+  state.month = startOfMonth(new Date(`${state.day}T00:00:00`));
+}
+loadMonth();
+loadDay();